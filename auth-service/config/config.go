@@ -1,26 +1,72 @@
 package config
 
 import (
+	"time"
+
 	_ "github.com/jpfuentes2/go-env/autoload"
 	"github.com/kelseyhightower/envconfig"
 )
 
 type AuthConfig struct {
-	SecretKey string `envconfig:"secret_key"`
+	SecretKey                  string        `envconfig:"secret_key"`
+	SigningMethod              string        `envconfig:"signing_method" default:"HS256"`
+	SigningKeyFile             string        `envconfig:"signing_key_file"`
+	VerificationKeyFiles       []string      `envconfig:"verification_key_files"`
+	AccessTokenTTL             time.Duration `envconfig:"access_token_ttl" default:"15m"`
+	RefreshTokenTTL            time.Duration `envconfig:"refresh_token_ttl" default:"720h"`
+	DenylistSync               time.Duration `envconfig:"denylist_sync" default:"1m"`
+	IntrospectionClients       []string      `envconfig:"introspection_clients"`
+	PasswordResetTTL           time.Duration `envconfig:"password_reset_ttl" default:"1h"`
+	EmailVerificationTTL       time.Duration `envconfig:"email_verification_ttl" default:"24h"`
+	RequireVerifiedEmail       bool          `envconfig:"require_verified_email" default:"true"`
+	VerificationResendInterval time.Duration `envconfig:"verification_resend_interval" default:"1m"`
+	LoginFreeAttempts          int           `envconfig:"login_free_attempts" default:"3"`
+	LoginIPFreeAttempts        int           `envconfig:"login_ip_free_attempts" default:"20"`
+	LoginBackoffBase           time.Duration `envconfig:"login_backoff_base" default:"1s"`
+	LoginBackoffMax            time.Duration `envconfig:"login_backoff_max" default:"5m"`
+	LoginLockoutAttempts       int           `envconfig:"login_lockout_attempts" default:"10"`
+	LoginLockoutDuration       time.Duration `envconfig:"login_lockout_duration" default:"15m"`
+	LoginAttemptWindow         time.Duration `envconfig:"login_attempt_window" default:"1h"`
+	TotpIssuer                 string        `envconfig:"totp_issuer" default:"auth-service"`
+	MfaChallengeTTL            time.Duration `envconfig:"mfa_challenge_ttl" default:"5m"`
 }
 
 type HttpConfig struct {
-	Host           string `envconfig:"host"`
-	Port           string `envconfig:"port"`
-	ContextTimeout int    `envconfig:"context_timeout"`
+	Host           string   `envconfig:"host"`
+	Port           string   `envconfig:"port"`
+	ContextTimeout int      `envconfig:"context_timeout" default:"5000"`
+	ProxyHeader    string   `envconfig:"proxy_header"`
+	TrustedProxies []string `envconfig:"trusted_proxies"`
 }
 
 type DbConfig struct {
-	Host     string `envconfig:"host"`
-	Port     string `envconfig:"port"`
-	Username string `envconfig:"username"`
-	Password string `envconfig:"password"`
-	Name     string `envconfig:"name"`
+	Driver      string `envconfig:"driver" default:"postgres"`
+	Host        string `envconfig:"host"`
+	Port        string `envconfig:"port"`
+	Username    string `envconfig:"username"`
+	Password    string `envconfig:"password"`
+	Name        string `envconfig:"name"`
+	AutoMigrate bool   `envconfig:"auto_migrate" default:"false"`
+}
+
+type WebAuthnConfig struct {
+	RPID          string        `envconfig:"rp_id" default:"localhost"`
+	RPDisplayName string        `envconfig:"rp_display_name" default:"auth-service"`
+	RPOrigins     []string      `envconfig:"rp_origins" default:"http://localhost:8080"`
+	SessionTTL    time.Duration `envconfig:"session_ttl" default:"5m"`
+}
+
+type MailConfig struct {
+	Driver               string `envconfig:"driver" default:"log"`
+	Host                 string `envconfig:"host"`
+	Port                 string `envconfig:"port" default:"587"`
+	Username             string `envconfig:"username"`
+	Password             string `envconfig:"password"`
+	From                 string `envconfig:"from"`
+	FilePath             string `envconfig:"file_path" default:"mail.log"`
+	PasswordResetUrl     string `envconfig:"password_reset_url"`
+	EmailVerificationUrl string `envconfig:"email_verification_url"`
+	EmailChangeUrl       string `envconfig:"email_change_url"`
 }
 
 func (ac *AuthConfig) MustConfig() error {
@@ -34,3 +80,11 @@ func (hc *HttpConfig) MustConfig() error {
 func (dc *DbConfig) MustConfig() error {
 	return envconfig.Process("db", dc)
 }
+
+func (mc *MailConfig) MustConfig() error {
+	return envconfig.Process("mail", mc)
+}
+
+func (wc *WebAuthnConfig) MustConfig() error {
+	return envconfig.Process("webauthn", wc)
+}
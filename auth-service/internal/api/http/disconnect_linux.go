@@ -0,0 +1,40 @@
+//go:build linux
+
+package http
+
+import (
+	"errors"
+	"net"
+	"syscall"
+)
+
+// connClosed peeks at the socket without blocking, so pipelined requests are left for fasthttp.
+// ok is false if the connection is not a socket that can be checked, e.g. a TLS connection.
+func connClosed(conn net.Conn) (closed, ok bool) {
+	syscallConn, isSyscallConn := conn.(syscall.Conn)
+	if !isSyscallConn {
+		return false, false
+	}
+
+	rawConn, err := syscallConn.SyscallConn()
+	if err != nil {
+		return false, false
+	}
+
+	var n int
+	var recvErr error
+	buf := make([]byte, 1)
+	err = rawConn.Read(func(fd uintptr) bool {
+		n, _, recvErr = syscall.Recvfrom(int(fd), buf, syscall.MSG_PEEK|syscall.MSG_DONTWAIT)
+		return true
+	})
+	if err != nil {
+		return false, false
+	}
+	if errors.Is(recvErr, syscall.EAGAIN) || errors.Is(recvErr, syscall.EINTR) {
+		return false, true
+	}
+
+	// a read of 0 bytes is the end of the stream, any other error a reset connection
+	return n == 0 || recvErr != nil, true
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package http
+
+import "net"
+
+// connClosed is not implemented on this platform, abandoned requests only stop at their deadline.
+func connClosed(net.Conn) (closed, ok bool) {
+	return false, false
+}
@@ -0,0 +1,233 @@
+package http
+
+import (
+	"auth/internal/auth"
+	"auth/internal/passkey"
+	"auth/internal/store"
+	"context"
+	"database/sql"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var (
+	errInvalidId      = errors.New("id must be a positive number")
+	errInternalServer = errors.New("internal server error")
+	errRequestTimeout = errors.New("request timed out")
+)
+
+// ErrorResponse is the body of every error response.
+type ErrorResponse struct {
+	Error ErrorBody `json:"error"`
+}
+
+type ErrorBody struct {
+	Status  int          `json:"status"`
+	Message string       `json:"message"`
+	Fields  []FieldError `json:"fields,omitempty"`
+}
+
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError lists every invalid field of a request. It is answered with 422.
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, 0, len(e.Fields))
+	for _, field := range e.Fields {
+		messages = append(messages, field.Field+": "+field.Message)
+	}
+
+	return "validation failed: " + strings.Join(messages, "; ")
+}
+
+// check records err, if any, as the problem with field.
+func (e *ValidationError) check(field string, err error) {
+	if err != nil {
+		e.Fields = append(e.Fields, FieldError{Field: field, Message: err.Error()})
+	}
+}
+
+// err returns the ValidationError if a field failed and nil otherwise.
+func (e *ValidationError) err() error {
+	if len(e.Fields) == 0 {
+		return nil
+	}
+
+	return e
+}
+
+// invalidField reports a single invalid field. Errors other than validation errors are returned as is.
+func invalidField(field string, err error) error {
+	if err == nil || !isValidationError(err) {
+		return err
+	}
+
+	var ve ValidationError
+	ve.check(field, err)
+	return ve.err()
+}
+
+// statusError is an error whose status depends on where it occurred, e.g. a request body that cannot be parsed.
+type statusError struct {
+	status int
+	err    error
+}
+
+func (e *statusError) Error() string {
+	return e.err.Error()
+}
+
+func (e *statusError) Unwrap() error {
+	return e.err
+}
+
+func badRequest(err error) error {
+	return &statusError{status: http.StatusBadRequest, err: err}
+}
+
+// retryAfterError is returned when the client has to wait before repeating the request.
+type retryAfterError struct {
+	retryAfter time.Duration
+}
+
+func (e *retryAfterError) Error() string {
+	return "too many requests, retry in " + e.retryAfterSeconds() + " seconds"
+}
+
+func (e *retryAfterError) retryAfterSeconds() string {
+	return strconv.Itoa(int(math.Ceil(e.retryAfter.Seconds())))
+}
+
+// duplicateFields names the request field behind a violated unique constraint. Constraint names are
+// details of the schema and never sent to clients.
+var duplicateFields = map[string]FieldError{
+	"user_email_key":                        {Field: "email", Message: "already registered"},
+	"user_email_lower_key":                  {Field: "email", Message: "already registered"},
+	"job_role_name_key":                     {Field: "name", Message: "already exists"},
+	"settlement_type_name_key":              {Field: "name", Message: "already exists"},
+	"webauthn_credential_credential_id_key": {Field: "credential", Message: "already registered"},
+}
+
+// validationErrors are answered with 422 when they are not reported for a field.
+var validationErrors = []error{
+	errInvalidVideoName, errInvalidVideoEvent, errPasswordTooShort, errPasswordTooLong,
+	errFieldTooLong, errInvalidBirthday, errInvalidSettlement, errInvalidEmail, errInvalidJobRole,
+	errUnknownJobRole, errRetiredJobRole, errAdminJobRole, errUnknownSettlement, errRetiredSettlement,
+	errInvalidRole, errInvalidName, errRequired,
+}
+
+func isValidationError(err error) bool {
+	for _, validationErr := range validationErrors {
+		if errors.Is(err, validationErr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// errorStatus maps the errors of the services to HTTP statuses.
+func errorStatus(err error) int {
+	var statusErr *statusError
+	var retryErr *retryAfterError
+	var validationErr *ValidationError
+	var fiberErr *fiber.Error
+
+	switch {
+	case errors.As(err, &statusErr):
+		return statusErr.status
+	case errors.As(err, &retryErr):
+		return http.StatusTooManyRequests
+	case errors.As(err, &validationErr), isValidationError(err):
+		return http.StatusUnprocessableEntity
+	case errors.As(err, &fiberErr):
+		return fiberErr.Code
+	case errors.Is(err, errInvalidCredentials),
+		errors.Is(err, errMissingBearerToken),
+		errors.Is(err, errInvalidClientCredential),
+		errors.Is(err, errInvalidMfaCode),
+		errors.Is(err, errPasskeyLoginFailed),
+		errors.Is(err, auth.ErrInvalidToken),
+		errors.Is(err, auth.ErrTokenRevoked),
+		errors.Is(err, auth.ErrInvalidRefreshToken),
+		errors.Is(err, auth.ErrRefreshTokenExpired),
+		errors.Is(err, auth.ErrRefreshTokenReused):
+		return http.StatusUnauthorized
+	case errors.Is(err, errAdminRequired),
+		errors.Is(err, auth.ErrEmailNotVerified),
+		errors.Is(err, auth.ErrUserDeactivated),
+		errors.Is(err, errDeactivateSelf),
+		errors.Is(err, errDeleteSelf),
+		errors.Is(err, errChangeOwnJobRole):
+		return http.StatusForbidden
+	case errors.Is(err, errEmailTaken),
+		errors.Is(err, errMfaEnabled),
+		errors.Is(err, errMfaNotEnabled),
+		errors.Is(err, errPasskeyRegistered),
+		errors.Is(err, store.ErrDuplicate):
+		return http.StatusConflict
+	case errors.Is(err, auth.ErrInvalidUserToken),
+		errors.Is(err, passkey.ErrInvalidResponse):
+		return http.StatusBadRequest
+	case errors.Is(err, sql.ErrNoRows):
+		return http.StatusNotFound
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusServiceUnavailable
+	}
+
+	return http.StatusInternalServerError
+}
+
+// ErrorHandler answers every error returned by a handler with an ErrorResponse.
+// Messages of unexpected errors are logged, but not sent to the client.
+func (hr *httpRepository) ErrorHandler(c *fiber.Ctx, err error) error {
+	status := errorStatus(err)
+	body := ErrorBody{
+		Status:  status,
+		Message: err.Error(),
+	}
+
+	var retryErr *retryAfterError
+	if errors.As(err, &retryErr) {
+		c.Set(fiber.HeaderRetryAfter, retryErr.retryAfterSeconds())
+	}
+
+	var validationErr *ValidationError
+	if errors.As(err, &validationErr) {
+		body.Message = "request validation failed"
+		body.Fields = validationErr.Fields
+	}
+
+	var duplicateErr *store.DuplicateError
+	if errors.As(err, &duplicateErr) {
+		body.Message = store.ErrDuplicate.Error()
+		if field, ok := duplicateFields[duplicateErr.Constraint]; ok {
+			body.Fields = []FieldError{field}
+		}
+	}
+
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		hr.logger.Warn("request timed out", "method", c.Method(), "path", c.Path())
+		body.Message = errRequestTimeout.Error()
+	case status >= http.StatusInternalServerError:
+		hr.logger.Error("request failed", "method", c.Method(), "path", c.Path(), "err", err.Error())
+		body.Message = errInternalServer.Error()
+	case errors.Is(err, sql.ErrNoRows):
+		body.Message = "not found"
+	}
+
+	return c.Status(status).JSON(ErrorResponse{Error: body})
+}
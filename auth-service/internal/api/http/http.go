@@ -1,30 +1,92 @@
 package http
 
 import (
-	"context"
+	"auth/config"
+	"auth/internal/auth"
 	"log/slog"
 	"net/http"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 )
 
 type httpRepository struct {
-	httpService *HttpService
-	logger      *slog.Logger
-	ctx         *context.Context
+	httpService    *HttpService
+	logger         *slog.Logger
+	contextTimeout time.Duration
 }
 
-func NewAuthRepository(httpService *HttpService, logger *slog.Logger, ctx *context.Context) *httpRepository {
+func NewAuthRepository(httpService *HttpService, httpConfig *config.HttpConfig, logger *slog.Logger) *httpRepository {
 	return &httpRepository{
-		httpService: httpService,
-		logger:      logger,
-		ctx:         ctx,
+		httpService:    httpService,
+		logger:         logger,
+		contextTimeout: time.Duration(httpConfig.ContextTimeout) * time.Millisecond,
 	}
 }
 
 func (hr *httpRepository) RegisterRouts(app *fiber.App) {
+	app.Use(hr.withTimeout)
+
 	app.Post("/login", hr.login)
+	app.Post("/login/mfa", hr.loginMfa)
+	app.Post("/login/passkey/begin", hr.beginPasskeyLogin)
+	app.Post("/login/passkey/finish", hr.finishPasskeyLogin)
 	app.Post("/register", hr.registration)
+	app.Post("/refresh", hr.refresh)
+	app.Post("/logout", hr.authenticate, hr.logout)
+	app.Post("/logout-all", hr.authenticate, hr.logoutAll)
+	app.Get("/.well-known/jwks.json", hr.jwks)
+	app.Post("/introspect", hr.authenticateClient, hr.introspect)
+	app.Post("/history", hr.authenticate, hr.recordHistory)
+	app.Get("/history", hr.authenticate, hr.history)
+	app.Post("/users/:id/history", hr.authenticateClient, hr.recordUserHistory)
+	app.Post("/password/forgot", hr.forgotPassword)
+	app.Post("/password/reset", hr.resetPassword)
+	app.Get("/verify-email", hr.verifyEmailPage)
+	app.Post("/verify-email", hr.verifyEmail)
+	app.Post("/verify-email/resend", hr.resendVerification)
+	app.Get("/me", hr.authenticate, hr.profile)
+	app.Patch("/me", hr.authenticate, hr.updateProfile)
+	app.Put("/me/address", hr.authenticate, hr.updateAddress)
+	app.Post("/me/password", hr.authenticate, hr.changePassword)
+	app.Post("/me/email", hr.authenticate, hr.changeEmail)
+	app.Get("/me/email/confirm", hr.confirmEmailChangePage)
+	app.Post("/me/email/confirm", hr.confirmEmailChange)
+	app.Get("/me/mfa", hr.authenticate, hr.mfaStatus)
+	app.Post("/me/mfa/totp", hr.authenticate, hr.enrollTotp)
+	app.Post("/me/mfa/totp/confirm", hr.authenticate, hr.confirmTotp)
+	app.Post("/me/mfa/totp/disable", hr.authenticate, hr.disableTotp)
+	app.Post("/me/mfa/recovery-codes", hr.authenticate, hr.regenerateRecoveryCodes)
+	app.Get("/me/sessions", hr.authenticate, hr.sessions)
+	app.Delete("/me/sessions/:id", hr.authenticate, hr.revokeSession)
+	app.Post("/me/sessions/revoke-others", hr.authenticate, hr.revokeOtherSessions)
+	app.Get("/me/passkeys", hr.authenticate, hr.passkeys)
+	app.Post("/me/passkeys/register/begin", hr.authenticate, hr.beginPasskeyRegistration)
+	app.Post("/me/passkeys/register/finish", hr.authenticate, hr.finishPasskeyRegistration)
+	app.Delete("/me/passkeys/:id", hr.authenticate, hr.deletePasskey)
+	app.Get("/job-roles", hr.jobRoles)
+	app.Get("/settlement-types", hr.settlementTypes)
+
+	admin := app.Group("/admin", hr.authenticate, hr.requireAdmin)
+	admin.Post("/users/:id/deactivate", hr.deactivateUser)
+	admin.Post("/users/:id/reactivate", hr.reactivateUser)
+	admin.Get("/users", hr.listUsers)
+	admin.Get("/users/:id", hr.getUser)
+	admin.Put("/users/:id/job-role", hr.setUserJobRole)
+	admin.Post("/users/:id/password", hr.resetUserPassword)
+	admin.Delete("/users/:id", hr.deleteUser)
+	admin.Delete("/users/:id/mfa", hr.resetUserMfa)
+	admin.Get("/users/:id/sessions", hr.userSessions)
+	admin.Delete("/users/:id/sessions", hr.revokeUserSessions)
+	admin.Delete("/users/:id/sessions/:sessionId", hr.revokeUserSession)
+	admin.Get("/job-roles", hr.jobRoles)
+	admin.Post("/job-roles", hr.createJobRole)
+	admin.Patch("/job-roles/:id", hr.renameJobRole)
+	admin.Post("/job-roles/:id/retire", hr.retireJobRole)
+	admin.Get("/settlement-types", hr.settlementTypes)
+	admin.Post("/settlement-types", hr.createSettlementType)
+	admin.Patch("/settlement-types/:id", hr.renameSettlementType)
+	admin.Post("/settlement-types/:id/retire", hr.retireSettlementType)
 }
 
 func (hr *httpRepository) login(c *fiber.Ctx) error {
@@ -32,41 +94,897 @@ func (hr *httpRepository) login(c *fiber.Ctx) error {
 
 	err := c.BodyParser(&loginUser)
 	if err != nil {
-		c.Status(http.StatusBadRequest)
-		c.JSON(err)
-		return err
+		return badRequest(err)
 	}
 
-	token, err := hr.httpService.LoginUser(loginUser)
+	token, challenge, err := hr.httpService.LoginUser(c.UserContext(), loginUser, c.IP(), c.Get(fiber.HeaderUserAgent))
 	if err != nil {
-		c.Status(http.StatusBadRequest)
-		c.JSON(err)
 		return err
 	}
 
 	c.Status(http.StatusOK)
+	if challenge != nil {
+		return c.JSON(challenge)
+	}
 	c.JSON(token)
 	return nil
 }
 
+func (hr *httpRepository) loginMfa(c *fiber.Ctx) error {
+	var request MfaLoginRequest
+
+	err := c.BodyParser(&request)
+	if err != nil {
+		return badRequest(err)
+	}
+
+	token, err := hr.httpService.CompleteMfaLogin(c.UserContext(), request, c.IP(), c.Get(fiber.HeaderUserAgent))
+	if err != nil {
+		return err
+	}
+
+	c.Status(http.StatusOK)
+	return c.JSON(token)
+}
+
 func (hr *httpRepository) registration(c *fiber.Ctx) error {
 	var user RegisterUserRequest
 
 	err := c.BodyParser(&user)
 	if err != nil {
-		c.Status(http.StatusBadRequest)
-		c.JSON(err)
+		return badRequest(err)
+	}
+
+	profile, err := hr.httpService.RegisterUser(c.UserContext(), user)
+	if err != nil {
+		return err
+	}
+
+	c.Status(http.StatusOK)
+	return c.JSON(profile)
+}
+
+func (hr *httpRepository) refresh(c *fiber.Ctx) error {
+	var token auth.Token
+
+	err := c.BodyParser(&token)
+	if err != nil {
+		return badRequest(err)
+	}
+
+	newToken, err := hr.httpService.RefreshToken(c.UserContext(), token, c.IP(), c.Get(fiber.HeaderUserAgent))
+	if err != nil {
+		return err
+	}
+
+	c.Status(http.StatusOK)
+	c.JSON(newToken)
+	return nil
+}
+
+func (hr *httpRepository) logout(c *fiber.Ctx) error {
+	err := hr.httpService.Logout(c.UserContext(), userClaims(c))
+	if err != nil {
+		return err
+	}
+
+	c.Status(http.StatusNoContent)
+	return nil
+}
+
+func (hr *httpRepository) logoutAll(c *fiber.Ctx) error {
+	err := hr.httpService.LogoutAll(c.UserContext(), userClaims(c))
+	if err != nil {
+		return err
+	}
+
+	c.Status(http.StatusNoContent)
+	return nil
+}
+
+func (hr *httpRepository) jwks(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderCacheControl, "public, max-age=300")
+	c.Status(http.StatusOK)
+	return c.JSON(hr.httpService.JWKS())
+}
+
+func (hr *httpRepository) introspect(c *fiber.Ctx) error {
+	var request IntrospectionRequest
+
+	err := c.BodyParser(&request)
+	if err != nil {
+		return badRequest(err)
+	}
+
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	c.Status(http.StatusOK)
+	return c.JSON(hr.httpService.Introspect(request))
+}
+
+func (hr *httpRepository) recordHistory(c *fiber.Ctx) error {
+	var request VideoHistoryRequest
+
+	err := c.BodyParser(&request)
+	if err != nil {
+		return badRequest(err)
+	}
+
+	entry, err := hr.httpService.RecordVideoHistory(c.UserContext(), userClaims(c).ID, request)
+	if err != nil {
+		return err
+	}
+
+	c.Status(http.StatusCreated)
+	return c.JSON(entry)
+}
+
+// recordUserHistory lets a resource server record history for a user with its own client
+// credentials, so entries are not lost once the access token of the user expired.
+func (hr *httpRepository) recordUserHistory(c *fiber.Ctx) error {
+	var request VideoHistoryRequest
+
+	userID, err := c.ParamsInt("id")
+	if err != nil {
+		return badRequest(errInvalidId)
+	}
+
+	err = c.BodyParser(&request)
+	if err != nil {
+		return badRequest(err)
+	}
+
+	entry, err := hr.httpService.RecordUserVideoHistory(c.UserContext(), int64(userID), request)
+	if err != nil {
+		return err
+	}
+
+	c.Status(http.StatusCreated)
+	return c.JSON(entry)
+}
+
+func (hr *httpRepository) history(c *fiber.Ctx) error {
+	var query VideoHistoryQuery
+
+	err := c.QueryParser(&query)
+	if err != nil {
+		return badRequest(err)
+	}
+
+	history, err := hr.httpService.GetVideoHistory(c.UserContext(), userClaims(c), query)
+	if err != nil {
+		return err
+	}
+
+	c.Status(http.StatusOK)
+	return c.JSON(history)
+}
+
+func (hr *httpRepository) forgotPassword(c *fiber.Ctx) error {
+	var request ForgotPasswordRequest
+
+	err := c.BodyParser(&request)
+	if err != nil {
+		return badRequest(err)
+	}
+
+	err = hr.httpService.ForgotPassword(c.UserContext(), request)
+	if err != nil {
+		return err
+	}
+
+	c.Status(http.StatusAccepted)
+	return nil
+}
+
+func (hr *httpRepository) resetPassword(c *fiber.Ctx) error {
+	var request ResetPasswordRequest
+
+	err := c.BodyParser(&request)
+	if err != nil {
+		return badRequest(err)
+	}
+
+	err = hr.httpService.ResetPassword(c.UserContext(), request)
+	if err != nil {
+		return err
+	}
+
+	c.Status(http.StatusNoContent)
+	return nil
+}
+
+// verifyEmailPage is where the link in the verification mail leads. It does not verify anything itself,
+// the page posts the token to verifyEmail.
+func (hr *httpRepository) verifyEmailPage(c *fiber.Ctx) error {
+	return renderConfirmationPage(c, confirmationPage{
+		Title:  "Verify your email address",
+		Action: c.Path(),
+		Token:  c.Query("token"),
+		Button: "Verify",
+	})
+}
+
+func (hr *httpRepository) verifyEmail(c *fiber.Ctx) error {
+	var request VerifyEmailRequest
+
+	err := c.QueryParser(&request)
+	if err != nil {
+		return badRequest(err)
+	}
+	if request.Token == "" {
+		err = c.BodyParser(&request)
+		if err != nil {
+			return badRequest(err)
+		}
+	}
+
+	err = hr.httpService.VerifyEmail(c.UserContext(), request)
+	if err != nil {
+		return err
+	}
+
+	if isFormPost(c) {
+		return renderConfirmationPage(c, confirmationPage{
+			Title: "Email address verified",
+			Text:  "You can log in now.",
+		})
+	}
+
+	c.Status(http.StatusNoContent)
+	return nil
+}
+
+func (hr *httpRepository) resendVerification(c *fiber.Ctx) error {
+	var request ResendVerificationRequest
+
+	err := c.BodyParser(&request)
+	if err != nil {
+		return badRequest(err)
+	}
+
+	err = hr.httpService.ResendVerification(c.UserContext(), request)
+	if err != nil {
+		return err
+	}
+
+	c.Status(http.StatusAccepted)
+	return nil
+}
+
+func (hr *httpRepository) deactivateUser(c *fiber.Ctx) error {
+	userID, err := c.ParamsInt("id")
+	if err != nil {
+		return badRequest(errInvalidId)
+	}
+
+	err = hr.httpService.DeactivateUser(c.UserContext(), userClaims(c), int64(userID))
+	if err != nil {
+		return err
+	}
+
+	c.Status(http.StatusNoContent)
+	return nil
+}
+
+func (hr *httpRepository) reactivateUser(c *fiber.Ctx) error {
+	userID, err := c.ParamsInt("id")
+	if err != nil {
+		return badRequest(errInvalidId)
+	}
+
+	err = hr.httpService.ReactivateUser(c.UserContext(), userClaims(c), int64(userID))
+	if err != nil {
+		return err
+	}
+
+	c.Status(http.StatusNoContent)
+	return nil
+}
+
+func (hr *httpRepository) profile(c *fiber.Ctx) error {
+	profile, err := hr.httpService.GetProfile(c.UserContext(), userClaims(c))
+	if err != nil {
+		return err
+	}
+
+	c.Status(http.StatusOK)
+	return c.JSON(profile)
+}
+
+func (hr *httpRepository) updateProfile(c *fiber.Ctx) error {
+	var request UpdateProfileRequest
+
+	err := c.BodyParser(&request)
+	if err != nil {
+		return badRequest(err)
+	}
+
+	profile, err := hr.httpService.UpdateProfile(c.UserContext(), userClaims(c), request)
+	if err != nil {
+		return err
+	}
+
+	c.Status(http.StatusOK)
+	return c.JSON(profile)
+}
+
+func (hr *httpRepository) updateAddress(c *fiber.Ctx) error {
+	var request Address
+
+	err := c.BodyParser(&request)
+	if err != nil {
+		return badRequest(err)
+	}
+
+	profile, err := hr.httpService.UpdateAddress(c.UserContext(), userClaims(c), request)
+	if err != nil {
+		return err
+	}
+
+	c.Status(http.StatusOK)
+	return c.JSON(profile)
+}
+
+func (hr *httpRepository) changePassword(c *fiber.Ctx) error {
+	var request ChangePasswordRequest
+
+	err := c.BodyParser(&request)
+	if err != nil {
+		return badRequest(err)
+	}
+
+	err = hr.httpService.ChangePassword(c.UserContext(), userClaims(c), c.IP(), request)
+	if err != nil {
+		return err
+	}
+
+	c.Status(http.StatusNoContent)
+	return nil
+}
+
+func (hr *httpRepository) changeEmail(c *fiber.Ctx) error {
+	var request ChangeEmailRequest
+
+	err := c.BodyParser(&request)
+	if err != nil {
+		return badRequest(err)
+	}
+
+	err = hr.httpService.ChangeEmail(c.UserContext(), userClaims(c), c.IP(), request)
+	if err != nil {
+		return err
+	}
+
+	c.Status(http.StatusAccepted)
+	return nil
+}
+
+// confirmEmailChangePage is where the link mailed to the new address leads. The page posts the token
+// to confirmEmailChange.
+func (hr *httpRepository) confirmEmailChangePage(c *fiber.Ctx) error {
+	return renderConfirmationPage(c, confirmationPage{
+		Title:  "Confirm your new email address",
+		Action: c.Path(),
+		Token:  c.Query("token"),
+		Button: "Confirm",
+	})
+}
+
+func (hr *httpRepository) confirmEmailChange(c *fiber.Ctx) error {
+	var request VerifyEmailRequest
+
+	err := c.QueryParser(&request)
+	if err != nil {
+		return badRequest(err)
+	}
+	if request.Token == "" {
+		err = c.BodyParser(&request)
+		if err != nil {
+			return badRequest(err)
+		}
+	}
+
+	err = hr.httpService.ConfirmEmailChange(c.UserContext(), request)
+	if err != nil {
+		return err
+	}
+
+	if isFormPost(c) {
+		return renderConfirmationPage(c, confirmationPage{
+			Title: "Email address changed",
+			Text:  "Log in with the new address from now on.",
+		})
+	}
+
+	c.Status(http.StatusNoContent)
+	return nil
+}
+
+func (hr *httpRepository) listUsers(c *fiber.Ctx) error {
+	var query UserListQuery
+
+	err := c.QueryParser(&query)
+	if err != nil {
+		return badRequest(err)
+	}
+
+	users, err := hr.httpService.ListUsers(c.UserContext(), query)
+	if err != nil {
+		return err
+	}
+
+	c.Status(http.StatusOK)
+	return c.JSON(users)
+}
+
+func (hr *httpRepository) getUser(c *fiber.Ctx) error {
+	userID, err := c.ParamsInt("id")
+	if err != nil {
+		return badRequest(errInvalidId)
+	}
+
+	user, err := hr.httpService.GetUser(c.UserContext(), int64(userID))
+	if err != nil {
 		return err
 	}
 
-	_, err = hr.httpService.RegisterUser(user)
+	c.Status(http.StatusOK)
+	return c.JSON(user)
+}
+
+func (hr *httpRepository) setUserJobRole(c *fiber.Ctx) error {
+	var request SetJobRoleRequest
+
+	userID, err := c.ParamsInt("id")
+	if err != nil {
+		return badRequest(errInvalidId)
+	}
+
+	err = c.BodyParser(&request)
+	if err != nil {
+		return badRequest(err)
+	}
+
+	user, err := hr.httpService.SetUserJobRole(c.UserContext(), userClaims(c), int64(userID), request)
 	if err != nil {
-		c.Status(http.StatusBadRequest)
-		c.JSON(err)
 		return err
 	}
 
 	c.Status(http.StatusOK)
-	c.JSON(user)
+	return c.JSON(user)
+}
+
+func (hr *httpRepository) resetUserPassword(c *fiber.Ctx) error {
+	var request AdminResetPasswordRequest
+
+	userID, err := c.ParamsInt("id")
+	if err != nil {
+		return badRequest(errInvalidId)
+	}
+
+	err = c.BodyParser(&request)
+	if err != nil {
+		return badRequest(err)
+	}
+
+	err = hr.httpService.ResetUserPassword(c.UserContext(), userClaims(c), int64(userID), request)
+	if err != nil {
+		return err
+	}
+
+	c.Status(http.StatusNoContent)
+	return nil
+}
+
+func (hr *httpRepository) deleteUser(c *fiber.Ctx) error {
+	userID, err := c.ParamsInt("id")
+	if err != nil {
+		return badRequest(errInvalidId)
+	}
+
+	err = hr.httpService.DeleteUser(c.UserContext(), userClaims(c), int64(userID))
+	if err != nil {
+		return err
+	}
+
+	c.Status(http.StatusNoContent)
+	return nil
+}
+
+func (hr *httpRepository) resetUserMfa(c *fiber.Ctx) error {
+	userID, err := c.ParamsInt("id")
+	if err != nil {
+		return badRequest(errInvalidId)
+	}
+
+	err = hr.httpService.ResetUserMfa(c.UserContext(), userClaims(c), int64(userID))
+	if err != nil {
+		return err
+	}
+
+	c.Status(http.StatusNoContent)
+	return nil
+}
+
+func (hr *httpRepository) mfaStatus(c *fiber.Ctx) error {
+	status, err := hr.httpService.MfaStatus(c.UserContext(), userClaims(c))
+	if err != nil {
+		return err
+	}
+
+	c.Status(http.StatusOK)
+	return c.JSON(status)
+}
+
+func (hr *httpRepository) enrollTotp(c *fiber.Ctx) error {
+	var request MfaPasswordRequest
+
+	err := c.BodyParser(&request)
+	if err != nil {
+		return badRequest(err)
+	}
+
+	enrollment, err := hr.httpService.EnrollTotp(c.UserContext(), userClaims(c), c.IP(), request)
+	if err != nil {
+		return err
+	}
+
+	c.Status(http.StatusCreated)
+	return c.JSON(enrollment)
+}
+
+func (hr *httpRepository) confirmTotp(c *fiber.Ctx) error {
+	var request MfaCodeRequest
+
+	err := c.BodyParser(&request)
+	if err != nil {
+		return badRequest(err)
+	}
+
+	recoveryCodes, err := hr.httpService.ConfirmTotp(c.UserContext(), userClaims(c), request)
+	if err != nil {
+		return err
+	}
+
+	c.Status(http.StatusOK)
+	return c.JSON(recoveryCodes)
+}
+
+func (hr *httpRepository) disableTotp(c *fiber.Ctx) error {
+	var request DisableTotpRequest
+
+	err := c.BodyParser(&request)
+	if err != nil {
+		return badRequest(err)
+	}
+
+	err = hr.httpService.DisableTotp(c.UserContext(), userClaims(c), c.IP(), request)
+	if err != nil {
+		return err
+	}
+
+	c.Status(http.StatusNoContent)
+	return nil
+}
+
+func (hr *httpRepository) regenerateRecoveryCodes(c *fiber.Ctx) error {
+	var request MfaPasswordRequest
+
+	err := c.BodyParser(&request)
+	if err != nil {
+		return badRequest(err)
+	}
+
+	recoveryCodes, err := hr.httpService.RegenerateRecoveryCodes(c.UserContext(), userClaims(c), c.IP(), request)
+	if err != nil {
+		return err
+	}
+
+	c.Status(http.StatusOK)
+	return c.JSON(recoveryCodes)
+}
+
+func (hr *httpRepository) sessions(c *fiber.Ctx) error {
+	sessions, err := hr.httpService.ListSessions(c.UserContext(), userClaims(c))
+	if err != nil {
+		return err
+	}
+
+	c.Status(http.StatusOK)
+	return c.JSON(sessions)
+}
+
+func (hr *httpRepository) revokeSession(c *fiber.Ctx) error {
+	err := hr.httpService.RevokeSession(c.UserContext(), userClaims(c), c.Params("id"))
+	if err != nil {
+		return err
+	}
+
+	c.Status(http.StatusNoContent)
+	return nil
+}
+
+func (hr *httpRepository) revokeOtherSessions(c *fiber.Ctx) error {
+	err := hr.httpService.RevokeOtherSessions(c.UserContext(), userClaims(c))
+	if err != nil {
+		return err
+	}
+
+	c.Status(http.StatusNoContent)
+	return nil
+}
+
+func (hr *httpRepository) userSessions(c *fiber.Ctx) error {
+	userID, err := c.ParamsInt("id")
+	if err != nil {
+		return badRequest(errInvalidId)
+	}
+
+	sessions, err := hr.httpService.ListUserSessions(c.UserContext(), int64(userID))
+	if err != nil {
+		return err
+	}
+
+	c.Status(http.StatusOK)
+	return c.JSON(sessions)
+}
+
+func (hr *httpRepository) revokeUserSessions(c *fiber.Ctx) error {
+	userID, err := c.ParamsInt("id")
+	if err != nil {
+		return badRequest(errInvalidId)
+	}
+
+	err = hr.httpService.RevokeUserSessions(c.UserContext(), userClaims(c), int64(userID))
+	if err != nil {
+		return err
+	}
+
+	c.Status(http.StatusNoContent)
+	return nil
+}
+
+func (hr *httpRepository) revokeUserSession(c *fiber.Ctx) error {
+	userID, err := c.ParamsInt("id")
+	if err != nil {
+		return badRequest(errInvalidId)
+	}
+
+	err = hr.httpService.RevokeUserSession(c.UserContext(), userClaims(c), int64(userID), c.Params("sessionId"))
+	if err != nil {
+		return err
+	}
+
+	c.Status(http.StatusNoContent)
+	return nil
+}
+
+func (hr *httpRepository) beginPasskeyLogin(c *fiber.Ctx) error {
+	var request PasskeyLoginRequest
+
+	err := c.BodyParser(&request)
+	if err != nil {
+		return badRequest(err)
+	}
+
+	ceremony, err := hr.httpService.BeginPasskeyLogin(c.UserContext(), request, c.IP())
+	if err != nil {
+		return err
+	}
+
+	c.Status(http.StatusOK)
+	return c.JSON(ceremony)
+}
+
+func (hr *httpRepository) finishPasskeyLogin(c *fiber.Ctx) error {
+	var request FinishPasskeyLoginRequest
+
+	err := c.BodyParser(&request)
+	if err != nil {
+		return badRequest(err)
+	}
+
+	token, err := hr.httpService.FinishPasskeyLogin(c.UserContext(), request, c.IP(), c.Get(fiber.HeaderUserAgent))
+	if err != nil {
+		return err
+	}
+
+	c.Status(http.StatusOK)
+	return c.JSON(token)
+}
+
+func (hr *httpRepository) passkeys(c *fiber.Ctx) error {
+	passkeys, err := hr.httpService.ListPasskeys(c.UserContext(), userClaims(c))
+	if err != nil {
+		return err
+	}
+
+	c.Status(http.StatusOK)
+	return c.JSON(passkeys)
+}
+
+func (hr *httpRepository) beginPasskeyRegistration(c *fiber.Ctx) error {
+	var request PasskeyRegistrationRequest
+
+	err := c.BodyParser(&request)
+	if err != nil {
+		return badRequest(err)
+	}
+
+	ceremony, err := hr.httpService.BeginPasskeyRegistration(c.UserContext(), userClaims(c), c.IP(), request)
+	if err != nil {
+		return err
+	}
+
+	c.Status(http.StatusOK)
+	return c.JSON(ceremony)
+}
+
+func (hr *httpRepository) finishPasskeyRegistration(c *fiber.Ctx) error {
+	var request FinishPasskeyRegistrationRequest
+
+	err := c.BodyParser(&request)
+	if err != nil {
+		return badRequest(err)
+	}
+
+	passkey, err := hr.httpService.FinishPasskeyRegistration(c.UserContext(), userClaims(c), request)
+	if err != nil {
+		return err
+	}
+
+	c.Status(http.StatusCreated)
+	return c.JSON(passkey)
+}
+
+func (hr *httpRepository) deletePasskey(c *fiber.Ctx) error {
+	var request DeletePasskeyRequest
+
+	passkeyID, err := c.ParamsInt("id")
+	if err != nil {
+		return badRequest(errInvalidId)
+	}
+
+	err = c.BodyParser(&request)
+	if err != nil {
+		return badRequest(err)
+	}
+
+	err = hr.httpService.DeletePasskey(c.UserContext(), userClaims(c), c.IP(), int64(passkeyID), request)
+	if err != nil {
+		return err
+	}
+
+	c.Status(http.StatusNoContent)
+	return nil
+}
+
+// jobRoles lists the job roles that can be chosen. Under /admin retired job roles are listed as well.
+func (hr *httpRepository) jobRoles(c *fiber.Ctx) error {
+	jobRoles, err := hr.httpService.ListJobRoles(c.UserContext(), userClaims(c) != nil)
+	if err != nil {
+		return err
+	}
+
+	c.Status(http.StatusOK)
+	return c.JSON(jobRoles)
+}
+
+func (hr *httpRepository) createJobRole(c *fiber.Ctx) error {
+	var request CreateJobRoleRequest
+
+	err := c.BodyParser(&request)
+	if err != nil {
+		return badRequest(err)
+	}
+
+	jobRole, err := hr.httpService.CreateJobRole(c.UserContext(), userClaims(c), request)
+	if err != nil {
+		return err
+	}
+
+	c.Status(http.StatusCreated)
+	return c.JSON(jobRole)
+}
+
+func (hr *httpRepository) renameJobRole(c *fiber.Ctx) error {
+	var request ReferenceNameRequest
+
+	jobRoleID, err := c.ParamsInt("id")
+	if err != nil {
+		return badRequest(errInvalidId)
+	}
+
+	err = c.BodyParser(&request)
+	if err != nil {
+		return badRequest(err)
+	}
+
+	jobRole, err := hr.httpService.RenameJobRole(c.UserContext(), userClaims(c), jobRoleID, request)
+	if err != nil {
+		return err
+	}
+
+	c.Status(http.StatusOK)
+	return c.JSON(jobRole)
+}
+
+func (hr *httpRepository) retireJobRole(c *fiber.Ctx) error {
+	jobRoleID, err := c.ParamsInt("id")
+	if err != nil {
+		return badRequest(errInvalidId)
+	}
+
+	err = hr.httpService.RetireJobRole(c.UserContext(), userClaims(c), jobRoleID)
+	if err != nil {
+		return err
+	}
+
+	c.Status(http.StatusNoContent)
+	return nil
+}
+
+// settlementTypes lists the settlement types that can be chosen. Under /admin retired ones are listed as well.
+func (hr *httpRepository) settlementTypes(c *fiber.Ctx) error {
+	settlementTypes, err := hr.httpService.ListSettlementTypes(c.UserContext(), userClaims(c) != nil)
+	if err != nil {
+		return err
+	}
+
+	c.Status(http.StatusOK)
+	return c.JSON(settlementTypes)
+}
+
+func (hr *httpRepository) createSettlementType(c *fiber.Ctx) error {
+	var request ReferenceNameRequest
+
+	err := c.BodyParser(&request)
+	if err != nil {
+		return badRequest(err)
+	}
+
+	settlementType, err := hr.httpService.CreateSettlementType(c.UserContext(), userClaims(c), request)
+	if err != nil {
+		return err
+	}
+
+	c.Status(http.StatusCreated)
+	return c.JSON(settlementType)
+}
+
+func (hr *httpRepository) renameSettlementType(c *fiber.Ctx) error {
+	var request ReferenceNameRequest
+
+	settlementTypeID, err := c.ParamsInt("id")
+	if err != nil {
+		return badRequest(errInvalidId)
+	}
+
+	err = c.BodyParser(&request)
+	if err != nil {
+		return badRequest(err)
+	}
+
+	settlementType, err := hr.httpService.RenameSettlementType(c.UserContext(), userClaims(c), settlementTypeID, request)
+	if err != nil {
+		return err
+	}
+
+	c.Status(http.StatusOK)
+	return c.JSON(settlementType)
+}
+
+func (hr *httpRepository) retireSettlementType(c *fiber.Ctx) error {
+	settlementTypeID, err := c.ParamsInt("id")
+	if err != nil {
+		return badRequest(errInvalidId)
+	}
+
+	err = hr.httpService.RetireSettlementType(c.UserContext(), userClaims(c), settlementTypeID)
+	if err != nil {
+		return err
+	}
+
+	c.Status(http.StatusNoContent)
 	return nil
 }
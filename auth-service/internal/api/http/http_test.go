@@ -0,0 +1,702 @@
+package http
+
+import (
+	"auth/config"
+	"auth/internal/auth"
+	"auth/internal/mail"
+	"auth/internal/passkey"
+	"auth/internal/store"
+	"auth/internal/throttle"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	testPassword     = "correct horse battery"
+	clientJobRoleId  = 3
+	adminJobRoleId   = 1
+	testUserAgent    = "test-agent"
+	testWebAuthnHost = "localhost"
+	testClientId     = "rtsp-streamer"
+	testClientSecret = "client-secret"
+)
+
+// recordingMailer keeps the sent messages, so tests can follow the links in them.
+type recordingMailer struct {
+	mu       sync.Mutex
+	messages []mail.Message
+}
+
+func (rm *recordingMailer) Send(ctx context.Context, message mail.Message) error {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	rm.messages = append(rm.messages, message)
+	return nil
+}
+
+// lastToken returns the token of the last link mailed to the address.
+func (rm *recordingMailer) lastToken(t *testing.T, to string) string {
+	t.Helper()
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	for i := len(rm.messages) - 1; i >= 0; i-- {
+		if rm.messages[i].To != to {
+			continue
+		}
+
+		_, token, ok := strings.Cut(rm.messages[i].Body, "token=")
+		if !ok {
+			t.Fatalf("mail to %s has no token: %q", to, rm.messages[i].Body)
+		}
+		return strings.Fields(token)[0]
+	}
+
+	t.Fatalf("no mail sent to %s", to)
+	return ""
+}
+
+type testServer struct {
+	t      *testing.T
+	app    *fiber.App
+	store  *store.MemoryStore
+	mailer *recordingMailer
+}
+
+// newTestServer wires the service like main does, on top of the in-memory store. The configure
+// functions can change the auth config before it is used.
+func newTestServer(t *testing.T, configure ...func(authConfig *config.AuthConfig)) *testServer {
+	t.Helper()
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	authConfig := config.AuthConfig{
+		SecretKey:                  "test-secret",
+		AccessTokenTTL:             15 * time.Minute,
+		RefreshTokenTTL:            time.Hour,
+		DenylistSync:               time.Minute,
+		IntrospectionClients:       []string{testClientId + ":" + testClientSecret},
+		PasswordResetTTL:           time.Hour,
+		EmailVerificationTTL:       time.Hour,
+		RequireVerifiedEmail:       true,
+		VerificationResendInterval: time.Minute,
+		LoginFreeAttempts:          3,
+		LoginIPFreeAttempts:        20,
+		LoginBackoffBase:           time.Second,
+		LoginBackoffMax:            time.Minute,
+		LoginLockoutAttempts:       10,
+		LoginLockoutDuration:       15 * time.Minute,
+		LoginAttemptWindow:         time.Hour,
+		TotpIssuer:                 "auth-service",
+		MfaChallengeTTL:            5 * time.Minute,
+	}
+	for _, fn := range configure {
+		fn(&authConfig)
+	}
+	// app.Test connects from 0.0.0.0, which plays the reverse proxy
+	httpConfig := config.HttpConfig{ContextTimeout: 5000, ProxyHeader: fiber.HeaderXForwardedFor, TrustedProxies: []string{"0.0.0.0"}}
+	mailConfig := config.MailConfig{}
+	webAuthnConfig := config.WebAuthnConfig{
+		RPID:          testWebAuthnHost,
+		RPDisplayName: "auth-service",
+		RPOrigins:     []string{"http://" + testWebAuthnHost + ":8080"},
+		SessionTTL:    5 * time.Minute,
+	}
+
+	keySet, err := auth.LoadKeySet(&authConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	passkeyService, err := passkey.NewPasskeyService(&webAuthnConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mailer := &recordingMailer{}
+	storeService := store.NewMemoryStore(logger)
+	authService := auth.NewAuthService(&authConfig, keySet, storeService, logger)
+	httpService := NewHttpService(authService, storeService, throttle.NewLoginThrottle(&authConfig, logger),
+		throttle.NewMailThrottle(authConfig.VerificationResendInterval), passkeyService, mailer, &mailConfig, logger)
+	authRepository := NewAuthRepository(httpService, &httpConfig, logger)
+
+	app := fiber.New(fiber.Config{
+		ProxyHeader:             httpConfig.ProxyHeader,
+		EnableTrustedProxyCheck: true,
+		TrustedProxies:          httpConfig.TrustedProxies,
+		EnableIPValidation:      true,
+		ErrorHandler:            authRepository.ErrorHandler,
+		Immutable:               true,
+	})
+	authRepository.RegisterRouts(app)
+
+	return &testServer{t: t, app: app, store: storeService, mailer: mailer}
+}
+
+// do sends body as JSON and decodes the response into out, if given. It returns the status code.
+func (ts *testServer) do(method, path, accessToken string, body, out any) int {
+	ts.t.Helper()
+
+	return ts.send(method, path, func(req *http.Request) {
+		if accessToken != "" {
+			req.Header.Set(fiber.HeaderAuthorization, "Bearer "+accessToken)
+		}
+	}, body, out)
+}
+
+// doClient is do for the endpoints of resource servers, authenticated with client credentials.
+func (ts *testServer) doClient(method, path, clientSecret string, body, out any) int {
+	ts.t.Helper()
+
+	return ts.send(method, path, func(req *http.Request) {
+		req.SetBasicAuth(testClientId, clientSecret)
+	}, body, out)
+}
+
+func (ts *testServer) send(method, path string, authorize func(req *http.Request), body, out any) int {
+	ts.t.Helper()
+
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			ts.t.Fatal(err)
+		}
+		reader = bytes.NewReader(encoded)
+	}
+
+	req := httptest.NewRequest(method, path, reader)
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	req.Header.Set(fiber.HeaderUserAgent, testUserAgent)
+	authorize(req)
+
+	resp, err := ts.app.Test(req, -1)
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if out != nil {
+		err = json.NewDecoder(resp.Body).Decode(out)
+		if err != nil {
+			ts.t.Fatalf("%s %s: decoding %d response: %v", method, path, resp.StatusCode, err)
+		}
+	}
+
+	return resp.StatusCode
+}
+
+// page opens a mailed link, or posts its form, like a browser and returns the status and the HTML.
+func (ts *testServer) page(method, link string, form url.Values) (int, string) {
+	ts.t.Helper()
+
+	var req *http.Request
+	if form != nil {
+		req = httptest.NewRequest(method, link, strings.NewReader(form.Encode()))
+		req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationForm)
+	} else {
+		req = httptest.NewRequest(method, link, nil)
+	}
+
+	resp, err := ts.app.Test(req, -1)
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+
+	return resp.StatusCode, string(body)
+}
+
+func (ts *testServer) expect(wantStatus int, method, path, accessToken string, body, out any) {
+	ts.t.Helper()
+
+	status := ts.do(method, path, accessToken, body, out)
+	if status != wantStatus {
+		ts.t.Fatalf("%s %s: got status %d, want %d", method, path, status, wantStatus)
+	}
+}
+
+func registerRequest(email string, jobRoleId int) RegisterUserRequest {
+	birthday := time.Date(1990, 1, 1, 0, 0, 0, 0, time.UTC).Unix()
+	return RegisterUserRequest{
+		JobRoleId: jobRoleId,
+		Name:      "Ivan",
+		Surname:   "Ivanov",
+		Email:     email,
+		Password:  testPassword,
+		Birthday:  &birthday,
+	}
+}
+
+// registerVerified registers a client and confirms the email with the mailed link.
+func (ts *testServer) registerVerified(email string) *ProfileResponse {
+	ts.t.Helper()
+
+	var profile ProfileResponse
+	ts.expect(http.StatusOK, fiber.MethodPost, "/register", "", registerRequest(email, clientJobRoleId), &profile)
+	ts.expect(http.StatusNoContent, fiber.MethodPost, "/verify-email", "", VerifyEmailRequest{Token: ts.mailer.lastToken(ts.t, email)}, nil)
+
+	return &profile
+}
+
+// registerAdmin registers a user and gives it an admin job role directly in the store, the way
+// admins are set up outside of the API.
+func (ts *testServer) registerAdmin(email string) *ProfileResponse {
+	ts.t.Helper()
+
+	profile := ts.registerVerified(email)
+	err := ts.store.SetUserJobRole(context.Background(), profile.Id, adminJobRoleId)
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+
+	return profile
+}
+
+func (ts *testServer) login(email string) *auth.Token {
+	ts.t.Helper()
+
+	var token auth.Token
+	ts.expect(http.StatusOK, fiber.MethodPost, "/login", "", LogiinUserRequest{Email: email, Password: testPassword}, &token)
+	if token.Access == "" || token.Refresh == "" {
+		ts.t.Fatalf("login returned incomplete token %+v", token)
+	}
+
+	return &token
+}
+
+func TestRegister(t *testing.T) {
+	ts := newTestServer(t)
+
+	var body map[string]any
+	ts.expect(http.StatusOK, fiber.MethodPost, "/register", "", registerRequest("ivan@example.com", clientJobRoleId), &body)
+	if body["email"] != "ivan@example.com" || body["id"] == nil {
+		t.Fatalf("unexpected registration response %v", body)
+	}
+	for key, value := range body {
+		if strings.EqualFold(key, "password") || value == testPassword {
+			t.Fatalf("registration response contains the password: %v", body)
+		}
+	}
+
+	ts.expect(http.StatusConflict, fiber.MethodPost, "/register", "", registerRequest("ivan@example.com", clientJobRoleId), nil)
+
+	var errResponse ErrorResponse
+	ts.expect(http.StatusUnprocessableEntity, fiber.MethodPost, "/register", "", registerRequest("admin@example.com", adminJobRoleId), &errResponse)
+	if len(errResponse.Error.Fields) != 1 || errResponse.Error.Fields[0].Field != "job_role_id" {
+		t.Fatalf("unexpected error %+v for an admin job role", errResponse.Error)
+	}
+}
+
+func TestRegisterValidation(t *testing.T) {
+	ts := newTestServer(t)
+
+	noBirthday := registerRequest("ivan@example.com", clientJobRoleId)
+	noBirthday.Birthday = nil
+	invalid := RegisterUserRequest{
+		Email:    "ivan",
+		Password: "short",
+		Address:  &Address{Country: strings.Repeat("c", maxFieldLength+1)},
+	}
+
+	tests := []struct {
+		name       string
+		request    RegisterUserRequest
+		wantFields map[string]string
+	}{
+		{
+			name:       "missing birthday",
+			request:    noBirthday,
+			wantFields: map[string]string{"birthday": errRequired.Error()},
+		},
+		{
+			name:    "invalid fields",
+			request: invalid,
+			wantFields: map[string]string{
+				"job_role_id":                errInvalidJobRole.Error(),
+				"name":                       errRequired.Error(),
+				"surname":                    errRequired.Error(),
+				"email":                      errInvalidEmail.Error(),
+				"password":                   errPasswordTooShort.Error(),
+				"birthday":                   errRequired.Error(),
+				"address.settlement_type_id": errInvalidSettlement.Error(),
+				"address.country":            errFieldTooLong.Error(),
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var errResponse ErrorResponse
+			ts.expect(http.StatusUnprocessableEntity, fiber.MethodPost, "/register", "", tt.request, &errResponse)
+
+			fields := make(map[string]string)
+			for _, field := range errResponse.Error.Fields {
+				fields[field.Field] = field.Message
+			}
+			if len(fields) != len(tt.wantFields) {
+				t.Fatalf("got fields %v, want %v", fields, tt.wantFields)
+			}
+			for field, message := range tt.wantFields {
+				if fields[field] != message {
+					t.Errorf("got %q for %s, want %q", fields[field], field, message)
+				}
+			}
+		})
+	}
+
+	// the birthday may be given as a date instead
+	withDate := noBirthday
+	withDate.BirthdayDate = time.Date(1990, 1, 1, 0, 0, 0, 0, time.UTC)
+	var profile ProfileResponse
+	ts.expect(http.StatusOK, fiber.MethodPost, "/register", "", withDate, &profile)
+	if profile.Birthday != withDate.BirthdayDate.Unix() {
+		t.Fatalf("got birthday %d", profile.Birthday)
+	}
+}
+
+func TestLogin(t *testing.T) {
+	ts := newTestServer(t)
+
+	ts.expect(http.StatusOK, fiber.MethodPost, "/register", "", registerRequest("ivan@example.com", clientJobRoleId), nil)
+	ts.expect(http.StatusForbidden, fiber.MethodPost, "/login", "", LogiinUserRequest{Email: "ivan@example.com", Password: testPassword}, nil)
+
+	ts.expect(http.StatusNoContent, fiber.MethodPost, "/verify-email", "", VerifyEmailRequest{Token: ts.mailer.lastToken(t, "ivan@example.com")}, nil)
+	ts.expect(http.StatusUnauthorized, fiber.MethodPost, "/login", "", LogiinUserRequest{Email: "ivan@example.com", Password: "wrong password"}, nil)
+	ts.expect(http.StatusUnauthorized, fiber.MethodPost, "/login", "", LogiinUserRequest{Email: "nobody@example.com", Password: testPassword}, nil)
+
+	token := ts.login("ivan@example.com")
+
+	var profile ProfileResponse
+	ts.expect(http.StatusOK, fiber.MethodGet, "/me", token.Access, nil, &profile)
+	if profile.Email != "ivan@example.com" || profile.JobRole == nil || profile.JobRole.Role != store.RoleClient {
+		t.Fatalf("unexpected profile %+v", profile)
+	}
+
+	ts.expect(http.StatusNoContent, fiber.MethodPost, "/logout", token.Access, nil, nil)
+	ts.expect(http.StatusUnauthorized, fiber.MethodGet, "/me", token.Access, nil, nil)
+}
+
+func TestRefresh(t *testing.T) {
+	ts := newTestServer(t)
+	ts.registerVerified("ivan@example.com")
+	token := ts.login("ivan@example.com")
+
+	var refreshed auth.Token
+	ts.expect(http.StatusOK, fiber.MethodPost, "/refresh", "", token, &refreshed)
+	if refreshed.Refresh == token.Refresh || refreshed.Access == token.Access {
+		t.Fatal("refresh did not rotate the tokens")
+	}
+	ts.expect(http.StatusOK, fiber.MethodGet, "/me", refreshed.Access, nil, nil)
+
+	var again auth.Token
+	ts.expect(http.StatusOK, fiber.MethodPost, "/refresh", "", refreshed, &again)
+
+	mixed := auth.Token{Access: token.Access, Refresh: again.Refresh}
+	ts.expect(http.StatusUnauthorized, fiber.MethodPost, "/refresh", "", mixed, nil)
+}
+
+func TestRefreshReuseRevokesFamily(t *testing.T) {
+	ts := newTestServer(t)
+	ts.registerVerified("ivan@example.com")
+	token := ts.login("ivan@example.com")
+	other := ts.login("ivan@example.com")
+
+	var refreshed auth.Token
+	ts.expect(http.StatusOK, fiber.MethodPost, "/refresh", "", token, &refreshed)
+
+	var errResponse ErrorResponse
+	ts.expect(http.StatusUnauthorized, fiber.MethodPost, "/refresh", "", token, &errResponse)
+	if errResponse.Error.Message != auth.ErrRefreshTokenReused.Error() {
+		t.Fatalf("unexpected error %q for a reused refresh token", errResponse.Error.Message)
+	}
+
+	ts.expect(http.StatusUnauthorized, fiber.MethodPost, "/refresh", "", refreshed, nil)
+
+	// other token families of the user are not affected
+	ts.expect(http.StatusOK, fiber.MethodGet, "/me", other.Access, nil, nil)
+	ts.expect(http.StatusOK, fiber.MethodPost, "/refresh", "", other, nil)
+}
+
+func TestRecordUserHistory(t *testing.T) {
+	ts := newTestServer(t)
+	profile := ts.registerVerified("ivan@example.com")
+	historyPath := fmt.Sprintf("/users/%d/history", profile.Id)
+
+	request := VideoHistoryRequest{VideoName: "users/1/video.mp4"}
+	if status := ts.doClient(fiber.MethodPost, historyPath, "wrong secret", request, nil); status != http.StatusUnauthorized {
+		t.Fatalf("got status %d with a wrong client secret", status)
+	}
+	if status := ts.doClient(fiber.MethodPost, "/users/1000/history", testClientSecret, request, nil); status != http.StatusNotFound {
+		t.Fatalf("got status %d for an unknown user", status)
+	}
+	tooLong := VideoHistoryRequest{VideoName: strings.Repeat("v", maxFieldLength+1)}
+	if status := ts.doClient(fiber.MethodPost, historyPath, testClientSecret, tooLong, nil); status != http.StatusUnprocessableEntity {
+		t.Fatalf("got status %d for a too long video name", status)
+	}
+	if status := ts.doClient(fiber.MethodPost, historyPath, testClientSecret, request, nil); status != http.StatusCreated {
+		t.Fatalf("got status %d recording history", status)
+	}
+
+	var history VideoHistoryResponse
+	ts.expect(http.StatusOK, fiber.MethodGet, "/history", ts.login("ivan@example.com").Access, nil, &history)
+	if history.Total != 1 || history.Items[0].VideoName != request.VideoName || history.Items[0].Event != store.VideoEventStream {
+		t.Fatalf("unexpected history %+v", history)
+	}
+}
+
+func TestLogout(t *testing.T) {
+	ts := newTestServer(t)
+	ts.registerVerified("ivan@example.com")
+	token := ts.login("ivan@example.com")
+	other := ts.login("ivan@example.com")
+
+	ts.expect(http.StatusNoContent, fiber.MethodPost, "/logout", token.Access, nil, nil)
+	ts.expect(http.StatusUnauthorized, fiber.MethodGet, "/me", token.Access, nil, nil)
+	ts.expect(http.StatusUnauthorized, fiber.MethodPost, "/logout", token.Access, nil, nil)
+	ts.expect(http.StatusUnauthorized, fiber.MethodPost, "/refresh", "", token, nil)
+
+	// resource servers see the revoked token as inactive
+	var introspection IntrospectionResponse
+	status := ts.doClient(fiber.MethodPost, "/introspect", testClientSecret, IntrospectionRequest{Token: token.Access}, &introspection)
+	if status != http.StatusOK || introspection.Active {
+		t.Fatalf("got status %d and %+v introspecting a revoked token", status, introspection)
+	}
+
+	// the other session is still logged in until logout-all
+	ts.expect(http.StatusOK, fiber.MethodGet, "/me", other.Access, nil, nil)
+	third := ts.login("ivan@example.com")
+	ts.expect(http.StatusNoContent, fiber.MethodPost, "/logout-all", third.Access, nil, nil)
+	for _, revoked := range []*auth.Token{other, third} {
+		ts.expect(http.StatusUnauthorized, fiber.MethodGet, "/me", revoked.Access, nil, nil)
+		ts.expect(http.StatusUnauthorized, fiber.MethodPost, "/refresh", "", revoked, nil)
+	}
+}
+
+func TestPasswordReset(t *testing.T) {
+	ts := newTestServer(t)
+	ts.registerVerified("ivan@example.com")
+	token := ts.login("ivan@example.com")
+
+	ts.expect(http.StatusAccepted, fiber.MethodPost, "/password/forgot", "", ForgotPasswordRequest{Email: "ivan@example.com"}, nil)
+	resetToken := ts.mailer.lastToken(t, "ivan@example.com")
+
+	ts.expect(http.StatusUnprocessableEntity, fiber.MethodPost, "/password/reset", "", ResetPasswordRequest{Token: resetToken, Password: "short"}, nil)
+	ts.expect(http.StatusNoContent, fiber.MethodPost, "/password/reset", "", ResetPasswordRequest{Token: resetToken, Password: "new correct horse"}, nil)
+
+	// the reset logs out every session
+	ts.expect(http.StatusUnauthorized, fiber.MethodGet, "/me", token.Access, nil, nil)
+	ts.expect(http.StatusUnauthorized, fiber.MethodPost, "/refresh", "", token, nil)
+
+	// the token is single-use
+	ts.expect(http.StatusBadRequest, fiber.MethodPost, "/password/reset", "", ResetPasswordRequest{Token: resetToken, Password: "another correct horse"}, nil)
+
+	ts.expect(http.StatusUnauthorized, fiber.MethodPost, "/login", "", LogiinUserRequest{Email: "ivan@example.com", Password: testPassword}, nil)
+	ts.expect(http.StatusOK, fiber.MethodPost, "/login", "", LogiinUserRequest{Email: "ivan@example.com", Password: "new correct horse"}, nil)
+}
+
+func TestPasswordResetExpired(t *testing.T) {
+	ts := newTestServer(t, func(authConfig *config.AuthConfig) {
+		// reset tokens expire in the second they are issued
+		authConfig.PasswordResetTTL = 0
+	})
+	ts.registerVerified("ivan@example.com")
+
+	ts.expect(http.StatusAccepted, fiber.MethodPost, "/password/forgot", "", ForgotPasswordRequest{Email: "ivan@example.com"}, nil)
+	resetToken := ts.mailer.lastToken(t, "ivan@example.com")
+	ts.expect(http.StatusBadRequest, fiber.MethodPost, "/password/reset", "", ResetPasswordRequest{Token: resetToken, Password: "new correct horse"}, nil)
+
+	ts.login("ivan@example.com")
+}
+
+func TestEmailVerification(t *testing.T) {
+	ts := newTestServer(t)
+	ts.expect(http.StatusOK, fiber.MethodPost, "/register", "", registerRequest("ivan@example.com", clientJobRoleId), nil)
+	verificationToken := ts.mailer.lastToken(t, "ivan@example.com")
+
+	var errResponse ErrorResponse
+	ts.expect(http.StatusForbidden, fiber.MethodPost, "/login", "", LogiinUserRequest{Email: "ivan@example.com", Password: testPassword}, &errResponse)
+	if errResponse.Error.Message != auth.ErrEmailNotVerified.Error() {
+		t.Fatalf("unexpected error %q for an unverified email", errResponse.Error.Message)
+	}
+
+	// resending is throttled the same way for unknown addresses
+	ts.expect(http.StatusAccepted, fiber.MethodPost, "/verify-email/resend", "", ResendVerificationRequest{Email: "ivan@example.com"}, nil)
+	ts.expect(http.StatusTooManyRequests, fiber.MethodPost, "/verify-email/resend", "", ResendVerificationRequest{Email: "ivan@example.com"}, nil)
+	ts.expect(http.StatusAccepted, fiber.MethodPost, "/verify-email/resend", "", ResendVerificationRequest{Email: "nobody@example.com"}, nil)
+	ts.expect(http.StatusTooManyRequests, fiber.MethodPost, "/verify-email/resend", "", ResendVerificationRequest{Email: "nobody@example.com"}, nil)
+
+	ts.expect(http.StatusBadRequest, fiber.MethodPost, "/verify-email", "", VerifyEmailRequest{Token: "unknown"}, nil)
+	ts.expect(http.StatusForbidden, fiber.MethodPost, "/login", "", LogiinUserRequest{Email: "ivan@example.com", Password: testPassword}, nil)
+
+	ts.expect(http.StatusNoContent, fiber.MethodPost, "/verify-email", "", VerifyEmailRequest{Token: verificationToken}, nil)
+	ts.expect(http.StatusBadRequest, fiber.MethodPost, "/verify-email", "", VerifyEmailRequest{Token: verificationToken}, nil)
+	ts.login("ivan@example.com")
+}
+
+func TestAdminRequired(t *testing.T) {
+	ts := newTestServer(t)
+	client := ts.registerVerified("ivan@example.com")
+	ts.registerAdmin("admin@example.com")
+	clientToken := ts.login("ivan@example.com")
+	adminToken := ts.login("admin@example.com")
+
+	userPath := fmt.Sprintf("/admin/users/%d", client.Id)
+	for _, path := range []string{"/admin/users", userPath, "/admin/job-roles"} {
+		ts.expect(http.StatusUnauthorized, fiber.MethodGet, path, "", nil, nil)
+		ts.expect(http.StatusForbidden, fiber.MethodGet, path, clientToken.Access, nil, nil)
+		ts.expect(http.StatusOK, fiber.MethodGet, path, adminToken.Access, nil, nil)
+	}
+	ts.expect(http.StatusForbidden, fiber.MethodPut, userPath+"/job-role", clientToken.Access, SetJobRoleRequest{JobRoleId: adminJobRoleId}, nil)
+
+	var users UserListResponse
+	ts.expect(http.StatusOK, fiber.MethodGet, "/admin/users", adminToken.Access, nil, &users)
+	if users.Total != 2 {
+		t.Fatalf("got %d users, want 2", users.Total)
+	}
+
+	// the forbidden request did not promote the client
+	var profile ProfileResponse
+	ts.expect(http.StatusOK, fiber.MethodGet, userPath, adminToken.Access, nil, &profile)
+	if profile.JobRole == nil || profile.JobRole.Role != store.RoleClient {
+		t.Fatalf("unexpected profile %+v", profile)
+	}
+}
+
+func TestDeactivateUser(t *testing.T) {
+	ts := newTestServer(t)
+	client := ts.registerVerified("ivan@example.com")
+	admin := ts.registerAdmin("admin@example.com")
+	token := ts.login("ivan@example.com")
+	adminToken := ts.login("admin@example.com")
+
+	ts.expect(http.StatusForbidden, fiber.MethodPost, fmt.Sprintf("/admin/users/%d/deactivate", admin.Id), adminToken.Access, nil, nil)
+	ts.expect(http.StatusNoContent, fiber.MethodPost, fmt.Sprintf("/admin/users/%d/deactivate", client.Id), adminToken.Access, nil, nil)
+
+	// the tokens issued before are revoked and no new ones are issued
+	ts.expect(http.StatusUnauthorized, fiber.MethodGet, "/me", token.Access, nil, nil)
+	ts.expect(http.StatusUnauthorized, fiber.MethodPost, "/refresh", "", token, nil)
+	var errResponse ErrorResponse
+	ts.expect(http.StatusForbidden, fiber.MethodPost, "/login", "", LogiinUserRequest{Email: "ivan@example.com", Password: testPassword}, &errResponse)
+	if errResponse.Error.Message != auth.ErrUserDeactivated.Error() {
+		t.Fatalf("unexpected error %q for a deactivated user", errResponse.Error.Message)
+	}
+
+	ts.expect(http.StatusNoContent, fiber.MethodPost, fmt.Sprintf("/admin/users/%d/reactivate", client.Id), adminToken.Access, nil, nil)
+	ts.expect(http.StatusUnauthorized, fiber.MethodPost, "/refresh", "", token, nil)
+	ts.login("ivan@example.com")
+}
+
+func TestDeactivatedUserCannotRefresh(t *testing.T) {
+	ts := newTestServer(t)
+	client := ts.registerVerified("ivan@example.com")
+	token := ts.login("ivan@example.com")
+
+	// deactivated without revoking the tokens, e.g. directly in the database
+	err := ts.store.SetUserActive(context.Background(), client.Id, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts.expect(http.StatusForbidden, fiber.MethodPost, "/refresh", "", token, nil)
+}
+
+func TestDuplicateConflict(t *testing.T) {
+	ts := newTestServer(t)
+	ts.registerAdmin("admin@example.com")
+	adminToken := ts.login("admin@example.com")
+
+	jobRole := CreateJobRoleRequest{Name: "support", Role: store.RoleClient}
+	ts.expect(http.StatusCreated, fiber.MethodPost, "/admin/job-roles", adminToken.Access, jobRole, nil)
+
+	var errResponse ErrorResponse
+	ts.expect(http.StatusConflict, fiber.MethodPost, "/admin/job-roles", adminToken.Access, jobRole, &errResponse)
+	if strings.Contains(errResponse.Error.Message, "_key") {
+		t.Fatalf("conflict names the constraint: %q", errResponse.Error.Message)
+	}
+	if len(errResponse.Error.Fields) != 1 || errResponse.Error.Fields[0] != (FieldError{Field: "name", Message: "already exists"}) {
+		t.Fatalf("unexpected conflict %+v", errResponse.Error)
+	}
+}
+
+func TestEmailCase(t *testing.T) {
+	ts := newTestServer(t)
+
+	var profile ProfileResponse
+	ts.expect(http.StatusOK, fiber.MethodPost, "/register", "", registerRequest("Ivan@Example.com", clientJobRoleId), &profile)
+	if profile.Email != "ivan@example.com" {
+		t.Fatalf("registered email %q is not lowercased", profile.Email)
+	}
+	ts.expect(http.StatusNoContent, fiber.MethodPost, "/verify-email", "", VerifyEmailRequest{Token: ts.mailer.lastToken(t, "ivan@example.com")}, nil)
+
+	ts.expect(http.StatusOK, fiber.MethodPost, "/login", "", LogiinUserRequest{Email: "IVAN@example.com", Password: testPassword}, nil)
+	ts.expect(http.StatusConflict, fiber.MethodPost, "/register", "", registerRequest("ivan@EXAMPLE.com", clientJobRoleId), nil)
+}
+
+func TestEmailVerificationLink(t *testing.T) {
+	ts := newTestServer(t)
+	ts.expect(http.StatusOK, fiber.MethodPost, "/register", "", registerRequest("ivan@example.com", clientJobRoleId), nil)
+	token := ts.mailer.lastToken(t, "ivan@example.com")
+
+	// opening the link, e.g. by a mail scanner, only shows the form
+	for i := 0; i < 2; i++ {
+		status, page := ts.page(fiber.MethodGet, "/verify-email?token="+url.QueryEscape(token), nil)
+		if status != http.StatusOK || !strings.Contains(page, `method="post"`) || !strings.Contains(page, token) {
+			t.Fatalf("got status %d and page %q opening the link", status, page)
+		}
+	}
+	ts.expect(http.StatusForbidden, fiber.MethodPost, "/login", "", LogiinUserRequest{Email: "ivan@example.com", Password: testPassword}, nil)
+
+	status, page := ts.page(fiber.MethodPost, "/verify-email", url.Values{"token": {token}})
+	if status != http.StatusOK || !strings.Contains(page, "verified") {
+		t.Fatalf("got status %d and page %q posting the form", status, page)
+	}
+	ts.login("ivan@example.com")
+
+	status, _ = ts.page(fiber.MethodPost, "/verify-email", url.Values{"token": {token}})
+	if status != http.StatusBadRequest {
+		t.Fatalf("got status %d posting a used token", status)
+	}
+}
+
+func TestChangeEmail(t *testing.T) {
+	ts := newTestServer(t)
+	ts.registerVerified("ivan@example.com")
+	token := ts.login("ivan@example.com")
+
+	ts.expect(http.StatusUnauthorized, fiber.MethodPost, "/me/email", token.Access, ChangeEmailRequest{CurrentPassword: "wrong password", NewEmail: "ivan@example.org"}, nil)
+	ts.expect(http.StatusAccepted, fiber.MethodPost, "/me/email", token.Access, ChangeEmailRequest{CurrentPassword: testPassword, NewEmail: "ivan@example.org"}, nil)
+	changeToken := ts.mailer.lastToken(t, "ivan@example.org")
+
+	// opening the link only shows the form
+	status, page := ts.page(fiber.MethodGet, "/me/email/confirm?token="+url.QueryEscape(changeToken), nil)
+	if status != http.StatusOK || !strings.Contains(page, `method="post"`) || !strings.Contains(page, changeToken) {
+		t.Fatalf("got status %d and page %q opening the link", status, page)
+	}
+	ts.login("ivan@example.com")
+
+	status, page = ts.page(fiber.MethodPost, "/me/email/confirm", url.Values{"token": {changeToken}})
+	if status != http.StatusOK || !strings.Contains(page, "changed") {
+		t.Fatalf("got status %d and page %q posting the form", status, page)
+	}
+	ts.expect(http.StatusBadRequest, fiber.MethodPost, "/me/email/confirm", "", VerifyEmailRequest{Token: changeToken}, nil)
+
+	ts.expect(http.StatusUnauthorized, fiber.MethodPost, "/login", "", LogiinUserRequest{Email: "ivan@example.com", Password: testPassword}, nil)
+	ts.login("ivan@example.org")
+}
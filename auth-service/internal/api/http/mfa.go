@@ -0,0 +1,317 @@
+package http
+
+import (
+	"auth/internal/auth"
+	"auth/internal/mfa"
+	"auth/internal/store"
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var (
+	errMfaEnabled     = errors.New("two-factor authentication is already enabled")
+	errMfaNotEnabled  = errors.New("two-factor authentication is not enabled")
+	errInvalidMfaCode = errors.New("invalid authentication code")
+)
+
+// CompleteMfaLogin is the second login step of users with two-factor authentication. It exchanges the
+// challenge returned by LoginUser and a TOTP or recovery code for a Token. Wrong codes count against
+// the login throttle, the challenge stays valid until it expires or a code is accepted. Only an
+// accepted code forgets the failed attempts of the email, including those of the password step.
+func (hs *HttpService) CompleteMfaLogin(ctx context.Context, request MfaLoginRequest, clientIP, deviceInfo string) (*auth.Token, error) {
+	err := request.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	challenge, err := hs.authService.VerifyMfaChallenge(ctx, request.MfaToken)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := hs.storeService.FindUserById(ctx, challenge.UserId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, auth.ErrInvalidUserToken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	attempt, wait := hs.loginThrottle.Wait(user.Email, clientIP)
+	if wait > 0 {
+		return nil, &retryAfterError{retryAfter: wait}
+	}
+	defer attempt.Done()
+
+	totp, err := hs.enabledTotp(ctx, user.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	err = hs.storeService.WithTx(ctx, func(tx store.UserStore) error {
+		err := tx.UseUserToken(ctx, challenge.Id, time.Now().Unix())
+		if err != nil {
+			return err
+		}
+
+		return hs.checkSecondFactor(ctx, tx, totp, request.Code, request.RecoveryCode)
+	})
+	if errors.Is(err, store.ErrUserTokenUsed) {
+		return nil, auth.ErrInvalidUserToken
+	}
+	if errors.Is(err, errInvalidMfaCode) {
+		attempt.Failure()
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+	attempt.Success()
+
+	return hs.authService.CreateToken(ctx, user, clientIP, deviceInfo)
+}
+
+func (hs *HttpService) MfaStatus(ctx context.Context, claims *auth.UserClaims) (*MfaStatusResponse, error) {
+	totp, err := hs.storeService.FindUserTotp(ctx, claims.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return &MfaStatusResponse{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	recoveryCodes, err := hs.storeService.CountRecoveryCodes(ctx, claims.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &MfaStatusResponse{
+		TotpEnabled:       totp.ConfirmedAt != nil,
+		TotpPending:       totp.ConfirmedAt == nil,
+		RecoveryCodesLeft: recoveryCodes,
+	}, nil
+}
+
+// EnrollTotp creates a new TOTP secret for the user. It is not required at login until ConfirmTotp
+// proves that the authenticator app was set up. Enrolling again replaces an unconfirmed secret.
+func (hs *HttpService) EnrollTotp(ctx context.Context, claims *auth.UserClaims, clientIP string, request MfaPasswordRequest) (*TotpEnrollmentResponse, error) {
+	user, err := hs.reauthenticate(ctx, claims, clientIP, request.CurrentPassword)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := mfa.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	err = hs.storeService.SaveUserTotp(ctx, &store.UserTotp{
+		UserId:    user.Id,
+		Secret:    secret,
+		CreatedAt: time.Now().Unix(),
+	})
+	if errors.Is(err, store.ErrDuplicate) {
+		return nil, errMfaEnabled
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &TotpEnrollmentResponse{
+		Secret:          secret,
+		ProvisioningUri: hs.authService.TotpProvisioningURI(user.Email, secret),
+	}, nil
+}
+
+// ConfirmTotp enables two-factor authentication once the user enters a code of the enrolled secret.
+// The recovery codes are only returned here, and the other sessions of the user are logged out.
+func (hs *HttpService) ConfirmTotp(ctx context.Context, claims *auth.UserClaims, request MfaCodeRequest) (*RecoveryCodesResponse, error) {
+	if request.Code == "" {
+		return nil, invalidField("code", errRequired)
+	}
+
+	totp, err := hs.storeService.FindUserTotp(ctx, claims.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errMfaNotEnabled
+	}
+	if err != nil {
+		return nil, err
+	}
+	if totp.ConfirmedAt != nil {
+		return nil, errMfaEnabled
+	}
+
+	now := time.Now()
+	step, ok := mfa.Validate(totp.Secret, request.Code, now)
+	if !ok {
+		return nil, errInvalidMfaCode
+	}
+
+	codes, codeHashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	err = hs.storeService.EnableUserTotp(ctx, claims.ID, now.Unix(), step, codeHashes)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errMfaEnabled
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = hs.authService.RevokeOtherTokens(ctx, claims)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RecoveryCodesResponse{RecoveryCodes: codes}, nil
+}
+
+// DisableTotp turns off two-factor authentication. An enabled one requires the password and a current
+// TOTP or recovery code, an unconfirmed enrollment only the password.
+func (hs *HttpService) DisableTotp(ctx context.Context, claims *auth.UserClaims, clientIP string, request DisableTotpRequest) error {
+	user, err := hs.reauthenticate(ctx, claims, clientIP, request.CurrentPassword)
+	if err != nil {
+		return err
+	}
+
+	totp, err := hs.storeService.FindUserTotp(ctx, user.Id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return errMfaNotEnabled
+	}
+	if err != nil {
+		return err
+	}
+	if totp.ConfirmedAt != nil && request.Code == "" && request.RecoveryCode == "" {
+		return invalidField("code", errRequired)
+	}
+
+	err = hs.storeService.WithTx(ctx, func(tx store.UserStore) error {
+		if totp.ConfirmedAt != nil {
+			err := hs.checkSecondFactor(ctx, tx, totp, request.Code, request.RecoveryCode)
+			if err != nil {
+				return err
+			}
+		}
+
+		return tx.DeleteUserTotp(ctx, user.Id)
+	})
+	if errors.Is(err, errInvalidMfaCode) {
+		hs.loginThrottle.Failure(user.Email, clientIP)
+		return err
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return errMfaNotEnabled
+	}
+
+	return err
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes of the user, e.g. after most of them were used.
+func (hs *HttpService) RegenerateRecoveryCodes(ctx context.Context, claims *auth.UserClaims, clientIP string, request MfaPasswordRequest) (*RecoveryCodesResponse, error) {
+	user, err := hs.reauthenticate(ctx, claims, clientIP, request.CurrentPassword)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = hs.enabledTotp(ctx, user.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	codes, codeHashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	err = hs.storeService.ReplaceRecoveryCodes(ctx, user.Id, codeHashes, time.Now().Unix())
+	if err != nil {
+		return nil, err
+	}
+
+	return &RecoveryCodesResponse{RecoveryCodes: codes}, nil
+}
+
+// ResetUserMfa lets an admin turn off two-factor authentication of a user who lost the authenticator
+// and the recovery codes.
+func (hs *HttpService) ResetUserMfa(ctx context.Context, claims *auth.UserClaims, userID int64) error {
+	_, err := hs.storeService.FindUserById(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	err = hs.storeService.DeleteUserTotp(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return errMfaNotEnabled
+	}
+	if err != nil {
+		return err
+	}
+
+	hs.logger.Info("user mfa reset", "user_id", userID, "admin_id", claims.ID)
+	return nil
+}
+
+// enabledTotp returns the TOTP secret of the user if its enrollment is confirmed and errMfaNotEnabled otherwise.
+func (hs *HttpService) enabledTotp(ctx context.Context, userID int64) (*store.UserTotp, error) {
+	totp, err := hs.storeService.FindUserTotp(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errMfaNotEnabled
+	}
+	if err != nil {
+		return nil, err
+	}
+	if totp.ConfirmedAt == nil {
+		return nil, errMfaNotEnabled
+	}
+
+	return totp, nil
+}
+
+// checkSecondFactor accepts a TOTP code, each at most once, or an unused recovery code, which is consumed.
+func (hs *HttpService) checkSecondFactor(ctx context.Context, tx store.UserStore, totp *store.UserTotp, code, recoveryCode string) error {
+	if code != "" {
+		step, ok := mfa.Validate(totp.Secret, code, time.Now())
+		if !ok {
+			return errInvalidMfaCode
+		}
+
+		err := tx.UseTotpStep(ctx, totp.UserId, step)
+		if errors.Is(err, store.ErrTotpStepUsed) {
+			return errInvalidMfaCode
+		}
+		return err
+	}
+
+	if recoveryCode == "" {
+		return errInvalidMfaCode
+	}
+
+	err := tx.UseRecoveryCode(ctx, totp.UserId, mfa.HashRecoveryCode(recoveryCode), time.Now().Unix())
+	if errors.Is(err, sql.ErrNoRows) {
+		return errInvalidMfaCode
+	}
+	if err != nil {
+		return err
+	}
+
+	hs.logger.Info("recovery code used", "user_id", totp.UserId)
+	return nil
+}
+
+func generateRecoveryCodes() ([]string, []string, error) {
+	codes, err := mfa.GenerateRecoveryCodes()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	codeHashes := make([]string, 0, len(codes))
+	for _, code := range codes {
+		codeHashes = append(codeHashes, mfa.HashRecoveryCode(code))
+	}
+
+	return codes, codeHashes, nil
+}
@@ -0,0 +1,119 @@
+package http
+
+import (
+	"auth/internal/auth"
+	"auth/internal/mfa"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func totpCode(t *testing.T, secret string, step int64) string {
+	t.Helper()
+
+	code, err := mfa.Code(secret, step)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return code
+}
+
+// enableTotp enrolls and confirms TOTP for the user of the access token and returns the secret, the step
+// // of the confirmation code and the recovery codes. The code of the step after it is unused and valid
+// for another step, even if the clock moves on during the test.
+func (ts *testServer) enableTotp(accessToken string) (string, int64, []string) {
+	ts.t.Helper()
+
+	var enrollment TotpEnrollmentResponse
+	ts.expect(http.StatusCreated, fiber.MethodPost, "/me/mfa/totp", accessToken, MfaPasswordRequest{CurrentPassword: testPassword}, &enrollment)
+
+	step := mfa.Step(time.Now())
+	var recoveryCodes RecoveryCodesResponse
+	ts.expect(http.StatusOK, fiber.MethodPost, "/me/mfa/totp/confirm", accessToken,
+		MfaCodeRequest{Code: totpCode(ts.t, enrollment.Secret, step)}, &recoveryCodes)
+	if len(recoveryCodes.RecoveryCodes) != mfa.RecoveryCodeCount {
+		ts.t.Fatalf("got %d recovery codes", len(recoveryCodes.RecoveryCodes))
+	}
+
+	return enrollment.Secret, step, recoveryCodes.RecoveryCodes
+}
+
+// mfaChallenge logs in with the password and returns the token of the second factor challenge.
+func (ts *testServer) mfaChallenge(email string) string {
+	ts.t.Helper()
+
+	var challenge auth.MfaChallenge
+	ts.expect(http.StatusOK, fiber.MethodPost, "/login", "", LogiinUserRequest{Email: email, Password: testPassword}, &challenge)
+	if !challenge.MfaRequired || challenge.MfaToken == "" {
+		ts.t.Fatalf("login without a second factor challenge: %+v", challenge)
+	}
+
+	return challenge.MfaToken
+}
+
+func TestMfaLogin(t *testing.T) {
+	ts := newTestServer(t)
+	ts.registerVerified("ivan@example.com")
+	secret, step, _ := ts.enableTotp(ts.login("ivan@example.com").Access)
+
+	mfaToken := ts.mfaChallenge("ivan@example.com")
+	ts.expect(http.StatusUnauthorized, fiber.MethodPost, "/login/mfa", "", MfaLoginRequest{MfaToken: mfaToken, Code: totpCode(t, secret, step+10)}, nil)
+
+	// the code of the confirmation was used already
+	mfaToken = ts.mfaChallenge("ivan@example.com")
+	ts.expect(http.StatusUnauthorized, fiber.MethodPost, "/login/mfa", "", MfaLoginRequest{MfaToken: mfaToken, Code: totpCode(t, secret, step)}, nil)
+
+	code := totpCode(t, secret, step+1)
+	mfaToken = ts.mfaChallenge("ivan@example.com")
+	var token auth.Token
+	ts.expect(http.StatusOK, fiber.MethodPost, "/login/mfa", "", MfaLoginRequest{MfaToken: mfaToken, Code: code}, &token)
+	ts.expect(http.StatusOK, fiber.MethodGet, "/me", token.Access, nil, nil)
+
+	// the challenge token is single-use
+	ts.expect(http.StatusBadRequest, fiber.MethodPost, "/login/mfa", "", MfaLoginRequest{MfaToken: mfaToken, Code: totpCode(t, secret, step+2)}, nil)
+
+	// a code is accepted once, even with a new challenge
+	mfaToken = ts.mfaChallenge("ivan@example.com")
+	ts.expect(http.StatusUnauthorized, fiber.MethodPost, "/login/mfa", "", MfaLoginRequest{MfaToken: mfaToken, Code: code}, nil)
+}
+
+func TestMfaRecoveryCode(t *testing.T) {
+	ts := newTestServer(t)
+	ts.registerVerified("ivan@example.com")
+	_, _, recoveryCodes := ts.enableTotp(ts.login("ivan@example.com").Access)
+
+	mfaToken := ts.mfaChallenge("ivan@example.com")
+	var token auth.Token
+	ts.expect(http.StatusOK, fiber.MethodPost, "/login/mfa", "", MfaLoginRequest{MfaToken: mfaToken, RecoveryCode: recoveryCodes[0]}, &token)
+
+	var status MfaStatusResponse
+	ts.expect(http.StatusOK, fiber.MethodGet, "/me/mfa", token.Access, nil, &status)
+	if !status.TotpEnabled || status.RecoveryCodesLeft != mfa.RecoveryCodeCount-1 {
+		t.Fatalf("unexpected mfa status %+v", status)
+	}
+
+	mfaToken = ts.mfaChallenge("ivan@example.com")
+	ts.expect(http.StatusUnauthorized, fiber.MethodPost, "/login/mfa", "", MfaLoginRequest{MfaToken: mfaToken, RecoveryCode: recoveryCodes[0]}, nil)
+
+	mfaToken = ts.mfaChallenge("ivan@example.com")
+	ts.expect(http.StatusOK, fiber.MethodPost, "/login/mfa", "", MfaLoginRequest{MfaToken: mfaToken, RecoveryCode: recoveryCodes[1]}, nil)
+}
+
+func TestMfaLoginThrottle(t *testing.T) {
+	ts := newTestServer(t)
+	ts.registerVerified("ivan@example.com")
+	secret, step, _ := ts.enableTotp(ts.login("ivan@example.com").Access)
+
+	wrongPassword := LogiinUserRequest{Email: "ivan@example.com", Password: "wrong password"}
+	for i := 0; i < 3; i++ {
+		ts.expect(http.StatusUnauthorized, fiber.MethodPost, "/login", "", wrongPassword, nil)
+	}
+
+	// the correct password does not forget the failures, the wrong code is one too many
+	mfaToken := ts.mfaChallenge("ivan@example.com")
+	ts.expect(http.StatusUnauthorized, fiber.MethodPost, "/login/mfa", "", MfaLoginRequest{MfaToken: mfaToken, Code: totpCode(t, secret, step+10)}, nil)
+	ts.expect(http.StatusTooManyRequests, fiber.MethodPost, "/login", "", LogiinUserRequest{Email: "ivan@example.com", Password: testPassword}, nil)
+}
@@ -0,0 +1,129 @@
+package http
+
+import (
+	"auth/internal/auth"
+	"context"
+	"encoding/base64"
+	"errors"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const claimsLocalsKey = "claims"
+
+// disconnectPollInterval is how often a running request checks whether its client is still connected.
+const disconnectPollInterval = 250 * time.Millisecond
+
+var (
+	errMissingBearerToken      = errors.New("missing bearer token")
+	errInvalidClientCredential = errors.New("invalid client credentials")
+	errAdminRequired           = errors.New("admin role required")
+)
+
+// withTimeout gives every request its own context, cancelled after HttpConfig.ContextTimeout or
+// once the client disconnects.
+func (hr *httpRepository) withTimeout(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(c.UserContext(), hr.contextTimeout)
+	defer cancel()
+
+	stop := watchDisconnect(c.Context().Conn(), cancel)
+	defer stop()
+
+	c.SetUserContext(ctx)
+	return c.Next()
+}
+
+// watchDisconnect cancels the request once its client closed the connection. fasthttp does not
+// report disconnects while a handler runs, so the connection is polled. The returned func stops
+// the watch and has to be called before fasthttp reads from the connection again.
+func watchDisconnect(conn net.Conn, cancel context.CancelFunc) func() {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+
+	go func() {
+		defer close(stopped)
+
+		ticker := time.NewTicker(disconnectPollInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				closed, ok := connClosed(conn)
+				if !ok {
+					return
+				}
+				if closed {
+					cancel()
+					return
+				}
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+// authenticate verifies the bearer access token and stores its claims in the request locals.
+func (hr *httpRepository) authenticate(c *fiber.Ctx) error {
+	accessToken, ok := strings.CutPrefix(c.Get(fiber.HeaderAuthorization), "Bearer ")
+	if !ok || accessToken == "" {
+		return errMissingBearerToken
+	}
+
+	claims, err := hr.httpService.VerifyToken(accessToken)
+	if err != nil {
+		return err
+	}
+
+	c.Locals(claimsLocalsKey, claims)
+	return c.Next()
+}
+
+// requireAdmin lets only admins through. It has to run after authenticate.
+func (hr *httpRepository) requireAdmin(c *fiber.Ctx) error {
+	claims := userClaims(c)
+	if claims == nil || !claims.IsAdmin {
+		return errAdminRequired
+	}
+
+	return c.Next()
+}
+
+// authenticateClient checks the HTTP Basic credentials of a resource server.
+func (hr *httpRepository) authenticateClient(c *fiber.Ctx) error {
+	clientID, clientSecret, ok := basicAuth(c.Get(fiber.HeaderAuthorization))
+	if !ok || !hr.httpService.VerifyClient(clientID, clientSecret) {
+		c.Set(fiber.HeaderWWWAuthenticate, `Basic realm="introspection"`)
+		return errInvalidClientCredential
+	}
+
+	return c.Next()
+}
+
+func basicAuth(header string) (string, string, bool) {
+	encoded, ok := strings.CutPrefix(header, "Basic ")
+	if !ok {
+		return "", "", false
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", "", false
+	}
+
+	return strings.Cut(string(decoded), ":")
+}
+
+func userClaims(c *fiber.Ctx) *auth.UserClaims {
+	claims, _ := c.Locals(claimsLocalsKey).(*auth.UserClaims)
+	return claims
+}
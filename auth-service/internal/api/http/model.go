@@ -1,31 +1,272 @@
 package http
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 type LogiinUserRequest struct {
-	Email    string
-	Password string
+	Email    string `json:"email"`
+	Password string `json:"password"`
 }
 
 type RegisterUserRequest struct {
-	JobRoleId    int
-	Address      Address
-	Name         string
-	SecondName   string
-	Surname      string
-	Email        string
-	Password     string
-	Birthday     int64
-	BirthdayDate time.Time
+	JobRoleId    int       `json:"job_role_id"`
+	Address      *Address  `json:"address"`
+	Name         string    `json:"name"`
+	SecondName   string    `json:"second_name"`
+	Surname      string    `json:"surname"`
+	Email        string    `json:"email"`
+	Password     string    `json:"password"`
+	Birthday     *int64    `json:"birthday"`
+	BirthdayDate time.Time `json:"birthday_date"`
 }
 
 type Address struct {
-	SettlementTypeId int `json:"settlement_type_id"`
-	Country          string
-	Region           string
-	District         string
-	Settlement       string
-	Street           string
-	HouseNumber      string
-	FlatNumber       string
+	SettlementTypeId int    `json:"settlement_type_id"`
+	Country          string `json:"country"`
+	Region           string `json:"region"`
+	District         string `json:"district"`
+	Settlement       string `json:"settlement"`
+	Street           string `json:"street"`
+	HouseNumber      string `json:"house_number"`
+	FlatNumber       string `json:"flat_number"`
+}
+
+type IntrospectionRequest struct {
+	Token         string `json:"token" form:"token"`
+	TokenTypeHint string `json:"token_type_hint" form:"token_type_hint"`
+}
+
+type IntrospectionResponse struct {
+	Active    bool   `json:"active"`
+	TokenType string `json:"token_type,omitempty"`
+	Sub       string `json:"sub,omitempty"`
+	UserId    int64  `json:"user_id,omitempty"`
+	Email     string `json:"email,omitempty"`
+	Role      string `json:"role,omitempty"`
+	JobRole   string `json:"job_role,omitempty"`
+	IsAdmin   bool   `json:"is_admin,omitempty"`
+	Jti       string `json:"jti,omitempty"`
+	Iat       int64  `json:"iat,omitempty"`
+	Exp       int64  `json:"exp,omitempty"`
+}
+
+type VideoHistoryRequest struct {
+	VideoName string `json:"video_name"`
+	Event     string `json:"event"`
+}
+
+type VideoHistoryQuery struct {
+	From   int64 `query:"from"`
+	To     int64 `query:"to"`
+	Limit  int   `query:"limit"`
+	Offset int   `query:"offset"`
+}
+
+type VideoHistoryEntry struct {
+	Id        int64  `json:"id"`
+	VideoName string `json:"video_name"`
+	Event     string `json:"event"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+type VideoHistoryResponse struct {
+	Items  []VideoHistoryEntry `json:"items"`
+	Total  int                 `json:"total"`
+	Limit  int                 `json:"limit"`
+	Offset int                 `json:"offset"`
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+type VerifyEmailRequest struct {
+	Token string `json:"token" query:"token" form:"token"`
+}
+
+type ResendVerificationRequest struct {
+	Email string `json:"email"`
+}
+
+type UpdateProfileRequest struct {
+	Name       *string `json:"name"`
+	SecondName *string `json:"second_name"`
+	Surname    *string `json:"surname"`
+	Birthday   *int64  `json:"birthday"`
+}
+
+type ProfileResponse struct {
+	Id            int64            `json:"id"`
+	Email         string           `json:"email"`
+	EmailVerified bool             `json:"email_verified"`
+	IsActive      bool             `json:"is_active"`
+	Name          string           `json:"name"`
+	SecondName    string           `json:"second_name"`
+	Surname       string           `json:"surname"`
+	Birthday      int64            `json:"birthday"`
+	JobRole       *JobRoleResponse `json:"job_role"`
+	Address       *AddressResponse `json:"address"`
+}
+
+type JobRoleResponse struct {
+	Id      int    `json:"id"`
+	Name    string `json:"name"`
+	Role    string `json:"role"`
+	Retired bool   `json:"retired"`
+}
+
+type SettlementTypeResponse struct {
+	Id      int    `json:"id"`
+	Name    string `json:"name"`
+	Retired bool   `json:"retired"`
+}
+
+type AddressResponse struct {
+	Id             int64                   `json:"id"`
+	SettlementType *SettlementTypeResponse `json:"settlement_type"`
+	Country        string                  `json:"country"`
+	Region         string                  `json:"region"`
+	District       string                  `json:"district"`
+	Settlement     string                  `json:"settlement"`
+	Street         string                  `json:"street"`
+	HouseNumber    string                  `json:"house_number"`
+	FlatNumber     string                  `json:"flat_number"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+type ChangeEmailRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewEmail        string `json:"new_email"`
+}
+
+type UserListQuery struct {
+	JobRoleId int    `query:"job_role_id"`
+	IsActive  *bool  `query:"is_active"`
+	Search    string `query:"search"`
+	Limit     int    `query:"limit"`
+	Offset    int    `query:"offset"`
+}
+
+type UserListResponse struct {
+	Items  []ProfileResponse `json:"items"`
+	Total  int               `json:"total"`
+	Limit  int               `json:"limit"`
+	Offset int               `json:"offset"`
+}
+
+type SetJobRoleRequest struct {
+	JobRoleId int `json:"job_role_id"`
+}
+
+type AdminResetPasswordRequest struct {
+	Password string `json:"password"`
+}
+
+type CreateJobRoleRequest struct {
+	Name string `json:"name"`
+	Role string `json:"role"`
+}
+
+type ReferenceNameRequest struct {
+	Name string `json:"name"`
+}
+
+type MfaLoginRequest struct {
+	MfaToken     string `json:"mfa_token"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+type MfaPasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+}
+
+type MfaCodeRequest struct {
+	Code string `json:"code"`
+}
+
+type DisableTotpRequest struct {
+	CurrentPassword string `json:"current_password"`
+	Code            string `json:"code"`
+	RecoveryCode    string `json:"recovery_code"`
+}
+
+type MfaStatusResponse struct {
+	TotpEnabled       bool `json:"totp_enabled"`
+	TotpPending       bool `json:"totp_pending"`
+	RecoveryCodesLeft int  `json:"recovery_codes_left"`
+}
+
+type TotpEnrollmentResponse struct {
+	Secret          string `json:"secret"`
+	ProvisioningUri string `json:"provisioning_uri"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+type PasskeyRegistrationRequest struct {
+	CurrentPassword string `json:"current_password"`
+}
+
+type DeletePasskeyRequest struct {
+	CurrentPassword string `json:"current_password"`
+}
+
+// FinishPasskeyRegistrationRequest carries the session returned by the begin request and the
+// PublicKeyCredential of navigator.credentials.create() as JSON.
+type FinishPasskeyRegistrationRequest struct {
+	Session    string          `json:"session"`
+	Name       string          `json:"name"`
+	Credential json.RawMessage `json:"credential"`
+}
+
+type PasskeyLoginRequest struct {
+	Email string `json:"email"`
+}
+
+// FinishPasskeyLoginRequest carries the session returned by the begin request and the
+// PublicKeyCredential of navigator.credentials.get() as JSON.
+type FinishPasskeyLoginRequest struct {
+	Session    string          `json:"session"`
+	Credential json.RawMessage `json:"credential"`
+}
+
+// PasskeyCeremonyResponse starts a passkey registration or login. Options are passed to
+// navigator.credentials.create() or get(), Session is sent back with the result.
+type PasskeyCeremonyResponse struct {
+	Session   string `json:"session"`
+	ExpiresIn int    `json:"expires_in"`
+	Options   any    `json:"options"`
+}
+
+type PasskeyResponse struct {
+	Id         int64  `json:"id"`
+	Name       string `json:"name"`
+	CreatedAt  int64  `json:"created_at"`
+	LastUsedAt *int64 `json:"last_used_at"`
+}
+
+// SessionResponse is a device the user is logged in on. Current marks the session of the access token
+// the request was made with.
+type SessionResponse struct {
+	Id         string `json:"id"`
+	IpAddress  string `json:"ip_address"`
+	UserAgent  string `json:"user_agent"`
+	CreatedAt  int64  `json:"created_at"`
+	LastUsedAt int64  `json:"last_used_at"`
+	ExpiresAt  int64  `json:"expires_at"`
+	Current    bool   `json:"current"`
 }
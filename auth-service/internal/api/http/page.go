@@ -0,0 +1,53 @@
+package http
+
+import (
+	"html/template"
+	"net/http"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// confirmationTemplate is the page mailed links open. The token is only used when the form is posted,
+// so mail scanners and link previews fetching the link do not use it up.
+var confirmationTemplate = template.Must(template.New("confirmation").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+{{if .Button}}<form method="post" action="{{.Action}}">
+<input type="hidden" name="token" value="{{.Token}}">
+<button type="submit">{{.Button}}</button>
+</form>{{else}}<p>{{.Text}}</p>{{end}}
+</body>
+</html>
+`))
+
+// confirmationPage is either the form posting the token to Action or, without a Button, the result.
+type confirmationPage struct {
+	Title  string
+	Text   string
+	Action string
+	Token  string
+	Button string
+}
+
+func renderConfirmationPage(c *fiber.Ctx, page confirmationPage) error {
+	// the token is part of the URL, keep it out of caches and Referer headers
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	c.Set(fiber.HeaderReferrerPolicy, "no-referrer")
+	c.Type("html", "utf-8")
+	c.Status(http.StatusOK)
+
+	return confirmationTemplate.Execute(c.Response().BodyWriter(), page)
+}
+
+// isFormPost reports whether the request was sent by the form of a confirmation page.
+func isFormPost(c *fiber.Ctx) bool {
+	contentType := c.Get(fiber.HeaderContentType)
+	return strings.HasPrefix(contentType, fiber.MIMEApplicationForm) || strings.HasPrefix(contentType, fiber.MIMEMultipartForm)
+}
@@ -0,0 +1,267 @@
+package http
+
+import (
+	"auth/internal/auth"
+	"auth/internal/passkey"
+	"auth/internal/store"
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+const defaultPasskeyName = "Passkey"
+
+var (
+	errPasskeyLoginFailed = errors.New("passkey login failed")
+	errPasskeyRegistered  = errors.New("passkey is already registered")
+)
+
+// BeginPasskeyRegistration starts adding a passkey to the account. It requires the password, like every
+// other change of the ways to log in.
+func (hs *HttpService) BeginPasskeyRegistration(ctx context.Context, claims *auth.UserClaims, clientIP string, request PasskeyRegistrationRequest) (*PasskeyCeremonyResponse, error) {
+	user, err := hs.reauthenticate(ctx, claims, clientIP, request.CurrentPassword)
+	if err != nil {
+		return nil, err
+	}
+
+	credentials, err := hs.storeService.FindWebAuthnCredentials(ctx, user.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	options, session, err := hs.passkeys.BeginRegistration(user, credentials)
+	if err != nil {
+		return nil, err
+	}
+
+	return hs.passkeyCeremony(ctx, user.Id, store.TokenPurposeWebAuthnRegistration, session, options)
+}
+
+// FinishPasskeyRegistration verifies the new passkey and stores it. The session can be used only once.
+func (hs *HttpService) FinishPasskeyRegistration(ctx context.Context, claims *auth.UserClaims, request FinishPasskeyRegistrationRequest) (*PasskeyResponse, error) {
+	var ve ValidationError
+	if request.Session == "" {
+		ve.check("session", errRequired)
+	}
+	if len(request.Credential) == 0 {
+		ve.check("credential", errRequired)
+	}
+	name := defaultPasskeyName
+	if request.Name != "" {
+		var err error
+		name, err = validateReferenceName(request.Name)
+		ve.check("name", err)
+	}
+	err := ve.err()
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := hs.authService.VerifyWebAuthnSession(ctx, store.TokenPurposeWebAuthnRegistration, request.Session)
+	if err != nil {
+		return nil, err
+	}
+	if session.UserId != claims.ID {
+		return nil, auth.ErrInvalidUserToken
+	}
+
+	user, err := hs.storeService.FindUserById(ctx, claims.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	credential, err := hs.passkeys.FinishRegistration(user, session.Payload, request.Credential)
+	if err != nil {
+		return nil, err
+	}
+	credential.Name = name
+	credential.CreatedAt = time.Now().Unix()
+
+	err = hs.storeService.WithTx(ctx, func(tx store.UserStore) error {
+		err := tx.UseUserToken(ctx, session.Id, credential.CreatedAt)
+		if err != nil {
+			return err
+		}
+
+		credential.Id, err = tx.CreateWebAuthnCredential(ctx, credential)
+		return err
+	})
+	if errors.Is(err, store.ErrUserTokenUsed) {
+		return nil, auth.ErrInvalidUserToken
+	}
+	if errors.Is(err, store.ErrDuplicate) {
+		return nil, errPasskeyRegistered
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	hs.logger.Info("passkey registered", "user_id", user.Id, "passkey_id", credential.Id)
+	return newPasskeyResponse(credential), nil
+}
+
+func (hs *HttpService) ListPasskeys(ctx context.Context, claims *auth.UserClaims) ([]PasskeyResponse, error) {
+	credentials, err := hs.storeService.FindWebAuthnCredentials(ctx, claims.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	response := make([]PasskeyResponse, 0, len(credentials))
+	for _, credential := range credentials {
+		response = append(response, *newPasskeyResponse(&credential))
+	}
+
+	return response, nil
+}
+
+// DeletePasskey removes a passkey of the user. Like registering one, it requires the current password.
+func (hs *HttpService) DeletePasskey(ctx context.Context, claims *auth.UserClaims, clientIP string, passkeyID int64, request DeletePasskeyRequest) error {
+	user, err := hs.reauthenticate(ctx, claims, clientIP, request.CurrentPassword)
+	if err != nil {
+		return err
+	}
+
+	err = hs.storeService.DeleteWebAuthnCredential(ctx, user.Id, passkeyID)
+	if err != nil {
+		return err
+	}
+
+	hs.logger.Info("passkey deleted", "user_id", user.Id, "passkey_id", passkeyID)
+	return nil
+}
+
+// BeginPasskeyLogin starts a login with one of the passkeys of the user. Unknown emails and accounts
+// without passkeys get the same error and count against the login throttle like wrong passwords.
+func (hs *HttpService) BeginPasskeyLogin(ctx context.Context, request PasskeyLoginRequest, clientIP string) (*PasskeyCeremonyResponse, error) {
+	email, err := normalizeEmail(request.Email)
+	if err != nil {
+		return nil, invalidField("email", err)
+	}
+
+	attempt, wait := hs.loginThrottle.Wait(email, clientIP)
+	if wait > 0 {
+		return nil, &retryAfterError{retryAfter: wait}
+	}
+	defer attempt.Done()
+
+	user, err := hs.storeService.FindUserByEmail(ctx, email)
+	if errors.Is(err, sql.ErrNoRows) {
+		attempt.Failure()
+		return nil, errPasskeyLoginFailed
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	credentials, err := hs.storeService.FindWebAuthnCredentials(ctx, user.Id)
+	if err != nil {
+		return nil, err
+	}
+	if len(credentials) == 0 {
+		attempt.Failure()
+		return nil, errPasskeyLoginFailed
+	}
+
+	options, session, err := hs.passkeys.BeginLogin(user, credentials)
+	if err != nil {
+		return nil, err
+	}
+
+	return hs.passkeyCeremony(ctx, user.Id, store.TokenPurposeWebAuthnLogin, session, options)
+}
+
+// FinishPasskeyLogin exchanges the signed challenge for a Token. Passkeys verify the user themselves,
+// so no TOTP code is asked for. Failed attempts count against the login throttle, the session stays
+// valid until it expires or a login succeeds.
+func (hs *HttpService) FinishPasskeyLogin(ctx context.Context, request FinishPasskeyLoginRequest, clientIP, deviceInfo string) (*auth.Token, error) {
+	var ve ValidationError
+	if request.Session == "" {
+		ve.check("session", errRequired)
+	}
+	if len(request.Credential) == 0 {
+		ve.check("credential", errRequired)
+	}
+	err := ve.err()
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := hs.authService.VerifyWebAuthnSession(ctx, store.TokenPurposeWebAuthnLogin, request.Session)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := hs.storeService.FindUserById(ctx, session.UserId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, auth.ErrInvalidUserToken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	attempt, wait := hs.loginThrottle.Wait(user.Email, clientIP)
+	if wait > 0 {
+		return nil, &retryAfterError{retryAfter: wait}
+	}
+	defer attempt.Done()
+
+	credentials, err := hs.storeService.FindWebAuthnCredentials(ctx, user.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	credential, err := hs.passkeys.FinishLogin(user, credentials, session.Payload, request.Credential)
+	if errors.Is(err, passkey.ErrInvalidResponse) || errors.Is(err, passkey.ErrClonedPasskey) {
+		hs.logger.Warn("passkey login failed", "user_id", user.Id, "err", err.Error())
+		attempt.Failure()
+		return nil, errPasskeyLoginFailed
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = hs.storeService.WithTx(ctx, func(tx store.UserStore) error {
+		now := time.Now().Unix()
+		err := tx.UseUserToken(ctx, session.Id, now)
+		if err != nil {
+			return err
+		}
+
+		return tx.UpdateWebAuthnCredential(ctx, credential.Id, credential.Data, now)
+	})
+	if errors.Is(err, store.ErrUserTokenUsed) {
+		return nil, auth.ErrInvalidUserToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	attempt.Success()
+
+	return hs.authService.CreateToken(ctx, user, clientIP, deviceInfo)
+}
+
+// passkeyCeremony stores the session of a ceremony and returns it together with the options for the browser.
+func (hs *HttpService) passkeyCeremony(ctx context.Context, userID int64, purpose, session string, options any) (*PasskeyCeremonyResponse, error) {
+	ttl := hs.passkeys.SessionTTL()
+
+	token, err := hs.authService.CreateWebAuthnSession(ctx, userID, purpose, session, ttl)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PasskeyCeremonyResponse{
+		Session:   token,
+		ExpiresIn: int(ttl.Seconds()),
+		Options:   options,
+	}, nil
+}
+
+func newPasskeyResponse(credential *store.WebAuthnCredential) *PasskeyResponse {
+	return &PasskeyResponse{
+		Id:         credential.Id,
+		Name:       credential.Name,
+		CreatedAt:  credential.CreatedAt,
+		LastUsedAt: credential.LastUsedAt,
+	}
+}
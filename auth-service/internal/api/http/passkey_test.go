@@ -0,0 +1,255 @@
+package http
+
+import (
+	"auth/internal/auth"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/gofiber/fiber/v2"
+)
+
+const testOrigin = "http://" + testWebAuthnHost + ":8080"
+
+// authenticator data flags, see https://www.w3.org/TR/webauthn-2/#flags
+const (
+	flagUserPresent  = 0x01
+	flagUserVerified = 0x04
+	flagAttested     = 0x40
+)
+
+// softAuthenticator plays the part of a platform authenticator with an ES256 key and answers
+// ceremonies the way the browser would pass them on.
+type softAuthenticator struct {
+	t       *testing.T
+	key     *ecdsa.PrivateKey
+	id      []byte
+	origin  string
+	counter uint32
+}
+
+func newSoftAuthenticator(t *testing.T, id, origin string) *softAuthenticator {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &softAuthenticator{t: t, key: key, id: []byte(id), origin: origin}
+}
+
+func (sa *softAuthenticator) authenticatorData(attested bool) []byte {
+	rpIDHash := sha256.Sum256([]byte(testWebAuthnHost))
+	data := append([]byte{}, rpIDHash[:]...)
+
+	flags := byte(flagUserPresent | flagUserVerified)
+	if attested {
+		flags |= flagAttested
+	}
+	data = append(data, flags)
+	data = binary.BigEndian.AppendUint32(data, sa.counter)
+	if !attested {
+		return data
+	}
+
+	// attested credential data: AAGUID, credential id and the public key as COSE_Key
+	data = append(data, make([]byte, 16)...)
+	data = binary.BigEndian.AppendUint16(data, uint16(len(sa.id)))
+	data = append(data, sa.id...)
+
+	publicKey, err := cbor.Marshal(map[int]any{
+		1:  2,  // kty: EC2
+		3:  -7, // alg: ES256
+		-1: 1,  // crv: P-256
+		-2: sa.key.PublicKey.X.FillBytes(make([]byte, 32)),
+		-3: sa.key.PublicKey.Y.FillBytes(make([]byte, 32)),
+	})
+	if err != nil {
+		sa.t.Fatal(err)
+	}
+
+	return append(data, publicKey...)
+}
+
+func (sa *softAuthenticator) clientData(ceremonyType, challenge string) []byte {
+	clientData, err := json.Marshal(map[string]string{
+		"type":      ceremonyType,
+		"challenge": challenge,
+		"origin":    sa.origin,
+	})
+	if err != nil {
+		sa.t.Fatal(err)
+	}
+
+	return clientData
+}
+
+func (sa *softAuthenticator) credential(response map[string]string) json.RawMessage {
+	id := base64.RawURLEncoding.EncodeToString(sa.id)
+	credential, err := json.Marshal(map[string]any{
+		"id":       id,
+		"rawId":    id,
+		"type":     "public-key",
+		"response": response,
+	})
+	if err != nil {
+		sa.t.Fatal(err)
+	}
+
+	return credential
+}
+
+// create answers navigator.credentials.create() with a "none" attestation.
+func (sa *softAuthenticator) create(challenge string) json.RawMessage {
+	attestationObject, err := cbor.Marshal(map[string]any{
+		"fmt":      "none",
+		"attStmt":  map[string]any{},
+		"authData": sa.authenticatorData(true),
+	})
+	if err != nil {
+		sa.t.Fatal(err)
+	}
+
+	return sa.credential(map[string]string{
+		"clientDataJSON":    base64.RawURLEncoding.EncodeToString(sa.clientData("webauthn.create", challenge)),
+		"attestationObject": base64.RawURLEncoding.EncodeToString(attestationObject),
+	})
+}
+
+// get answers navigator.credentials.get(), signing the authenticator data and the client data hash.
+func (sa *softAuthenticator) get(challenge string) json.RawMessage {
+	sa.counter++
+
+	clientData := sa.clientData("webauthn.get", challenge)
+	authenticatorData := sa.authenticatorData(false)
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(authenticatorData, clientDataHash[:]...))
+
+	signature, err := ecdsa.SignASN1(rand.Reader, sa.key, digest[:])
+	if err != nil {
+		sa.t.Fatal(err)
+	}
+
+	return sa.credential(map[string]string{
+		"clientDataJSON":    base64.RawURLEncoding.EncodeToString(clientData),
+		"authenticatorData": base64.RawURLEncoding.EncodeToString(authenticatorData),
+		"signature":         base64.RawURLEncoding.EncodeToString(signature),
+	})
+}
+
+type testCeremony struct {
+	Session string `json:"session"`
+	Options struct {
+		PublicKey struct {
+			Challenge string `json:"challenge"`
+		} `json:"publicKey"`
+	} `json:"options"`
+}
+
+func (ts *testServer) beginPasskeyRegistration(accessToken string) *testCeremony {
+	ts.t.Helper()
+
+	var ceremony testCeremony
+	ts.expect(http.StatusOK, fiber.MethodPost, "/me/passkeys/register/begin", accessToken, PasskeyRegistrationRequest{CurrentPassword: testPassword}, &ceremony)
+
+	return &ceremony
+}
+
+func (ts *testServer) beginPasskeyLogin(email string) *testCeremony {
+	ts.t.Helper()
+
+	var ceremony testCeremony
+	ts.expect(http.StatusOK, fiber.MethodPost, "/login/passkey/begin", "", PasskeyLoginRequest{Email: email}, &ceremony)
+
+	return &ceremony
+}
+
+func TestPasskeyRegistration(t *testing.T) {
+	ts := newTestServer(t)
+	ts.registerVerified("ivan@example.com")
+	token := ts.login("ivan@example.com")
+
+	ts.expect(http.StatusUnauthorized, fiber.MethodPost, "/me/passkeys/register/begin", token.Access, PasskeyRegistrationRequest{CurrentPassword: "wrong password"}, nil)
+
+	ceremony := ts.beginPasskeyRegistration(token.Access)
+	challenge := ceremony.Options.PublicKey.Challenge
+
+	phished := newSoftAuthenticator(t, "credential-phished", "https://evil.example")
+	ts.expect(http.StatusBadRequest, fiber.MethodPost, "/me/passkeys/register/finish", token.Access,
+		FinishPasskeyRegistrationRequest{Session: ceremony.Session, Credential: phished.create(challenge)}, nil)
+
+	authenticator := newSoftAuthenticator(t, "credential-1", testOrigin)
+	var created PasskeyResponse
+	ts.expect(http.StatusCreated, fiber.MethodPost, "/me/passkeys/register/finish", token.Access,
+		FinishPasskeyRegistrationRequest{Session: ceremony.Session, Name: "Laptop", Credential: authenticator.create(challenge)}, &created)
+	if created.Name != "Laptop" || created.LastUsedAt != nil {
+		t.Fatalf("unexpected passkey %+v", created)
+	}
+
+	// the session is single-use
+	other := newSoftAuthenticator(t, "credential-2", testOrigin)
+	ts.expect(http.StatusBadRequest, fiber.MethodPost, "/me/passkeys/register/finish", token.Access,
+		FinishPasskeyRegistrationRequest{Session: ceremony.Session, Credential: other.create(challenge)}, nil)
+
+	// a session can only be finished by the user who started it
+	ts.registerVerified("petr@example.com")
+	otherToken := ts.login("petr@example.com")
+	ceremony = ts.beginPasskeyRegistration(token.Access)
+	ts.expect(http.StatusBadRequest, fiber.MethodPost, "/me/passkeys/register/finish", otherToken.Access,
+		FinishPasskeyRegistrationRequest{Session: ceremony.Session, Credential: other.create(ceremony.Options.PublicKey.Challenge)}, nil)
+
+	var passkeys []PasskeyResponse
+	ts.expect(http.StatusOK, fiber.MethodGet, "/me/passkeys", token.Access, nil, &passkeys)
+	if len(passkeys) != 1 || passkeys[0].Id != created.Id {
+		t.Fatalf("unexpected passkeys %+v", passkeys)
+	}
+}
+
+func TestPasskeyLogin(t *testing.T) {
+	ts := newTestServer(t)
+	ts.registerVerified("ivan@example.com")
+	token := ts.login("ivan@example.com")
+
+	ts.expect(http.StatusUnauthorized, fiber.MethodPost, "/login/passkey/begin", "", PasskeyLoginRequest{Email: "ivan@example.com"}, nil)
+	ts.expect(http.StatusUnauthorized, fiber.MethodPost, "/login/passkey/begin", "", PasskeyLoginRequest{Email: "nobody@example.com"}, nil)
+
+	authenticator := newSoftAuthenticator(t, "credential-1", testOrigin)
+	registration := ts.beginPasskeyRegistration(token.Access)
+	var created PasskeyResponse
+	ts.expect(http.StatusCreated, fiber.MethodPost, "/me/passkeys/register/finish", token.Access,
+		FinishPasskeyRegistrationRequest{Session: registration.Session, Credential: authenticator.create(registration.Options.PublicKey.Challenge)}, &created)
+
+	ceremony := ts.beginPasskeyLogin("ivan@example.com")
+	ts.expect(http.StatusUnauthorized, fiber.MethodPost, "/login/passkey/finish", "",
+		FinishPasskeyLoginRequest{Session: ceremony.Session, Credential: authenticator.get("another-challenge")}, nil)
+
+	var passkeyToken auth.Token
+	ts.expect(http.StatusOK, fiber.MethodPost, "/login/passkey/finish", "",
+		FinishPasskeyLoginRequest{Session: ceremony.Session, Credential: authenticator.get(ceremony.Options.PublicKey.Challenge)}, &passkeyToken)
+	ts.expect(http.StatusOK, fiber.MethodGet, "/me", passkeyToken.Access, nil, nil)
+
+	ts.expect(http.StatusBadRequest, fiber.MethodPost, "/login/passkey/finish", "",
+		FinishPasskeyLoginRequest{Session: ceremony.Session, Credential: authenticator.get(ceremony.Options.PublicKey.Challenge)}, nil)
+
+	// a signature counter going backwards means the passkey was cloned
+	ceremony = ts.beginPasskeyLogin("ivan@example.com")
+	authenticator.counter = 0
+	ts.expect(http.StatusUnauthorized, fiber.MethodPost, "/login/passkey/finish", "",
+		FinishPasskeyLoginRequest{Session: ceremony.Session, Credential: authenticator.get(ceremony.Options.PublicKey.Challenge)}, nil)
+
+	passkeyPath := fmt.Sprintf("/me/passkeys/%d", created.Id)
+	ts.expect(http.StatusUnauthorized, fiber.MethodDelete, passkeyPath, token.Access, DeletePasskeyRequest{CurrentPassword: "wrong password"}, nil)
+	// deleting needs the password, a stolen access token is not enough
+	ts.expect(http.StatusOK, fiber.MethodPost, "/login/passkey/begin", "", PasskeyLoginRequest{Email: "ivan@example.com"}, nil)
+	ts.expect(http.StatusNoContent, fiber.MethodDelete, passkeyPath, token.Access, DeletePasskeyRequest{CurrentPassword: testPassword}, nil)
+	ts.expect(http.StatusUnauthorized, fiber.MethodPost, "/login/passkey/begin", "", PasskeyLoginRequest{Email: "ivan@example.com"}, nil)
+}
@@ -1,83 +1,1063 @@
 package http
 
 import (
+	"auth/config"
 	"auth/internal/auth"
+	"auth/internal/mail"
+	"auth/internal/passkey"
 	"auth/internal/store"
+	"auth/internal/throttle"
 	"context"
+	"database/sql"
+	"errors"
+	"fmt"
 	"log/slog"
+	"strings"
+	"time"
 
 	"golang.org/x/crypto/bcrypt"
 )
 
+const (
+	defaultPageLimit = 20
+	maxPageLimit     = 100
+
+	minPasswordLength = 8
+	// bcrypt ignores everything after 72 bytes
+	maxPasswordLength = 72
+
+	maxFieldLength = 256
+)
+
+var (
+	errInvalidVideoName   = errors.New("video name is required")
+	errInvalidVideoEvent  = errors.New("event must be stream or view")
+	errPasswordTooShort   = fmt.Errorf("password must be at least %d characters long", minPasswordLength)
+	errPasswordTooLong    = fmt.Errorf("password must be at most %d bytes long", maxPasswordLength)
+	errInvalidCredentials = errors.New("invalid email or password")
+	errDeactivateSelf     = errors.New("admins cannot deactivate themselves")
+	errFieldTooLong       = fmt.Errorf("must not be longer than %d characters", maxFieldLength)
+	errInvalidBirthday    = errors.New("birthday must be in the past")
+	errInvalidSettlement  = errors.New("settlement type is required")
+	errInvalidEmail       = errors.New("invalid email address")
+	errEmailTaken         = errors.New("email is already in use")
+	errDeleteSelf         = errors.New("admins cannot delete themselves")
+	errChangeOwnJobRole   = errors.New("admins cannot change their own job role")
+	errInvalidJobRole     = errors.New("job role is required")
+	errUnknownJobRole     = errors.New("job role does not exist")
+	errRetiredJobRole     = errors.New("job role is retired")
+	errAdminJobRole       = errors.New("job role can only be assigned by an admin")
+	errUnknownSettlement  = errors.New("settlement type does not exist")
+	errRetiredSettlement  = errors.New("settlement type is retired")
+	errInvalidRole        = errors.New("role must be client or admin")
+	errInvalidName        = errors.New("name is required")
+)
+
+// minBirthday is 1900-01-01, birthdays are stored as unix seconds
+const minBirthday = -2208988800
+
+// dummyPasswordHash is compared against when the email is unknown, so the response time
+// does not reveal whether an account exists.
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("dummy-password"), bcrypt.DefaultCost)
+
 type HttpService struct {
-	authService  *auth.AuthService
-	storeService *store.StoreService
-	logger       *slog.Logger
-	ctx          *context.Context
+	authService   *auth.AuthService
+	storeService  store.UserStore
+	loginThrottle *throttle.LoginThrottle
+	mailThrottle  *throttle.MailThrottle
+	passkeys      *passkey.PasskeyService
+	mailer        mail.Mailer
+	mailConfig    *config.MailConfig
+	logger        *slog.Logger
 }
 
-func NewHttpService(authService *auth.AuthService, storeService *store.StoreService, logger *slog.Logger, ctx *context.Context) *HttpService {
+func NewHttpService(authService *auth.AuthService, storeService store.UserStore, loginThrottle *throttle.LoginThrottle, mailThrottle *throttle.MailThrottle, passkeys *passkey.PasskeyService, mailer mail.Mailer, mailConfig *config.MailConfig, logger *slog.Logger) *HttpService {
 	return &HttpService{
-		authService:  authService,
-		storeService: storeService,
-		logger:       logger,
-		ctx:          ctx,
+		authService:   authService,
+		storeService:  storeService,
+		loginThrottle: loginThrottle,
+		mailThrottle:  mailThrottle,
+		passkeys:      passkeys,
+		mailer:        mailer,
+		mailConfig:    mailConfig,
+		logger:        logger,
 	}
 }
 
-func (hs *HttpService) RegisterUser(user RegisterUserRequest) (int64, error) {
+// RegisterUser creates the user together with its address, if one is given, in one transaction,
+// and returns the profile of the new user.
+func (hs *HttpService) RegisterUser(ctx context.Context, user RegisterUserRequest) (*ProfileResponse, error) {
+	err := user.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	err = hs.checkJobRole(ctx, user.JobRoleId, false)
+	if err != nil {
+		return nil, invalidField("job_role_id", err)
+	}
+
+	if user.Address != nil {
+		err = hs.checkSettlementType(ctx, user.Address.SettlementTypeId)
+		if err != nil {
+			return nil, invalidField("address.settlement_type_id", err)
+		}
+	}
+
 	hashedPwd, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
 	if err != nil {
-		return 0, err
+		return nil, err
+	}
+
+	var userID int64
+	err = hs.storeService.WithTx(ctx, func(tx store.UserStore) error {
+		var addressID int64
+		if user.Address != nil {
+			addressID, err = tx.CreateAddress(ctx, newStoreAddress(user.Address))
+			if err != nil {
+				return err
+			}
+		}
+
+		userID, err = tx.CreateUser(ctx, &store.User{
+			JobRoleId:  user.JobRoleId,
+			AddressId:  addressID,
+			Name:       user.Name,
+			SecondName: user.SecondName,
+			Surname:    user.Surname,
+			Email:      user.Email,
+			Password:   string(hashedPwd),
+			Birthday:   *user.Birthday,
+			IsActive:   true,
+		})
+		return err
+	})
+	if errors.Is(err, store.ErrDuplicate) {
+		return nil, errEmailTaken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	hs.sendVerificationMail(ctx, userID, user.Email)
+
+	profile, err := hs.storeService.FindUserProfile(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return newProfileResponse(profile), nil
+}
+
+func (hs *HttpService) LoginUser(ctx context.Context, loginData LogiinUserRequest, clientIP, deviceInfo string) (*auth.Token, *auth.MfaChallenge, error) {
+	err := loginData.validate()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	attempt, wait := hs.loginThrottle.Wait(loginData.Email, clientIP)
+	if wait > 0 {
+		return nil, nil, &retryAfterError{retryAfter: wait}
+	}
+	defer attempt.Done()
+
+	user, err := hs.storeService.FindUserByEmail(ctx, loginData.Email)
+	if errors.Is(err, sql.ErrNoRows) {
+		bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(loginData.Password))
+		attempt.Failure()
+		return nil, nil, errInvalidCredentials
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(loginData.Password))
+	if err != nil {
+		attempt.Failure()
+		return nil, nil, errInvalidCredentials
+	}
+
+	// The failed attempts of accounts with two-factor authentication are only forgotten once the
+	// second factor was checked too, a correct password alone does not reset the throttle.
+	_, err = hs.enabledTotp(ctx, user.Id)
+	if err == nil {
+		challenge, err := hs.authService.CreateMfaChallenge(ctx, user)
+		return nil, challenge, err
+	}
+	if !errors.Is(err, errMfaNotEnabled) {
+		return nil, nil, err
+	}
+	attempt.Success()
+
+	jwt, err := hs.authService.CreateToken(ctx, user, clientIP, deviceInfo)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return jwt, nil, nil
+}
+
+func (hs *HttpService) RefreshToken(ctx context.Context, token auth.Token, clientIP, deviceInfo string) (*auth.Token, error) {
+	return hs.authService.RefreshToken(ctx, &token, clientIP, deviceInfo)
+}
+
+func (hs *HttpService) VerifyToken(accessToken string) (*auth.UserClaims, error) {
+	return hs.authService.VerifyToken(accessToken)
+}
+
+func (hs *HttpService) Logout(ctx context.Context, claims *auth.UserClaims) error {
+	return hs.authService.RevokeToken(ctx, claims)
+}
+
+func (hs *HttpService) LogoutAll(ctx context.Context, claims *auth.UserClaims) error {
+	err := hs.authService.RevokeToken(ctx, claims)
+	if err != nil {
+		return err
+	}
+
+	return hs.authService.RevokeUserTokens(ctx, claims.ID)
+}
+
+func (hs *HttpService) JWKS() auth.JWKS {
+	return hs.authService.JWKS()
+}
+
+func (hs *HttpService) VerifyClient(clientID, clientSecret string) bool {
+	return hs.authService.VerifyClient(clientID, clientSecret)
+}
+
+// Introspect reports whether the access token is currently active. Any verification failure,
+// including revocation, yields an inactive response without further details.
+func (hs *HttpService) Introspect(request IntrospectionRequest) IntrospectionResponse {
+	claims, err := hs.authService.VerifyToken(request.Token)
+	if err != nil {
+		return IntrospectionResponse{Active: false}
+	}
+
+	return IntrospectionResponse{
+		Active:    true,
+		TokenType: "Bearer",
+		Sub:       claims.Subject,
+		UserId:    claims.ID,
+		Email:     claims.Email,
+		Role:      claims.Role,
+		JobRole:   claims.JobRole,
+		IsAdmin:   claims.IsAdmin,
+		Jti:       claims.RegisteredClaims.ID,
+		Iat:       claims.IssuedAt.Unix(),
+		Exp:       claims.ExpiresAt.Unix(),
+	}
+}
+
+func (hs *HttpService) RecordVideoHistory(ctx context.Context, userID int64, request VideoHistoryRequest) (*VideoHistoryEntry, error) {
+	if request.VideoName == "" {
+		return nil, invalidField("video_name", errInvalidVideoName)
+	}
+	if len([]rune(request.VideoName)) > maxFieldLength {
+		return nil, invalidField("video_name", errFieldTooLong)
+	}
+	if request.Event == "" {
+		request.Event = store.VideoEventStream
+	}
+	if request.Event != store.VideoEventStream && request.Event != store.VideoEventView {
+		return nil, invalidField("event", errInvalidVideoEvent)
+	}
+
+	entry := &store.VideoHistory{
+		UserId:    userID,
+		VideoName: request.VideoName,
+		Event:     request.Event,
+		CreatedAt: time.Now().Unix(),
+	}
+
+	historyID, err := hs.storeService.CreateVideoHistory(ctx, entry)
+	if err != nil {
+		return nil, err
+	}
+
+	return &VideoHistoryEntry{
+		Id:        historyID,
+		VideoName: entry.VideoName,
+		Event:     entry.Event,
+		CreatedAt: entry.CreatedAt,
+	}, nil
+}
+
+// RecordUserVideoHistory records history reported by a resource server for the user it names.
+func (hs *HttpService) RecordUserVideoHistory(ctx context.Context, userID int64, request VideoHistoryRequest) (*VideoHistoryEntry, error) {
+	_, err := hs.storeService.FindUserById(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return hs.RecordVideoHistory(ctx, userID, request)
+}
+
+func (hs *HttpService) GetVideoHistory(ctx context.Context, claims *auth.UserClaims, query VideoHistoryQuery) (*VideoHistoryResponse, error) {
+	limit, offset := pagination(query.Limit, query.Offset)
+
+	history, total, err := hs.storeService.FindVideoHistory(ctx, store.VideoHistoryFilter{
+		UserId: claims.ID,
+		From:   query.From,
+		To:     query.To,
+		Limit:  limit,
+		Offset: offset,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]VideoHistoryEntry, 0, len(history))
+	for _, entry := range history {
+		items = append(items, VideoHistoryEntry{
+			Id:        entry.Id,
+			VideoName: entry.VideoName,
+			Event:     entry.Event,
+			CreatedAt: entry.CreatedAt,
+		})
+	}
+
+	return &VideoHistoryResponse{
+		Items:  items,
+		Total:  total,
+		Limit:  limit,
+		Offset: offset,
+	}, nil
+}
+
+func pagination(limit, offset int) (int, int) {
+	if limit <= 0 {
+		limit = defaultPageLimit
+	}
+	if limit > maxPageLimit {
+		limit = maxPageLimit
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	return limit, offset
+}
+
+// ForgotPassword mails a password reset link if the email belongs to a user, at most once per
+// VERIFICATION_RESEND_INTERVAL for every submitted email. It never tells the caller whether the account exists.
+func (hs *HttpService) ForgotPassword(ctx context.Context, request ForgotPasswordRequest) error {
+	email, err := normalizeEmail(request.Email)
+	if err != nil {
+		return invalidField("email", err)
+	}
+
+	wait := hs.mailThrottle.Wait(store.TokenPurposePasswordReset, email)
+	if wait > 0 {
+		return &retryAfterError{retryAfter: wait}
+	}
+
+	user, err := hs.storeService.FindUserByEmail(ctx, email)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
 	}
 
-	addressID, err := hs.storeService.CreateAddress(&store.Address{
-		SettlementTypeId: user.Address.SettlementTypeId,
-		Country:          user.Address.Country,
-		Region:           user.Address.Region,
-		District:         user.Address.District,
-		Settlement:       user.Address.Settlement,
-		Street:           user.Address.Street,
-		HouseNumber:      user.Address.HouseNumber,
-		FlatNumber:       user.Address.FlatNumber,
+	token, err := hs.authService.IssuePasswordResetToken(ctx, user.Id)
+	if err != nil {
+		return err
+	}
+
+	err = hs.mailer.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Password reset",
+		Body: fmt.Sprintf("Follow the link to set a new password: %s?token=%s\n\n"+
+			"If you did not request a password reset, ignore this message.", hs.mailConfig.PasswordResetUrl, token),
 	})
 	if err != nil {
-		return 0, err
+		hs.logger.Error("failed to send password reset mail", "user_id", user.Id, "err", err.Error())
+	}
+
+	return nil
+}
+
+// ResetPassword sets a new password using a reset token and logs the user out of all sessions.
+func (hs *HttpService) ResetPassword(ctx context.Context, request ResetPasswordRequest) error {
+	err := validatePassword(request.Password)
+	if err != nil {
+		return invalidField("password", err)
+	}
+
+	token, err := hs.authService.VerifyPasswordResetToken(ctx, request.Token)
+	if err != nil {
+		return err
+	}
+
+	hashedPwd, err := bcrypt.GenerateFromPassword([]byte(request.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	err = hs.storeService.ResetUserPassword(ctx, token, time.Now().Unix(), string(hashedPwd))
+	if errors.Is(err, store.ErrUserTokenUsed) {
+		return auth.ErrInvalidUserToken
+	}
+	if err != nil {
+		return err
+	}
+
+	return hs.authService.RevokeUserTokens(ctx, token.UserId)
+}
+
+// VerifyEmail confirms the email address the verification token was sent to.
+func (hs *HttpService) VerifyEmail(ctx context.Context, request VerifyEmailRequest) error {
+	token, err := hs.authService.VerifyEmailVerificationToken(ctx, request.Token)
+	if err != nil {
+		return err
+	}
+
+	err = hs.storeService.VerifyUserEmail(ctx, token, time.Now().Unix())
+	if errors.Is(err, store.ErrUserTokenUsed) {
+		return auth.ErrInvalidUserToken
+	}
+
+	return err
+}
+
+// ResendVerification mails a new verification link, at most once per VERIFICATION_RESEND_INTERVAL.
+// The interval applies to every submitted email, unknown and already verified ones are silently ignored.
+func (hs *HttpService) ResendVerification(ctx context.Context, request ResendVerificationRequest) error {
+	email, err := normalizeEmail(request.Email)
+	if err != nil {
+		return invalidField("email", err)
+	}
+
+	wait := hs.mailThrottle.Wait(store.TokenPurposeEmailVerification, email)
+	if wait > 0 {
+		return &retryAfterError{retryAfter: wait}
+	}
+
+	user, err := hs.storeService.FindUserByEmail(ctx, email)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if user.EmailVerified {
+		return nil
+	}
+
+	// the last mail may have been requested through another instance or before a restart
+	wait, err = hs.authService.VerificationResendAfter(ctx, user.Id)
+	if err != nil {
+		return err
+	}
+	if wait > 0 {
+		return nil
+	}
+
+	hs.sendVerificationMail(ctx, user.Id, user.Email)
+
+	return nil
+}
+
+// sendVerificationMail issues a verification token and mails it. Failures are only logged,
+// the user can request another mail with ResendVerification.
+func (hs *HttpService) sendVerificationMail(ctx context.Context, userID int64, email string) {
+	token, err := hs.authService.IssueEmailVerificationToken(ctx, userID)
+	if err != nil {
+		hs.logger.Error("failed to issue email verification token", "user_id", userID, "err", err.Error())
+		return
 	}
 
-	userID, err := hs.storeService.CreateUser(&store.User{
-		JobRoleId:  user.JobRoleId,
-		AddressId:  addressID,
-		Name:       user.Name,
-		SecondName: user.SecondName,
-		Surname:    user.Surname,
-		Email:      user.Email,
-		Password:   string(hashedPwd),
-		Birthday:   user.Birthday,
-		IsActive:   true,
+	err = hs.mailer.Send(ctx, mail.Message{
+		To:      email,
+		Subject: "Confirm your email",
+		Body:    fmt.Sprintf("Follow the link to confirm your email: %s?token=%s", hs.mailConfig.EmailVerificationUrl, token),
 	})
 	if err != nil {
-		return 0, err
+		hs.logger.Error("failed to send email verification mail", "user_id", userID, "err", err.Error())
+	}
+}
+
+// DeactivateUser prevents the user from logging in or refreshing tokens and revokes the tokens they already have.
+func (hs *HttpService) DeactivateUser(ctx context.Context, claims *auth.UserClaims, userID int64) error {
+	if claims.ID == userID {
+		return errDeactivateSelf
+	}
+
+	err := hs.storeService.SetUserActive(ctx, userID, false)
+	if err != nil {
+		return err
 	}
 
-	return userID, nil
+	hs.logger.Info("user deactivated", "user_id", userID, "admin_id", claims.ID)
+	return hs.authService.RevokeUserTokens(ctx, userID)
 }
 
-func (hs *HttpService) LoginUser(loginData LogiinUserRequest) (*auth.Token, error) {
-	user, err := hs.storeService.FindUserByEmail(loginData.Email)
+func (hs *HttpService) ReactivateUser(ctx context.Context, claims *auth.UserClaims, userID int64) error {
+	err := hs.storeService.SetUserActive(ctx, userID, true)
+	if err != nil {
+		return err
+	}
+
+	hs.logger.Info("user reactivated", "user_id", userID, "admin_id", claims.ID)
+	return nil
+}
+
+func (hs *HttpService) ListUsers(ctx context.Context, query UserListQuery) (*UserListResponse, error) {
+	limit, offset := pagination(query.Limit, query.Offset)
+
+	profiles, total, err := hs.storeService.FindUserProfiles(ctx, store.UserFilter{
+		JobRoleId: query.JobRoleId,
+		IsActive:  query.IsActive,
+		Search:    strings.TrimSpace(query.Search),
+		Limit:     limit,
+		Offset:    offset,
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(loginData.Password))
+	items := make([]ProfileResponse, 0, len(profiles))
+	for i := range profiles {
+		items = append(items, *newProfileResponse(&profiles[i]))
+	}
+
+	return &UserListResponse{
+		Items:  items,
+		Total:  total,
+		Limit:  limit,
+		Offset: offset,
+	}, nil
+}
+
+func (hs *HttpService) GetUser(ctx context.Context, userID int64) (*ProfileResponse, error) {
+	profile, err := hs.storeService.FindUserProfile(ctx, userID)
 	if err != nil {
 		return nil, err
 	}
 
-	jwt, err := hs.authService.CreateToken(user)
+	return newProfileResponse(profile), nil
+}
+
+// SetUserJobRole changes the job role of the user. The new role ends up in the claims
+// on the next login or refresh.
+func (hs *HttpService) SetUserJobRole(ctx context.Context, claims *auth.UserClaims, userID int64, request SetJobRoleRequest) (*ProfileResponse, error) {
+	if claims.ID == userID {
+		return nil, errChangeOwnJobRole
+	}
+
+	err := hs.checkJobRole(ctx, request.JobRoleId, true)
+	if err != nil {
+		return nil, invalidField("job_role_id", err)
+	}
+
+	err = hs.storeService.SetUserJobRole(ctx, userID, request.JobRoleId)
 	if err != nil {
 		return nil, err
 	}
 
-	return jwt, nil
+	hs.logger.Info("user job role changed", "user_id", userID, "job_role_id", request.JobRoleId, "admin_id", claims.ID)
+	return hs.GetUser(ctx, userID)
+}
+
+// ResetUserPassword sets a password chosen by an admin and logs the user out of all sessions.
+func (hs *HttpService) ResetUserPassword(ctx context.Context, claims *auth.UserClaims, userID int64, request AdminResetPasswordRequest) error {
+	err := validatePassword(request.Password)
+	if err != nil {
+		return invalidField("password", err)
+	}
+
+	hashedPwd, err := bcrypt.GenerateFromPassword([]byte(request.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	err = hs.storeService.UpdateUserPassword(ctx, userID, string(hashedPwd))
+	if err != nil {
+		return err
+	}
+
+	hs.logger.Info("user password reset by admin", "user_id", userID, "admin_id", claims.ID)
+	return hs.authService.RevokeUserTokens(ctx, userID)
+}
+
+// DeleteUser revokes the tokens of the user and removes it with all of its data.
+func (hs *HttpService) DeleteUser(ctx context.Context, claims *auth.UserClaims, userID int64) error {
+	if claims.ID == userID {
+		return errDeleteSelf
+	}
+
+	_, err := hs.storeService.FindUserById(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	err = hs.authService.RevokeUserTokens(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	err = hs.storeService.DeleteUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	hs.logger.Info("user deleted", "user_id", userID, "admin_id", claims.ID)
+	return nil
+}
+
+func (hs *HttpService) GetProfile(ctx context.Context, claims *auth.UserClaims) (*ProfileResponse, error) {
+	profile, err := hs.storeService.FindUserProfile(ctx, claims.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return newProfileResponse(profile), nil
+}
+
+// UpdateProfile changes only the fields present in the request.
+func (hs *HttpService) UpdateProfile(ctx context.Context, claims *auth.UserClaims, request UpdateProfileRequest) (*ProfileResponse, error) {
+	err := request.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	profile, err := hs.storeService.FindUserProfile(ctx, claims.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	user := &profile.User
+	for _, field := range []struct {
+		value  *string
+		target *string
+	}{
+		{request.Name, &user.Name},
+		{request.SecondName, &user.SecondName},
+		{request.Surname, &user.Surname},
+	} {
+		if field.value != nil {
+			*field.target = strings.TrimSpace(*field.value)
+		}
+	}
+
+	if request.Birthday != nil {
+		user.Birthday = *request.Birthday
+	}
+
+	err = hs.storeService.UpdateUserProfile(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+
+	return hs.GetProfile(ctx, claims)
+}
+
+// UpdateAddress replaces the address of the user, creating it if the user has none yet.
+func (hs *HttpService) UpdateAddress(ctx context.Context, claims *auth.UserClaims, request Address) (*ProfileResponse, error) {
+	var ve ValidationError
+	validateAddress(&ve, "", request)
+	err := ve.err()
+	if err != nil {
+		return nil, err
+	}
+
+	profile, err := hs.storeService.FindUserProfile(ctx, claims.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	// a retired settlement type may be kept, but not chosen anew
+	if profile.Address == nil || profile.Address.SettlementTypeId != request.SettlementTypeId {
+		err = hs.checkSettlementType(ctx, request.SettlementTypeId)
+		if err != nil {
+			return nil, invalidField("settlement_type_id", err)
+		}
+	}
+
+	address := newStoreAddress(&request)
+	if profile.Address != nil {
+		address.Id = profile.Address.Id
+		err = hs.storeService.UpdateAddress(ctx, address)
+	} else {
+		err = hs.storeService.WithTx(ctx, func(tx store.UserStore) error {
+			address.Id, err = tx.CreateAddress(ctx, address)
+			if err != nil {
+				return err
+			}
+
+			return tx.SetUserAddress(ctx, claims.ID, address.Id)
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return hs.GetProfile(ctx, claims)
+}
+
+func newStoreAddress(address *Address) *store.Address {
+	return &store.Address{
+		SettlementTypeId: address.SettlementTypeId,
+		Country:          address.Country,
+		Region:           address.Region,
+		District:         address.District,
+		Settlement:       address.Settlement,
+		Street:           address.Street,
+		HouseNumber:      address.HouseNumber,
+		FlatNumber:       address.FlatNumber,
+	}
+}
+
+func newProfileResponse(profile *store.UserProfile) *ProfileResponse {
+	response := &ProfileResponse{
+		Id:            profile.User.Id,
+		Email:         profile.User.Email,
+		EmailVerified: profile.User.EmailVerified,
+		IsActive:      profile.User.IsActive,
+		Name:          profile.User.Name,
+		SecondName:    profile.User.SecondName,
+		Surname:       profile.User.Surname,
+		Birthday:      profile.User.Birthday,
+	}
+
+	if profile.JobRole != nil {
+		response.JobRole = &JobRoleResponse{
+			Id:      profile.JobRole.Id,
+			Name:    profile.JobRole.Name,
+			Role:    profile.RoleName,
+			Retired: profile.JobRole.Retired,
+		}
+	}
+
+	if profile.Address != nil {
+		response.Address = &AddressResponse{
+			Id:          profile.Address.Id,
+			Country:     profile.Address.Country,
+			Region:      profile.Address.Region,
+			District:    profile.Address.District,
+			Settlement:  profile.Address.Settlement,
+			Street:      profile.Address.Street,
+			HouseNumber: profile.Address.HouseNumber,
+			FlatNumber:  profile.Address.FlatNumber,
+		}
+		if profile.SettlementType != nil {
+			response.Address.SettlementType = &SettlementTypeResponse{
+				Id:      profile.SettlementType.Id,
+				Name:    profile.SettlementType.Name,
+				Retired: profile.SettlementType.Retired,
+			}
+		}
+	}
+
+	return response
+}
+
+// ChangePassword sets a new password after checking the current one and logs the user out of all other sessions.
+func (hs *HttpService) ChangePassword(ctx context.Context, claims *auth.UserClaims, clientIP string, request ChangePasswordRequest) error {
+	err := validatePassword(request.NewPassword)
+	if err != nil {
+		return invalidField("new_password", err)
+	}
+
+	user, err := hs.reauthenticate(ctx, claims, clientIP, request.CurrentPassword)
+	if err != nil {
+		return err
+	}
+
+	hashedPwd, err := bcrypt.GenerateFromPassword([]byte(request.NewPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	err = hs.storeService.UpdateUserPassword(ctx, user.Id, string(hashedPwd))
+	if err != nil {
+		return err
+	}
+
+	return hs.authService.RevokeOtherTokens(ctx, claims)
+}
+
+// ChangeEmail sends a confirmation link to the new email. The email is changed only
+// once the link is followed, see ConfirmEmailChange.
+func (hs *HttpService) ChangeEmail(ctx context.Context, claims *auth.UserClaims, clientIP string, request ChangeEmailRequest) error {
+	newEmail, err := normalizeEmail(request.NewEmail)
+	if err != nil {
+		return invalidField("new_email", err)
+	}
+
+	user, err := hs.reauthenticate(ctx, claims, clientIP, request.CurrentPassword)
+	if err != nil {
+		return err
+	}
+
+	_, err = hs.storeService.FindUserByEmail(ctx, newEmail)
+	if err == nil {
+		return errEmailTaken
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	token, err := hs.authService.IssueEmailChangeToken(ctx, user.Id, newEmail)
+	if err != nil {
+		return err
+	}
+
+	err = hs.mailer.Send(ctx, mail.Message{
+		To:      newEmail,
+		Subject: "Confirm your new email",
+		Body:    fmt.Sprintf("Follow the link to use this address for your account: %s?token=%s", hs.mailConfig.EmailChangeUrl, token),
+	})
+	if err != nil {
+		return err
+	}
+
+	err = hs.mailer.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Email change requested",
+		Body:    "A change of your account email was requested. If it was not you, change your password.",
+	})
+	if err != nil {
+		hs.logger.Error("failed to send email change notice", "user_id", user.Id, "err", err.Error())
+	}
+
+	return nil
+}
+
+func (hs *HttpService) ConfirmEmailChange(ctx context.Context, request VerifyEmailRequest) error {
+	token, err := hs.authService.VerifyEmailChangeToken(ctx, request.Token)
+	if err != nil {
+		return err
+	}
+
+	err = hs.storeService.ChangeUserEmail(ctx, token, time.Now().Unix())
+	if errors.Is(err, store.ErrUserTokenUsed) {
+		return auth.ErrInvalidUserToken
+	}
+	if errors.Is(err, store.ErrDuplicate) {
+		return errEmailTaken
+	}
+
+	return err
+}
+
+// reauthenticate checks the current password of the user before a sensitive change.
+// Failures count against the login throttle like failed logins do.
+func (hs *HttpService) reauthenticate(ctx context.Context, claims *auth.UserClaims, clientIP, password string) (*store.User, error) {
+	attempt, wait := hs.loginThrottle.Wait(claims.Email, clientIP)
+	if wait > 0 {
+		return nil, &retryAfterError{retryAfter: wait}
+	}
+	defer attempt.Done()
+
+	user, err := hs.storeService.FindUserById(ctx, claims.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password))
+	if err != nil {
+		attempt.Failure()
+		return nil, errInvalidCredentials
+	}
+	attempt.Success()
+
+	return user, nil
+}
+
+func (hs *HttpService) ListJobRoles(ctx context.Context, includeRetired bool) ([]JobRoleResponse, error) {
+	jobRoles, err := hs.storeService.FindJobRoles(ctx, includeRetired)
+	if err != nil {
+		return nil, err
+	}
+
+	response := make([]JobRoleResponse, 0, len(jobRoles))
+	for _, jobRole := range jobRoles {
+		response = append(response, newJobRoleResponse(&jobRole))
+	}
+
+	return response, nil
+}
+
+func (hs *HttpService) CreateJobRole(ctx context.Context, claims *auth.UserClaims, request CreateJobRoleRequest) (*JobRoleResponse, error) {
+	name, err := validateReferenceName(request.Name)
+	if err != nil {
+		return nil, invalidField("name", err)
+	}
+	if request.Role == "" {
+		request.Role = store.RoleClient
+	}
+	if request.Role != store.RoleClient && request.Role != store.RoleAdmin {
+		return nil, invalidField("role", errInvalidRole)
+	}
+
+	jobRoleID, err := hs.storeService.CreateJobRole(ctx, name, request.Role)
+	if err != nil {
+		return nil, err
+	}
+
+	hs.logger.Info("job role created", "job_role_id", jobRoleID, "admin_id", claims.ID)
+	return hs.getJobRole(ctx, jobRoleID)
+}
+
+func (hs *HttpService) RenameJobRole(ctx context.Context, claims *auth.UserClaims, jobRoleID int, request ReferenceNameRequest) (*JobRoleResponse, error) {
+	name, err := validateReferenceName(request.Name)
+	if err != nil {
+		return nil, invalidField("name", err)
+	}
+
+	err = hs.storeService.RenameJobRole(ctx, jobRoleID, name)
+	if err != nil {
+		return nil, err
+	}
+
+	hs.logger.Info("job role renamed", "job_role_id", jobRoleID, "admin_id", claims.ID)
+	return hs.getJobRole(ctx, jobRoleID)
+}
+
+// RetireJobRole keeps the job role for the users that have it, but no longer offers it.
+func (hs *HttpService) RetireJobRole(ctx context.Context, claims *auth.UserClaims, jobRoleID int) error {
+	err := hs.storeService.RetireJobRole(ctx, jobRoleID)
+	if err != nil {
+		return err
+	}
+
+	hs.logger.Info("job role retired", "job_role_id", jobRoleID, "admin_id", claims.ID)
+	return nil
+}
+
+func (hs *HttpService) getJobRole(ctx context.Context, jobRoleID int) (*JobRoleResponse, error) {
+	jobRole, err := hs.storeService.FindJobRole(ctx, jobRoleID)
+	if err != nil {
+		return nil, err
+	}
+
+	response := newJobRoleResponse(jobRole)
+	return &response, nil
+}
+
+// checkJobRole makes sure the job role exists and can be assigned. Job roles granting
+// the admin role are only assignable by admins.
+func (hs *HttpService) checkJobRole(ctx context.Context, jobRoleID int, allowAdmin bool) error {
+	if jobRoleID <= 0 {
+		return errInvalidJobRole
+	}
+
+	jobRole, err := hs.storeService.FindJobRole(ctx, jobRoleID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return errUnknownJobRole
+	}
+	if err != nil {
+		return err
+	}
+	if jobRole.Retired {
+		return errRetiredJobRole
+	}
+	if !allowAdmin && jobRole.RoleName == store.RoleAdmin {
+		return errAdminJobRole
+	}
+
+	return nil
+}
+
+func (hs *HttpService) ListSettlementTypes(ctx context.Context, includeRetired bool) ([]SettlementTypeResponse, error) {
+	settlementTypes, err := hs.storeService.FindSettlementTypes(ctx, includeRetired)
+	if err != nil {
+		return nil, err
+	}
+
+	response := make([]SettlementTypeResponse, 0, len(settlementTypes))
+	for _, settlementType := range settlementTypes {
+		response = append(response, newSettlementTypeResponse(&settlementType))
+	}
+
+	return response, nil
+}
+
+func (hs *HttpService) CreateSettlementType(ctx context.Context, claims *auth.UserClaims, request ReferenceNameRequest) (*SettlementTypeResponse, error) {
+	name, err := validateReferenceName(request.Name)
+	if err != nil {
+		return nil, invalidField("name", err)
+	}
+
+	settlementTypeID, err := hs.storeService.CreateSettlementType(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	hs.logger.Info("settlement type created", "settlement_type_id", settlementTypeID, "admin_id", claims.ID)
+	return hs.getSettlementType(ctx, settlementTypeID)
+}
+
+func (hs *HttpService) RenameSettlementType(ctx context.Context, claims *auth.UserClaims, settlementTypeID int, request ReferenceNameRequest) (*SettlementTypeResponse, error) {
+	name, err := validateReferenceName(request.Name)
+	if err != nil {
+		return nil, invalidField("name", err)
+	}
+
+	err = hs.storeService.RenameSettlementType(ctx, settlementTypeID, name)
+	if err != nil {
+		return nil, err
+	}
+
+	hs.logger.Info("settlement type renamed", "settlement_type_id", settlementTypeID, "admin_id", claims.ID)
+	return hs.getSettlementType(ctx, settlementTypeID)
+}
+
+// RetireSettlementType keeps the settlement type on existing addresses, but no longer offers it.
+func (hs *HttpService) RetireSettlementType(ctx context.Context, claims *auth.UserClaims, settlementTypeID int) error {
+	err := hs.storeService.RetireSettlementType(ctx, settlementTypeID)
+	if err != nil {
+		return err
+	}
+
+	hs.logger.Info("settlement type retired", "settlement_type_id", settlementTypeID, "admin_id", claims.ID)
+	return nil
+}
+
+func (hs *HttpService) getSettlementType(ctx context.Context, settlementTypeID int) (*SettlementTypeResponse, error) {
+	settlementType, err := hs.storeService.FindSettlementType(ctx, settlementTypeID)
+	if err != nil {
+		return nil, err
+	}
+
+	response := newSettlementTypeResponse(settlementType)
+	return &response, nil
+}
+
+func (hs *HttpService) checkSettlementType(ctx context.Context, settlementTypeID int) error {
+	if settlementTypeID <= 0 {
+		return errInvalidSettlement
+	}
+
+	settlementType, err := hs.storeService.FindSettlementType(ctx, settlementTypeID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return errUnknownSettlement
+	}
+	if err != nil {
+		return err
+	}
+	if settlementType.Retired {
+		return errRetiredSettlement
+	}
+
+	return nil
+}
+
+func newJobRoleResponse(jobRole *store.JobRole) JobRoleResponse {
+	return JobRoleResponse{
+		Id:      jobRole.Id,
+		Name:    jobRole.Name,
+		Role:    jobRole.RoleName,
+		Retired: jobRole.Retired,
+	}
+}
+
+func newSettlementTypeResponse(settlementType *store.SettlementType) SettlementTypeResponse {
+	return SettlementTypeResponse{
+		Id:      settlementType.Id,
+		Name:    settlementType.Name,
+		Retired: settlementType.Retired,
+	}
 }
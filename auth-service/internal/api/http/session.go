@@ -0,0 +1,94 @@
+package http
+
+import (
+	"auth/internal/auth"
+	"auth/internal/store"
+	"context"
+)
+
+// ListSessions returns the devices the user is logged in on, most recently used first.
+func (hs *HttpService) ListSessions(ctx context.Context, claims *auth.UserClaims) ([]SessionResponse, error) {
+	currentID, err := hs.authService.CurrentSessionId(ctx, claims)
+	if err != nil {
+		return nil, err
+	}
+
+	return hs.sessions(ctx, claims.ID, currentID)
+}
+
+// RevokeSession logs the user out of one device. Revoking the current session is a logout.
+func (hs *HttpService) RevokeSession(ctx context.Context, claims *auth.UserClaims, sessionID string) error {
+	err := hs.authService.RevokeSession(ctx, claims.ID, sessionID)
+	if err != nil {
+		return err
+	}
+
+	hs.logger.Info("session revoked", "user_id", claims.ID, "session_id", sessionID)
+	return nil
+}
+
+// RevokeOtherSessions logs the user out of every device except the one the request was made from.
+func (hs *HttpService) RevokeOtherSessions(ctx context.Context, claims *auth.UserClaims) error {
+	return hs.authService.RevokeOtherTokens(ctx, claims)
+}
+
+func (hs *HttpService) ListUserSessions(ctx context.Context, userID int64) ([]SessionResponse, error) {
+	_, err := hs.storeService.FindUserById(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return hs.sessions(ctx, userID, "")
+}
+
+func (hs *HttpService) RevokeUserSession(ctx context.Context, claims *auth.UserClaims, userID int64, sessionID string) error {
+	err := hs.authService.RevokeSession(ctx, userID, sessionID)
+	if err != nil {
+		return err
+	}
+
+	hs.logger.Info("session revoked", "user_id", userID, "session_id", sessionID, "admin_id", claims.ID)
+	return nil
+}
+
+// RevokeUserSessions logs the user out of every device, e.g. after the account was compromised.
+func (hs *HttpService) RevokeUserSessions(ctx context.Context, claims *auth.UserClaims, userID int64) error {
+	_, err := hs.storeService.FindUserById(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	err = hs.authService.RevokeUserTokens(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	hs.logger.Info("user sessions revoked", "user_id", userID, "admin_id", claims.ID)
+	return nil
+}
+
+func (hs *HttpService) sessions(ctx context.Context, userID int64, currentID string) ([]SessionResponse, error) {
+	sessions, err := hs.authService.ActiveSessions(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	response := make([]SessionResponse, 0, len(sessions))
+	for _, session := range sessions {
+		response = append(response, newSessionResponse(&session, currentID))
+	}
+
+	return response, nil
+}
+
+func newSessionResponse(session *store.Session, currentID string) SessionResponse {
+	return SessionResponse{
+		Id:         session.Id,
+		IpAddress:  session.IpAddress,
+		UserAgent:  session.UserAgent,
+		CreatedAt:  session.CreatedAt,
+		LastUsedAt: session.LastUsedAt,
+		ExpiresAt:  session.ExpiresAt,
+		Current:    currentID != "" && session.Id == currentID,
+	}
+}
@@ -0,0 +1,111 @@
+package http
+
+import (
+	"auth/internal/auth"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestSessionClientIP(t *testing.T) {
+	ts := newTestServer(t)
+	ts.registerVerified("ivan@example.com")
+
+	tests := []struct {
+		name          string
+		forwardedFor  string
+		wantIpAddress string
+	}{
+		{"multiple hops", "203.0.113.7, " + strings.Repeat("198.51.100.1, ", 10) + "10.0.0.1", "203.0.113.7"},
+		{"oversized value", strings.Repeat("x", 1000), "0.0.0.0"},
+		{"ipv6", "2001:0db8:0000:0000:0000:0000:0000:0001", "2001:db8::1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			login := LogiinUserRequest{Email: "ivan@example.com", Password: testPassword}
+			var token auth.Token
+			status := ts.send(fiber.MethodPost, "/login", func(req *http.Request) {
+				req.Header.Set(fiber.HeaderXForwardedFor, tt.forwardedFor)
+			}, login, &token)
+			if status != http.StatusOK {
+				t.Fatalf("got status %d logging in", status)
+			}
+
+			var sessions []SessionResponse
+			ts.expect(http.StatusOK, fiber.MethodGet, "/me/sessions", token.Access, nil, &sessions)
+			current := currentSession(t, sessions)
+			if current.IpAddress != tt.wantIpAddress {
+				t.Fatalf("got session IP %q, want %q", current.IpAddress, tt.wantIpAddress)
+			}
+		})
+	}
+}
+
+func TestSessions(t *testing.T) {
+	ts := newTestServer(t)
+	ts.registerVerified("ivan@example.com")
+	current := ts.login("ivan@example.com")
+	other := ts.login("ivan@example.com")
+
+	var sessions []SessionResponse
+	ts.expect(http.StatusOK, fiber.MethodGet, "/me/sessions", current.Access, nil, &sessions)
+	if len(sessions) != 2 {
+		t.Fatalf("got %d sessions, want 2", len(sessions))
+	}
+	currentID := currentSession(t, sessions).Id
+
+	var otherSessions []SessionResponse
+	ts.expect(http.StatusOK, fiber.MethodGet, "/me/sessions", other.Access, nil, &otherSessions)
+	otherID := currentSession(t, otherSessions).Id
+	if otherID == currentID {
+		t.Fatal("both logins are marked as the same session")
+	}
+
+	// revoking a session logs its device out right away
+	ts.expect(http.StatusNoContent, fiber.MethodDelete, "/me/sessions/"+otherID, current.Access, nil, nil)
+	ts.expect(http.StatusUnauthorized, fiber.MethodGet, "/me", other.Access, nil, nil)
+	ts.expect(http.StatusUnauthorized, fiber.MethodPost, "/refresh", "", other, nil)
+	ts.expect(http.StatusNotFound, fiber.MethodDelete, "/me/sessions/"+otherID, current.Access, nil, nil)
+
+	ts.expect(http.StatusOK, fiber.MethodGet, "/me/sessions", current.Access, nil, &sessions)
+	if len(sessions) != 1 || sessions[0].Id != currentID || !sessions[0].Current {
+		t.Fatalf("unexpected sessions %+v after revoking the other one", sessions)
+	}
+
+	// revoking the current session is a logout
+	ts.expect(http.StatusNoContent, fiber.MethodDelete, "/me/sessions/"+currentID, current.Access, nil, nil)
+	ts.expect(http.StatusUnauthorized, fiber.MethodGet, "/me", current.Access, nil, nil)
+	ts.expect(http.StatusUnauthorized, fiber.MethodPost, "/refresh", "", current, nil)
+}
+
+func TestSessionsOfOtherUsers(t *testing.T) {
+	ts := newTestServer(t)
+	ts.registerVerified("ivan@example.com")
+	ts.registerVerified("petr@example.com")
+	ivan := ts.login("ivan@example.com")
+	petr := ts.login("petr@example.com")
+
+	var sessions []SessionResponse
+	ts.expect(http.StatusOK, fiber.MethodGet, "/me/sessions", petr.Access, nil, &sessions)
+	petrSessionID := currentSession(t, sessions).Id
+
+	ts.expect(http.StatusNotFound, fiber.MethodDelete, "/me/sessions/"+petrSessionID, ivan.Access, nil, nil)
+	ts.expect(http.StatusNotFound, fiber.MethodDelete, "/me/sessions/unknown", ivan.Access, nil, nil)
+	ts.expect(http.StatusOK, fiber.MethodGet, "/me", petr.Access, nil, nil)
+	ts.expect(http.StatusOK, fiber.MethodPost, "/refresh", "", petr, nil)
+}
+
+func currentSession(t *testing.T, sessions []SessionResponse) *SessionResponse {
+	t.Helper()
+
+	for i := range sessions {
+		if sessions[i].Current {
+			return &sessions[i]
+		}
+	}
+
+	t.Fatalf("no current session in %+v", sessions)
+	return nil
+}
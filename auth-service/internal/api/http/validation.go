@@ -0,0 +1,177 @@
+package http
+
+import (
+	"errors"
+	netmail "net/mail"
+	"strings"
+	"time"
+)
+
+var errRequired = errors.New("field is required")
+
+// validate checks the login request. Only the shape of the credentials is checked here,
+// whether they are right is up to LoginUser.
+func (r *LogiinUserRequest) validate() error {
+	var ve ValidationError
+
+	email, err := normalizeEmail(r.Email)
+	ve.check("email", err)
+	r.Email = email
+
+	if r.Password == "" {
+		ve.check("password", errRequired)
+	}
+
+	return ve.err()
+}
+
+// validate checks that the challenge comes with either a TOTP code or a recovery code.
+func (r *MfaLoginRequest) validate() error {
+	var ve ValidationError
+
+	if r.MfaToken == "" {
+		ve.check("mfa_token", errRequired)
+	}
+	if r.Code == "" && r.RecoveryCode == "" {
+		ve.check("code", errRequired)
+	}
+
+	return ve.err()
+}
+
+// validate checks every field of the registration request and normalizes the email.
+// Birthday may be given as BirthdayDate instead. The address is optional.
+func (r *RegisterUserRequest) validate() error {
+	var ve ValidationError
+
+	if r.Birthday == nil && !r.BirthdayDate.IsZero() {
+		birthday := r.BirthdayDate.Unix()
+		r.Birthday = &birthday
+	}
+
+	if r.JobRoleId <= 0 {
+		ve.check("job_role_id", errInvalidJobRole)
+	}
+	ve.check("name", validateName(r.Name, true))
+	ve.check("second_name", validateName(r.SecondName, false))
+	ve.check("surname", validateName(r.Surname, true))
+
+	email, err := normalizeEmail(r.Email)
+	ve.check("email", err)
+	r.Email = email
+
+	ve.check("password", validatePassword(r.Password))
+	if r.Birthday == nil {
+		ve.check("birthday", errRequired)
+	} else {
+		ve.check("birthday", validateBirthday(*r.Birthday))
+	}
+	if r.Address != nil {
+		validateAddress(&ve, "address.", *r.Address)
+	}
+
+	r.Name = strings.TrimSpace(r.Name)
+	r.SecondName = strings.TrimSpace(r.SecondName)
+	r.Surname = strings.TrimSpace(r.Surname)
+
+	return ve.err()
+}
+
+func (r *UpdateProfileRequest) validate() error {
+	var ve ValidationError
+
+	if r.Name != nil {
+		ve.check("name", validateName(*r.Name, true))
+	}
+	if r.SecondName != nil {
+		ve.check("second_name", validateName(*r.SecondName, false))
+	}
+	if r.Surname != nil {
+		ve.check("surname", validateName(*r.Surname, true))
+	}
+	if r.Birthday != nil {
+		ve.check("birthday", validateBirthday(*r.Birthday))
+	}
+
+	return ve.err()
+}
+
+func validateName(name string, required bool) error {
+	if required && strings.TrimSpace(name) == "" {
+		return errRequired
+	}
+	if len([]rune(name)) > maxFieldLength {
+		return errFieldTooLong
+	}
+
+	return nil
+}
+
+func validatePassword(password string) error {
+	if len([]rune(password)) < minPasswordLength {
+		return errPasswordTooShort
+	}
+	if len(password) > maxPasswordLength {
+		return errPasswordTooLong
+	}
+
+	return nil
+}
+
+func validateBirthday(birthday int64) error {
+	if birthday < minBirthday || birthday > time.Now().Unix() {
+		return errInvalidBirthday
+	}
+
+	return nil
+}
+
+// validateAddress records the invalid fields of the address, prefixing their names with prefix.
+func validateAddress(ve *ValidationError, prefix string, address Address) {
+	if address.SettlementTypeId <= 0 {
+		ve.check(prefix+"settlement_type_id", errInvalidSettlement)
+	}
+
+	for _, field := range []struct {
+		name  string
+		value string
+	}{
+		{"country", address.Country},
+		{"region", address.Region},
+		{"district", address.District},
+		{"settlement", address.Settlement},
+		{"street", address.Street},
+		{"house_number", address.HouseNumber},
+		{"flat_number", address.FlatNumber},
+	} {
+		ve.check(prefix+field.name, validateName(field.value, false))
+	}
+}
+
+// normalizeEmail accepts a bare address like user@example.com and returns it lowercased and without
+// surrounding spaces, addresses are unique regardless of case.
+func normalizeEmail(email string) (string, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	if email == "" {
+		return "", errRequired
+	}
+
+	address, err := netmail.ParseAddress(email)
+	if err != nil || address.Name != "" || address.Address != email || len(address.Address) > maxFieldLength {
+		return "", errInvalidEmail
+	}
+
+	return address.Address, nil
+}
+
+func validateReferenceName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", errInvalidName
+	}
+	if len([]rune(name)) > maxFieldLength {
+		return "", errFieldTooLong
+	}
+
+	return name, nil
+}
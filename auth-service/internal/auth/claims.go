@@ -11,11 +11,15 @@ import (
 type UserClaims struct {
 	ID      int64  `json:"id"`
 	Email   string `json:"email"`
-	IdAdmin bool   `json:"id_admin"`
+	Role    string `json:"role"`
+	JobRole string `json:"job_role"`
+	IsAdmin bool   `json:"is_admin"`
+	// Deprecated: misspelled duplicate of IsAdmin, still issued for services that read it.
+	IdAdmin bool `json:"id_admin"`
 	jwt.RegisteredClaims
 }
 
-func NewUserClaims(id int64, email string, isAdmin bool, duration time.Duration) (*UserClaims, error) {
+func NewUserClaims(id int64, email, role, jobRole string, isAdmin bool, duration time.Duration) (*UserClaims, error) {
 	tokenID, err := uuid.NewRandom()
 	if err != nil {
 		return nil, fmt.Errorf("error generating token ID: %w", err)
@@ -24,6 +28,9 @@ func NewUserClaims(id int64, email string, isAdmin bool, duration time.Duration)
 	return &UserClaims{
 		ID:      id,
 		Email:   email,
+		Role:    role,
+		JobRole: jobRole,
+		IsAdmin: isAdmin,
 		IdAdmin: isAdmin,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ID:        tokenID.String(),
@@ -33,3 +40,10 @@ func NewUserClaims(id int64, email string, isAdmin bool, duration time.Duration)
 		},
 	}, nil
 }
+
+// normalize fills IsAdmin for tokens issued before the claim was renamed from id_admin.
+func (uc *UserClaims) normalize() {
+	if uc.IdAdmin && !uc.IsAdmin {
+		uc.IsAdmin = true
+	}
+}
@@ -0,0 +1,61 @@
+package auth
+
+import (
+	"sync"
+	"time"
+)
+
+// denylist keeps the ids of revoked access tokens in memory until they expire,
+// so VerifyToken does not have to query the database.
+type denylist struct {
+	mu      sync.RWMutex
+	entries map[string]int64
+}
+
+func newDenylist() *denylist {
+	return &denylist{
+		entries: make(map[string]int64),
+	}
+}
+
+func (d *denylist) add(jti string, expiresAt int64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.entries[jti] = expiresAt
+}
+
+func (d *denylist) contains(jti string) bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	_, ok := d.entries[jti]
+	return ok
+}
+
+// merge adds a snapshot loaded from the database and drops the expired entries. Entries missing
+// from the snapshot are kept until they expire, they may have been added after it was read.
+func (d *denylist) merge(entries map[string]int64, now time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for jti, expiresAt := range d.entries {
+		if expiresAt > now.Unix() {
+			if _, ok := entries[jti]; !ok {
+				entries[jti] = expiresAt
+			}
+		}
+	}
+	d.entries = entries
+}
+
+func (d *denylist) prune(now time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for jti, expiresAt := range d.entries {
+		if expiresAt <= now.Unix() {
+			delete(d.entries, jti)
+		}
+	}
+}
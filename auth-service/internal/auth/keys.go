@@ -0,0 +1,230 @@
+package auth
+
+import (
+	"auth/config"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	SigningMethodHS256 = "HS256"
+	SigningMethodRS256 = "RS256"
+	SigningMethodEdDSA = "EdDSA"
+)
+
+var errUnknownKey = errors.New("unknown signing key")
+
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+type verificationKey struct {
+	method jwt.SigningMethod
+	key    crypto.PublicKey
+	jwk    JWK
+}
+
+// KeySet holds the key access tokens are signed with and all keys they may be verified with.
+// Tokens signed with an asymmetric key carry its kid, so old keys can stay in the set
+// for verification while a new key is used for signing.
+type KeySet struct {
+	signingKid    string
+	signingMethod jwt.SigningMethod
+	signingKey    interface{}
+	verification  map[string]*verificationKey
+	hmacSecret    []byte
+}
+
+// LoadKeySet builds the key set from the auth config. HS256 with SECRET_KEY is used when no
+// signing key file is configured. Tokens without a kid are verified with SECRET_KEY when it is set,
+// so tokens issued before switching to an asymmetric key stay valid until they expire.
+func LoadKeySet(cfg *config.AuthConfig) (*KeySet, error) {
+	ks := &KeySet{
+		verification: make(map[string]*verificationKey),
+	}
+	if cfg.SecretKey != "" {
+		ks.hmacSecret = []byte(cfg.SecretKey)
+	}
+
+	for _, path := range cfg.VerificationKeyFiles {
+		_, public, err := loadKeyFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = ks.addVerificationKey(public)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	switch cfg.SigningMethod {
+	case "", SigningMethodHS256:
+		if ks.hmacSecret == nil {
+			return nil, errors.New("SECRET_KEY is required for HS256 signing")
+		}
+		ks.signingMethod = jwt.SigningMethodHS256
+		ks.signingKey = ks.hmacSecret
+	case SigningMethodRS256, SigningMethodEdDSA:
+		private, public, err := loadKeyFile(cfg.SigningKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		if private == nil {
+			return nil, fmt.Errorf("%s: signing key file must contain a private key", cfg.SigningKeyFile)
+		}
+
+		kid, err := ks.addVerificationKey(public)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", cfg.SigningKeyFile, err)
+		}
+
+		method := ks.verification[kid].method
+		if method.Alg() != cfg.SigningMethod {
+			return nil, fmt.Errorf("%s: key type does not match signing method %s", cfg.SigningKeyFile, cfg.SigningMethod)
+		}
+
+		ks.signingKid = kid
+		ks.signingMethod = method
+		ks.signingKey = private
+	default:
+		return nil, fmt.Errorf("unsupported signing method %q", cfg.SigningMethod)
+	}
+
+	return ks, nil
+}
+
+func (ks *KeySet) sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(ks.signingMethod, claims)
+	if ks.signingKid != "" {
+		token.Header["kid"] = ks.signingKid
+	}
+
+	return token.SignedString(ks.signingKey)
+}
+
+// keyFunc resolves the verification key by the kid header and makes sure the token
+// is signed with the algorithm that belongs to that key.
+func (ks *KeySet) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, ok := token.Header["kid"].(string)
+	if !ok {
+		_, isHMAC := token.Method.(*jwt.SigningMethodHMAC)
+		if !isHMAC || ks.hmacSecret == nil {
+			return nil, fmt.Errorf("invalid token signing method")
+		}
+
+		return ks.hmacSecret, nil
+	}
+
+	key, ok := ks.verification[kid]
+	if !ok {
+		return nil, errUnknownKey
+	}
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, fmt.Errorf("invalid token signing method")
+	}
+
+	return key.key, nil
+}
+
+// JWKS returns the public verification keys in JSON Web Key Set format.
+func (ks *KeySet) JWKS() JWKS {
+	jwks := JWKS{
+		Keys: make([]JWK, 0, len(ks.verification)),
+	}
+	for _, key := range ks.verification {
+		jwks.Keys = append(jwks.Keys, key.jwk)
+	}
+
+	return jwks
+}
+
+func (ks *KeySet) addVerificationKey(public crypto.PublicKey) (string, error) {
+	var key verificationKey
+
+	switch public := public.(type) {
+	case *rsa.PublicKey:
+		key.method = jwt.SigningMethodRS256
+		key.jwk = JWK{
+			Kty: "RSA",
+			N:   base64.RawURLEncoding.EncodeToString(public.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes()),
+		}
+	case ed25519.PublicKey:
+		key.method = jwt.SigningMethodEdDSA
+		key.jwk = JWK{
+			Kty: "OKP",
+			Crv: "Ed25519",
+			X:   base64.RawURLEncoding.EncodeToString(public),
+		}
+	default:
+		return "", fmt.Errorf("unsupported key type %T", public)
+	}
+
+	key.key = public
+	key.jwk.Use = "sig"
+	key.jwk.Alg = key.method.Alg()
+	key.jwk.Kid = thumbprint(key.jwk)
+
+	ks.verification[key.jwk.Kid] = &key
+	return key.jwk.Kid, nil
+}
+
+// thumbprint computes the RFC 7638 JWK thumbprint, which is used as the kid.
+func thumbprint(jwk JWK) string {
+	var members string
+	switch jwk.Kty {
+	case "RSA":
+		members = fmt.Sprintf(`{"e":"%s","kty":"RSA","n":"%s"}`, jwk.E, jwk.N)
+	case "OKP":
+		members = fmt.Sprintf(`{"crv":"%s","kty":"OKP","x":"%s"}`, jwk.Crv, jwk.X)
+	}
+
+	sum := sha256.Sum256([]byte(members))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// loadKeyFile reads a PEM encoded RSA or Ed25519 key. For a private key both halves are returned,
+// for a public key the private one is nil.
+func loadKeyFile(path string) (crypto.PrivateKey, crypto.PublicKey, error) {
+	data, err := os.ReadFile(strings.TrimSpace(path))
+	if err != nil {
+		return nil, nil, fmt.Errorf("error reading key file: %w", err)
+	}
+
+	if rsaKey, err := jwt.ParseRSAPrivateKeyFromPEM(data); err == nil {
+		return rsaKey, &rsaKey.PublicKey, nil
+	}
+	if edKey, err := jwt.ParseEdPrivateKeyFromPEM(data); err == nil {
+		return edKey, edKey.(ed25519.PrivateKey).Public(), nil
+	}
+	if rsaKey, err := jwt.ParseRSAPublicKeyFromPEM(data); err == nil {
+		return nil, rsaKey, nil
+	}
+	if edKey, err := jwt.ParseEdPublicKeyFromPEM(data); err == nil {
+		return nil, edKey, nil
+	}
+
+	return nil, nil, fmt.Errorf("%s: unsupported key format", path)
+}
@@ -4,3 +4,11 @@ type Token struct {
 	Access  string
 	Refresh string
 }
+
+// MfaChallenge is returned instead of a Token when the user has to provide a second factor.
+// MfaToken completes the login together with the code.
+type MfaChallenge struct {
+	MfaRequired bool   `json:"mfa_required"`
+	MfaToken    string `json:"mfa_token"`
+	ExpiresIn   int    `json:"expires_in"`
+}
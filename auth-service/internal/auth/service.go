@@ -2,43 +2,115 @@ package auth
 
 import (
 	"auth/config"
+	"auth/internal/mfa"
 	"auth/internal/store"
 	"context"
-	"crypto/aes"
-	"crypto/cipher"
 	"crypto/rand"
 	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
 	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"fmt"
-	"io"
 	"log/slog"
+	"net"
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+const (
+	refreshTokenBytes = 32
+	// maxDeviceInfoLength is the length of refresh_token.device_info and user_session.user_agent.
+	maxDeviceInfoLength = 512
+)
+
+var (
+	ErrInvalidToken        = errors.New("invalid access token")
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrRefreshTokenExpired = errors.New("refresh token expired")
+	ErrRefreshTokenReused  = errors.New("refresh token reuse detected")
+	ErrTokenRevoked        = errors.New("token has been revoked")
+	ErrInvalidUserToken    = errors.New("invalid or expired token")
+	ErrEmailNotVerified    = errors.New("email is not verified")
+	ErrUserDeactivated     = errors.New("user is deactivated")
 )
 
 type AuthService struct {
-	config *config.AuthConfig
-	logger *slog.Logger
-	ctx    *context.Context
+	config       *config.AuthConfig
+	keys         *KeySet
+	storeService store.UserStore
+	denylist     *denylist
+	logger       *slog.Logger
 }
 
-func NewAuthService(config *config.AuthConfig, logger *slog.Logger, ctx *context.Context) *AuthService {
+func NewAuthService(config *config.AuthConfig, keys *KeySet, storeService store.UserStore, logger *slog.Logger) *AuthService {
 	return &AuthService{
-		config: config,
-		logger: logger,
-		ctx:    ctx,
+		config:       config,
+		keys:         keys,
+		storeService: storeService,
+		denylist:     newDenylist(),
+		logger:       logger,
 	}
 }
 
-func (as *AuthService) CreateToken(user *store.User) (*Token, error) {
-	accessToken, _, err := as.createAccessToken(user.Id, user.Email, false, time.Minute*15)
+// CheckUser reports whether tokens may be issued to the user.
+func (as *AuthService) CheckUser(user *store.User) error {
+	if !user.IsActive {
+		return ErrUserDeactivated
+	}
+	if as.config.RequireVerifiedEmail && !user.EmailVerified {
+		return ErrEmailNotVerified
+	}
+
+	return nil
+}
+
+// CreateToken issues an access token and a refresh token starting a new token family,
+// which is recorded as a session of the user on the device.
+func (as *AuthService) CreateToken(ctx context.Context, user *store.User, clientIP, deviceInfo string) (*Token, error) {
+	err := as.CheckUser(user)
 	if err != nil {
 		return nil, err
 	}
+	clientIP = parseClientIP(clientIP)
+	deviceInfo = truncateDeviceInfo(deviceInfo)
 
-	refreshToken, err := as.createRefreshToken(accessToken)
+	familyID, err := uuid.NewRandom()
+	if err != nil {
+		return nil, fmt.Errorf("error generating token family ID: %w", err)
+	}
+
+	accessToken, claims, err := as.createAccessToken(ctx, user, as.config.AccessTokenTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, record, err := as.createRefreshToken(user.Id, familyID.String(), claims.RegisteredClaims.ID, deviceInfo)
+	if err != nil {
+		return nil, err
+	}
+
+	err = as.storeService.WithTx(ctx, func(tx store.UserStore) error {
+		err := tx.CreateSession(ctx, &store.Session{
+			Id:         record.FamilyId,
+			UserId:     user.Id,
+			IpAddress:  clientIP,
+			UserAgent:  deviceInfo,
+			CreatedAt:  record.CreatedAt,
+			LastUsedAt: record.CreatedAt,
+		})
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.CreateRefreshToken(ctx, record)
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -49,15 +121,18 @@ func (as *AuthService) CreateToken(user *store.User) (*Token, error) {
 	}, nil
 }
 
-func (as *AuthService) createAccessToken(id int64, email string, isAdmin bool, duration time.Duration) (string, *UserClaims, error) {
-	claims, err := NewUserClaims(id, email, isAdmin, duration)
+func (as *AuthService) createAccessToken(ctx context.Context, user *store.User, duration time.Duration) (string, *UserClaims, error) {
+	role, err := as.storeService.FindUserRole(ctx, user.Id)
 	if err != nil {
 		return "", nil, err
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	claims, err := NewUserClaims(user.Id, user.Email, role.RoleName, role.JobRoleName, role.RoleName == store.RoleAdmin, duration)
+	if err != nil {
+		return "", nil, err
+	}
 
-	signedToken, err := token.SignedString([]byte(as.config.SecretKey))
+	signedToken, err := as.keys.sign(claims)
 	if err != nil {
 		return "", nil, fmt.Errorf("failed to sign token: %w", err)
 	}
@@ -66,85 +141,495 @@ func (as *AuthService) createAccessToken(id int64, email string, isAdmin bool, d
 }
 
 func (as *AuthService) VerifyToken(accessToken string) (*UserClaims, error) {
-	token, err := jwt.ParseWithClaims(accessToken, &UserClaims{}, func(token *jwt.Token) (interface{}, error) {
-		_, ok := token.Method.(*jwt.SigningMethodHMAC)
-		if !ok {
-			return nil, fmt.Errorf("invalid token signing method")
-		}
-
-		return []byte(as.config.SecretKey), nil
-	})
+	token, err := jwt.ParseWithClaims(accessToken, &UserClaims{}, as.keys.keyFunc)
 	if err != nil {
-		return nil, fmt.Errorf("error parsing token")
+		return nil, ErrInvalidToken
+	}
+
+	claims, ok := token.Claims.(*UserClaims)
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+	claims.normalize()
+
+	if as.denylist.contains(claims.RegisteredClaims.ID) {
+		return nil, ErrTokenRevoked
+	}
+
+	return claims, nil
+}
+
+// VerifyExpiredToken checks the access token signature like VerifyToken does,
+// but still returns the claims if the only problem with the token is that it has expired.
+func (as *AuthService) VerifyExpiredToken(accessToken string) (*UserClaims, error) {
+	token, err := jwt.ParseWithClaims(accessToken, &UserClaims{}, as.keys.keyFunc)
+	if err != nil && !errors.Is(err, jwt.ErrTokenExpired) {
+		return nil, ErrInvalidToken
 	}
 
 	claims, ok := token.Claims.(*UserClaims)
 	if !ok {
-		return nil, fmt.Errorf("invalid token claims")
+		return nil, ErrInvalidToken
 	}
+	claims.normalize()
 
 	return claims, nil
 }
 
-func (as *AuthService) createRefreshToken(accessToken string) (string, error) {
-	sha256 := sha256.New()
-	io.WriteString(sha256, as.config.SecretKey)
+// createRefreshToken generates an opaque refresh token. Only its hash is kept in the returned record.
+func (as *AuthService) createRefreshToken(userID int64, familyID, accessTokenID, deviceInfo string) (string, *store.RefreshToken, error) {
+	raw := make([]byte, refreshTokenBytes)
+	_, err := rand.Read(raw)
+	if err != nil {
+		return "", nil, fmt.Errorf("error generating refresh token: %w", err)
+	}
 
-	salt := string(sha256.Sum(nil))[0:16]
-	block, err := aes.NewCipher([]byte(salt))
+	refreshToken := base64.RawURLEncoding.EncodeToString(raw)
+	now := time.Now()
+
+	return refreshToken, &store.RefreshToken{
+		UserId:        userID,
+		FamilyId:      familyID,
+		TokenHash:     hashToken(refreshToken),
+		AccessTokenId: accessTokenID,
+		DeviceInfo:    deviceInfo,
+		CreatedAt:     now.Unix(),
+		ExpiresAt:     now.Add(as.config.RefreshTokenTTL).Unix(),
+	}, nil
+}
+
+// VerifyRefreshToken looks up the stored refresh token and checks that it is still usable
+// and that it was issued together with the given access token.
+// Presenting a refresh token that was already rotated revokes its whole family.
+func (as *AuthService) VerifyRefreshToken(ctx context.Context, token *Token) (*store.RefreshToken, *UserClaims, error) {
+	record, err := as.storeService.FindRefreshTokenByHash(ctx, hashToken(token.Refresh))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil, ErrInvalidRefreshToken
+	}
 	if err != nil {
-		fmt.Println(err.Error())
+		return nil, nil, err
+	}
 
-		return "", err
+	if record.RevokedAt != nil {
+		return nil, nil, ErrInvalidRefreshToken
+	}
+
+	if record.UsedAt != nil {
+		return nil, nil, as.revokeReusedFamily(ctx, record)
 	}
 
-	gcm, err := cipher.NewGCM(block)
+	if time.Now().Unix() >= record.ExpiresAt {
+		return nil, nil, ErrRefreshTokenExpired
+	}
+
+	claims, err := as.VerifyExpiredToken(token.Access)
 	if err != nil {
-		return "", err
+		return nil, nil, err
 	}
 
-	nonce := make([]byte, gcm.NonceSize())
-	_, err = io.ReadFull(rand.Reader, nonce)
+	if claims.RegisteredClaims.ID != record.AccessTokenId || claims.ID != record.UserId {
+		return nil, nil, ErrInvalidRefreshToken
+	}
+
+	return record, claims, nil
+}
+
+// RefreshToken validates the access/refresh pair and rotates it: the presented refresh token
+// is marked as used and a new pair in the same family is returned.
+// An expired access token is accepted only because it is paired with a valid refresh token.
+// The session of the family is marked as used from clientIP and deviceInfo.
+func (as *AuthService) RefreshToken(ctx context.Context, token *Token, clientIP, deviceInfo string) (*Token, error) {
+	clientIP = parseClientIP(clientIP)
+	deviceInfo = truncateDeviceInfo(deviceInfo)
+
+	record, claims, err := as.VerifyRefreshToken(ctx, token)
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+
+	user, err := as.storeService.FindUserById(ctx, claims.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = as.CheckUser(user)
+	if err != nil {
+		return nil, err
+	}
+
+	accessToken, newClaims, err := as.createAccessToken(ctx, user, as.config.AccessTokenTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, newRecord, err := as.createRefreshToken(user.Id, record.FamilyId, newClaims.RegisteredClaims.ID, deviceInfo)
+	if err != nil {
+		return nil, err
+	}
+
+	err = as.storeService.WithTx(ctx, func(tx store.UserStore) error {
+		_, err := tx.RotateRefreshToken(ctx, record.Id, newRecord.CreatedAt, newRecord)
+		if err != nil {
+			return err
+		}
+
+		return tx.TouchSession(ctx, record.FamilyId, newRecord.CreatedAt, clientIP, deviceInfo)
+	})
+	if errors.Is(err, store.ErrRefreshTokenUsed) {
+		return nil, as.revokeReusedFamily(ctx, record)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &Token{
+		Access:  accessToken,
+		Refresh: refreshToken,
+	}, nil
+}
+
+func (as *AuthService) revokeReusedFamily(ctx context.Context, record *store.RefreshToken) error {
+	as.logger.Warn("refresh token reuse detected, revoking token family",
+		"user_id", record.UserId, "family_id", record.FamilyId)
+
+	err := as.storeService.RevokeRefreshTokenFamily(ctx, record.FamilyId, time.Now().Unix())
+	if err != nil {
+		return err
 	}
 
-	refreshToken := base64.URLEncoding.EncodeToString(gcm.Seal(nonce, nonce, []byte(accessToken), nil))
+	return ErrRefreshTokenReused
+}
+
+// RevokeToken denylists the access token and revokes the refresh token family it was issued with.
+func (as *AuthService) RevokeToken(ctx context.Context, claims *UserClaims) error {
+	now := time.Now().Unix()
+
+	record, err := as.storeService.FindRefreshTokenByAccessTokenId(ctx, claims.RegisteredClaims.ID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	if record != nil {
+		err = as.storeService.RevokeRefreshTokenFamily(ctx, record.FamilyId, now)
+		if err != nil {
+			return err
+		}
+	}
+
+	return as.revokeAccessTokens(ctx, claims.ID, []store.RevokedToken{{
+		Jti:       claims.RegisteredClaims.ID,
+		UserId:    claims.ID,
+		ExpiresAt: claims.ExpiresAt.Unix(),
+		RevokedAt: now,
+	}})
+}
+
+// RevokeUserTokens revokes all refresh tokens of the user and denylists every access token
+// that may still be valid, logging the user out everywhere.
+func (as *AuthService) RevokeUserTokens(ctx context.Context, userID int64) error {
+	return as.revokeUserTokens(ctx, userID, "")
+}
+
+// RevokeOtherTokens logs the user out of every session except the one the access token belongs to.
+func (as *AuthService) RevokeOtherTokens(ctx context.Context, claims *UserClaims) error {
+	record, err := as.storeService.FindRefreshTokenByAccessTokenId(ctx, claims.RegisteredClaims.ID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	if record == nil {
+		return as.revokeUserTokens(ctx, claims.ID, "")
+	}
 
-	return refreshToken, nil
+	return as.revokeUserTokens(ctx, claims.ID, record.FamilyId)
 }
 
-func (as *AuthService) VerifyRefreshToken(token *Token) error {
-	sha256 := sha256.New()
-	io.WriteString(sha256, as.config.SecretKey)
+func (as *AuthService) revokeUserTokens(ctx context.Context, userID int64, keepFamilyID string) error {
+	now := time.Now()
 
-	salt := string(sha256.Sum(nil))[0:16]
-	block, err := aes.NewCipher([]byte(salt))
+	accessTokenIDs, err := as.storeService.RevokeUserRefreshTokens(ctx, userID, keepFamilyID, now.Unix(), now.Add(-as.config.AccessTokenTTL).Unix())
 	if err != nil {
 		return err
 	}
 
-	gcm, err := cipher.NewGCM(block)
+	return as.revokeAccessTokens(ctx, userID, as.revokedTokens(userID, accessTokenIDs, now))
+}
+
+// ActiveSessions returns the sessions of the user that can still refresh their tokens, most recently used first.
+func (as *AuthService) ActiveSessions(ctx context.Context, userID int64) ([]store.Session, error) {
+	return as.storeService.FindActiveSessions(ctx, userID, time.Now().Unix())
+}
+
+// CurrentSessionId returns the id of the session the access token was issued in, empty if it is unknown.
+func (as *AuthService) CurrentSessionId(ctx context.Context, claims *UserClaims) (string, error) {
+	record, err := as.storeService.FindRefreshTokenByAccessTokenId(ctx, claims.RegisteredClaims.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return record.FamilyId, nil
+}
+
+// RevokeSession logs the user out of one session, denylisting the access tokens it may still use.
+// sql.ErrNoRows is returned if the user has no active session with the id.
+func (as *AuthService) RevokeSession(ctx context.Context, userID int64, sessionID string) error {
+	now := time.Now()
+
+	accessTokenIDs, err := as.storeService.RevokeSession(ctx, userID, sessionID, now.Unix(), now.Add(-as.config.AccessTokenTTL).Unix())
 	if err != nil {
 		return err
 	}
 
-	data, err := base64.URLEncoding.DecodeString(token.Refresh)
+	return as.revokeAccessTokens(ctx, userID, as.revokedTokens(userID, accessTokenIDs, now))
+}
+
+// revokedTokens denylists the access tokens until the latest moment they can expire.
+func (as *AuthService) revokedTokens(userID int64, accessTokenIDs []string, now time.Time) []store.RevokedToken {
+	tokens := make([]store.RevokedToken, 0, len(accessTokenIDs))
+	for _, accessTokenID := range accessTokenIDs {
+		tokens = append(tokens, store.RevokedToken{
+			Jti:       accessTokenID,
+			UserId:    userID,
+			ExpiresAt: now.Add(as.config.AccessTokenTTL).Unix(),
+			RevokedAt: now.Unix(),
+		})
+	}
+
+	return tokens
+}
+
+func (as *AuthService) revokeAccessTokens(ctx context.Context, userID int64, tokens []store.RevokedToken) error {
+	err := as.storeService.CreateRevokedTokens(ctx, tokens)
 	if err != nil {
 		return err
 	}
 
-	nonceSize := gcm.NonceSize()
-	nonce, ciphertext := data[:nonceSize], data[nonceSize:]
+	for _, token := range tokens {
+		as.denylist.add(token.Jti, token.ExpiresAt)
+	}
+
+	as.logger.Info("access tokens revoked", "user_id", userID, "count", len(tokens))
+	return nil
+}
 
-	plain, err := gcm.Open(nil, nonce, ciphertext, nil)
+// LoadRevokedTokens fills the in-memory denylist with the revoked tokens that have not expired yet.
+func (as *AuthService) LoadRevokedTokens(ctx context.Context) error {
+	now := time.Now()
+	tokens, err := as.storeService.FindRevokedTokens(ctx, now.Unix())
 	if err != nil {
 		return err
 	}
 
-	if string(plain) != token.Access {
-		return errors.New("invalid token")
+	entries := make(map[string]int64, len(tokens))
+	for _, token := range tokens {
+		entries[token.Jti] = token.ExpiresAt
 	}
+	as.denylist.merge(entries, now)
 
 	return nil
 }
+
+// SyncRevokedTokens periodically reloads the denylist, so revocations made by other instances
+// are picked up, and removes expired entries from the database. It returns once ctx is done.
+func (as *AuthService) SyncRevokedTokens(ctx context.Context) {
+	ticker := time.NewTicker(as.config.DenylistSync)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			as.syncRevokedTokens(ctx)
+		}
+	}
+}
+
+// syncRevokedTokens runs one sync, which may take at most one sync interval.
+func (as *AuthService) syncRevokedTokens(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, as.config.DenylistSync)
+	defer cancel()
+
+	err := as.storeService.DeleteExpiredRevokedTokens(ctx, time.Now().Unix())
+	if err != nil {
+		as.logger.Error("failed to delete expired revoked tokens", "err", err.Error())
+	}
+
+	err = as.LoadRevokedTokens(ctx)
+	if err != nil {
+		as.logger.Error("failed to reload revoked tokens", "err", err.Error())
+		as.denylist.prune(time.Now())
+	}
+}
+
+// IssuePasswordResetToken creates a single-use password reset token for the user.
+func (as *AuthService) IssuePasswordResetToken(ctx context.Context, userID int64) (string, error) {
+	return as.issueUserToken(ctx, userID, store.TokenPurposePasswordReset, "", as.config.PasswordResetTTL)
+}
+
+func (as *AuthService) VerifyPasswordResetToken(ctx context.Context, token string) (*store.UserToken, error) {
+	return as.verifyUserToken(ctx, store.TokenPurposePasswordReset, token)
+}
+
+// IssueEmailVerificationToken creates a single-use token confirming the email of the user.
+func (as *AuthService) IssueEmailVerificationToken(ctx context.Context, userID int64) (string, error) {
+	return as.issueUserToken(ctx, userID, store.TokenPurposeEmailVerification, "", as.config.EmailVerificationTTL)
+}
+
+func (as *AuthService) VerifyEmailVerificationToken(ctx context.Context, token string) (*store.UserToken, error) {
+	return as.verifyUserToken(ctx, store.TokenPurposeEmailVerification, token)
+}
+
+// IssueEmailChangeToken creates a single-use token that changes the email of the user to newEmail.
+func (as *AuthService) IssueEmailChangeToken(ctx context.Context, userID int64, newEmail string) (string, error) {
+	return as.issueUserToken(ctx, userID, store.TokenPurposeEmailChange, newEmail, as.config.EmailVerificationTTL)
+}
+
+func (as *AuthService) VerifyEmailChangeToken(ctx context.Context, token string) (*store.UserToken, error) {
+	return as.verifyUserToken(ctx, store.TokenPurposeEmailChange, token)
+}
+
+// CreateMfaChallenge issues a short-lived single-use token standing in for the password in the second login step.
+func (as *AuthService) CreateMfaChallenge(ctx context.Context, user *store.User) (*MfaChallenge, error) {
+	err := as.CheckUser(user)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := as.issueUserToken(ctx, user.Id, store.TokenPurposeMfaChallenge, "", as.config.MfaChallengeTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	return &MfaChallenge{
+		MfaRequired: true,
+		MfaToken:    token,
+		ExpiresIn:   int(as.config.MfaChallengeTTL.Seconds()),
+	}, nil
+}
+
+func (as *AuthService) VerifyMfaChallenge(ctx context.Context, token string) (*store.UserToken, error) {
+	return as.verifyUserToken(ctx, store.TokenPurposeMfaChallenge, token)
+}
+
+// CreateWebAuthnSession stores the session of a passkey ceremony and returns the token the client
+// passes back to finish it. purpose is TokenPurposeWebAuthnRegistration or TokenPurposeWebAuthnLogin.
+func (as *AuthService) CreateWebAuthnSession(ctx context.Context, userID int64, purpose, session string, ttl time.Duration) (string, error) {
+	return as.issueUserToken(ctx, userID, purpose, session, ttl)
+}
+
+func (as *AuthService) VerifyWebAuthnSession(ctx context.Context, purpose, token string) (*store.UserToken, error) {
+	return as.verifyUserToken(ctx, purpose, token)
+}
+
+// TotpProvisioningURI returns the otpauth:// URI enrolling the secret in an authenticator app.
+func (as *AuthService) TotpProvisioningURI(account, secret string) string {
+	return mfa.ProvisioningURI(as.config.TotpIssuer, account, secret)
+}
+
+// VerificationResendAfter returns how long the user has to wait before another verification mail may be sent.
+func (as *AuthService) VerificationResendAfter(ctx context.Context, userID int64) (time.Duration, error) {
+	lastSent, err := as.storeService.FindLastUserTokenTime(ctx, userID, store.TokenPurposeEmailVerification)
+	if err != nil {
+		return 0, err
+	}
+
+	wait := time.Until(time.Unix(lastSent, 0).Add(as.config.VerificationResendInterval))
+	if wait < 0 {
+		return 0, nil
+	}
+
+	return wait, nil
+}
+
+// issueUserToken stores the hash of a new random token; the token itself is only returned to be sent to the user.
+func (as *AuthService) issueUserToken(ctx context.Context, userID int64, purpose, payload string, ttl time.Duration) (string, error) {
+	raw := make([]byte, refreshTokenBytes)
+	_, err := rand.Read(raw)
+	if err != nil {
+		return "", fmt.Errorf("error generating token: %w", err)
+	}
+
+	token := base64.RawURLEncoding.EncodeToString(raw)
+	now := time.Now()
+
+	_, err = as.storeService.CreateUserToken(ctx, &store.UserToken{
+		UserId:    userID,
+		Purpose:   purpose,
+		TokenHash: hashToken(token),
+		Payload:   payload,
+		CreatedAt: now.Unix(),
+		ExpiresAt: now.Add(ttl).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+func (as *AuthService) verifyUserToken(ctx context.Context, purpose, token string) (*store.UserToken, error) {
+	record, err := as.storeService.FindUserTokenByHash(ctx, purpose, hashToken(token))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInvalidUserToken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if record.UsedAt != nil || time.Now().Unix() >= record.ExpiresAt {
+		return nil, ErrInvalidUserToken
+	}
+
+	return record, nil
+}
+
+// VerifyClient checks the credentials of a service that is allowed to introspect tokens.
+func (as *AuthService) VerifyClient(clientID, clientSecret string) bool {
+	valid := 0
+	for _, client := range as.config.IntrospectionClients {
+		id, secret, ok := strings.Cut(strings.TrimSpace(client), ":")
+		if !ok {
+			continue
+		}
+
+		idMatch := subtle.ConstantTimeCompare([]byte(id), []byte(clientID))
+		secretMatch := subtle.ConstantTimeCompare([]byte(secret), []byte(clientSecret))
+		valid |= idMatch & secretMatch
+	}
+
+	return valid == 1
+}
+
+// JWKS returns the public keys access tokens can be verified with.
+func (as *AuthService) JWKS() JWKS {
+	return as.keys.JWKS()
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// parseClientIP returns the canonical form of the client IP, which fits user_session.ip_address.
+// Anything but a single address, e.g. a list of hops from a proxy header, is dropped.
+func parseClientIP(clientIP string) string {
+	ip := net.ParseIP(strings.TrimSpace(clientIP))
+	if ip == nil {
+		return ""
+	}
+
+	return ip.String()
+}
+
+// truncateDeviceInfo makes the user agent sent by the client fit the columns it is stored in.
+// Invalid UTF-8 is dropped, Postgres would reject it.
+func truncateDeviceInfo(deviceInfo string) string {
+	deviceInfo = strings.ToValidUTF8(deviceInfo, "")
+	if utf8.RuneCountInString(deviceInfo) <= maxDeviceInfoLength {
+		return deviceInfo
+	}
+
+	return string([]rune(deviceInfo)[:maxDeviceInfoLength])
+}
@@ -0,0 +1,26 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseClientIP(t *testing.T) {
+	tests := []struct {
+		clientIP string
+		want     string
+	}{
+		{"203.0.113.7", "203.0.113.7"},
+		{" 203.0.113.7 ", "203.0.113.7"},
+		{"2001:0db8:0000:0000:0000:0000:0000:0001", "2001:db8::1"},
+		{"::ffff:192.0.2.1", "192.0.2.1"},
+		{"203.0.113.7, 10.0.0.1", ""},
+		{strings.Repeat("1", 100), ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := parseClientIP(tt.clientIP); got != tt.want {
+			t.Errorf("parseClientIP(%q) = %q, want %q", tt.clientIP, got, tt.want)
+		}
+	}
+}
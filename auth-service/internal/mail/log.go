@@ -0,0 +1,52 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// LogMailer writes messages to the service log instead of sending them. Meant for local development.
+type LogMailer struct {
+	logger *slog.Logger
+}
+
+func NewLogMailer(logger *slog.Logger) *LogMailer {
+	return &LogMailer{
+		logger: logger,
+	}
+}
+
+func (lm *LogMailer) Send(ctx context.Context, message Message) error {
+	lm.logger.InfoContext(ctx, "mail", "to", message.To, "subject", message.Subject, "body", message.Body)
+	return nil
+}
+
+// FileMailer appends messages to a file, so tests and local setups can pick up the links they contain.
+type FileMailer struct {
+	path string
+	mu   sync.Mutex
+}
+
+func NewFileMailer(path string) *FileMailer {
+	return &FileMailer{
+		path: path,
+	}
+}
+
+func (fm *FileMailer) Send(ctx context.Context, message Message) error {
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+
+	file, err := os.OpenFile(fm.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = fmt.Fprintf(file, "Date: %s\nTo: %s\nSubject: %s\n\n%s\n\n", time.Now().Format(time.RFC1123Z), message.To, message.Subject, message.Body)
+	return err
+}
@@ -0,0 +1,39 @@
+package mail
+
+import (
+	"auth/config"
+	"context"
+	"fmt"
+	"log/slog"
+)
+
+const (
+	DriverLog  = "log"
+	DriverFile = "file"
+	DriverSMTP = "smtp"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers messages to users, e.g. password reset links.
+type Mailer interface {
+	Send(ctx context.Context, message Message) error
+}
+
+// NewMailer creates the mailer selected by MAIL_DRIVER.
+func NewMailer(config *config.MailConfig, logger *slog.Logger) (Mailer, error) {
+	switch config.Driver {
+	case "", DriverLog:
+		return NewLogMailer(logger), nil
+	case DriverFile:
+		return NewFileMailer(config.FilePath), nil
+	case DriverSMTP:
+		return NewSMTPMailer(config), nil
+	default:
+		return nil, fmt.Errorf("unsupported mail driver %q", config.Driver)
+	}
+}
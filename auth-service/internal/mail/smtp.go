@@ -0,0 +1,52 @@
+package mail
+
+import (
+	"auth/config"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+)
+
+type SMTPMailer struct {
+	config *config.MailConfig
+}
+
+func NewSMTPMailer(config *config.MailConfig) *SMTPMailer {
+	return &SMTPMailer{
+		config: config,
+	}
+}
+
+func (sm *SMTPMailer) Send(ctx context.Context, message Message) error {
+	if strings.ContainsAny(message.To+message.Subject, "\r\n") {
+		return errors.New("invalid mail header")
+	}
+
+	var auth smtp.Auth
+	if sm.config.Username != "" {
+		auth = smtp.PlainAuth("", sm.config.Username, sm.config.Password, sm.config.Host)
+	}
+
+	var body strings.Builder
+	fmt.Fprintf(&body, "From: %s\r\n", sm.config.From)
+	fmt.Fprintf(&body, "To: %s\r\n", message.To)
+	fmt.Fprintf(&body, "Subject: %s\r\n", message.Subject)
+	body.WriteString("MIME-Version: 1.0\r\n")
+	body.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	body.WriteString(message.Body)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- smtp.SendMail(net.JoinHostPort(sm.config.Host, sm.config.Port), auth, sm.config.From, []string{message.To}, []byte(body.String()))
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
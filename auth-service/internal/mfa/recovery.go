@@ -0,0 +1,43 @@
+package mfa
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// RecoveryCodeCount is the number of recovery codes generated at once.
+const RecoveryCodeCount = 10
+
+const recoveryCodeBytes = 5
+
+var recoveryEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateRecoveryCodes returns RecoveryCodeCount single-use codes like abcd-efgh. Only their hashes are stored.
+func GenerateRecoveryCodes() ([]string, error) {
+	codes := make([]string, 0, RecoveryCodeCount)
+	for i := 0; i < RecoveryCodeCount; i++ {
+		raw := make([]byte, recoveryCodeBytes)
+		_, err := rand.Read(raw)
+		if err != nil {
+			return nil, fmt.Errorf("error generating recovery code: %w", err)
+		}
+
+		code := strings.ToLower(recoveryEncoding.EncodeToString(raw))
+		codes = append(codes, code[:4]+"-"+code[4:])
+	}
+
+	return codes, nil
+}
+
+// HashRecoveryCode hashes the code for storage. Case, spaces and dashes are ignored.
+func HashRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	code = strings.NewReplacer("-", "", " ", "").Replace(code)
+
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,51 @@
+package mfa
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var recoveryCodeFormat = regexp.MustCompile(`^[a-z2-7]{4}-[a-z2-7]{4}$`)
+
+func TestGenerateRecoveryCodes(t *testing.T) {
+	codes, err := GenerateRecoveryCodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != RecoveryCodeCount {
+		t.Fatalf("got %d codes, want %d", len(codes), RecoveryCodeCount)
+	}
+
+	hashes := make(map[string]bool)
+	for _, code := range codes {
+		if !recoveryCodeFormat.MatchString(code) {
+			t.Errorf("code %q does not look like abcd-efgh", code)
+		}
+
+		hash := HashRecoveryCode(code)
+		if hashes[hash] {
+			t.Errorf("code %q generated twice", code)
+		}
+		hashes[hash] = true
+	}
+}
+
+func TestHashRecoveryCode(t *testing.T) {
+	const code = "abcd-efgh"
+	hash := HashRecoveryCode(code)
+
+	for _, typed := range []string{"abcd-efgh", "ABCD-EFGH", "abcdefgh", "abcd efgh", " abcd-efgh "} {
+		if got := HashRecoveryCode(typed); got != hash {
+			t.Errorf("code typed as %q hashes differently", typed)
+		}
+	}
+	for _, other := range []string{"abcd-efgi", "abcd-efg", ""} {
+		if HashRecoveryCode(other) == hash {
+			t.Errorf("code %q hashes like %q", other, code)
+		}
+	}
+	if strings.Contains(hash, "abcd") {
+		t.Errorf("hash %q contains the code", hash)
+	}
+}
@@ -0,0 +1,106 @@
+package mfa
+
+import (
+	"testing"
+	"time"
+)
+
+// secret of the RFC 6238 appendix B test vectors for HMAC-SHA1, "12345678901234567890" in base32
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// rfcVectors are the SHA1 test vectors of RFC 6238 appendix B, cut to the last 6 digits of the 8 digit codes.
+var rfcVectors = []struct {
+	unix int64
+	code string
+}{
+	{59, "287082"},
+	{1111111109, "081804"},
+	{1111111111, "050471"},
+	{1234567890, "005924"},
+	{2000000000, "279037"},
+	{20000000000, "353130"},
+}
+
+func TestCode(t *testing.T) {
+	for _, tt := range rfcVectors {
+		code, err := Code(rfcSecret, Step(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != tt.code {
+			t.Errorf("code at %d = %s, want %s", tt.unix, code, tt.code)
+		}
+	}
+
+	// authenticator apps may show the secret in lower case
+	code, err := Code("gezdgnbvgy3tqojqgezdgnbvgy3tqojq", Step(time.Unix(59, 0)))
+	if err != nil || code != "287082" {
+		t.Errorf("lower case secret: got %s, %v", code, err)
+	}
+
+	_, err = Code("not base32!", 1)
+	if err == nil {
+		t.Error("invalid secret accepted")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, tt := range rfcVectors {
+		at := time.Unix(tt.unix, 0)
+		wantStep := Step(at)
+
+		tests := []struct {
+			name   string
+			now    time.Time
+			wantOk bool
+		}{
+			{"same step", at, true},
+			{"one step later", at.Add(period * time.Second), true},
+			{"one step earlier", at.Add(-period * time.Second), true},
+			{"two steps later", at.Add(2 * period * time.Second), false},
+			{"two steps earlier", at.Add(-2 * period * time.Second), false},
+		}
+		for _, check := range tests {
+			if check.now.Unix() < 0 {
+				// steps before the epoch are not counted, the first vector has no two steps earlier
+				continue
+			}
+			step, ok := Validate(rfcSecret, tt.code, check.now)
+			if ok != check.wantOk {
+				t.Errorf("%s code at %d: got ok %t, want %t", check.name, tt.unix, ok, check.wantOk)
+				continue
+			}
+			if ok && step != wantStep {
+				t.Errorf("%s code at %d: got step %d, want %d", check.name, tt.unix, step, wantStep)
+			}
+		}
+	}
+
+	at := time.Unix(59, 0)
+	for _, code := range []string{"", "28708", "2870820", "287083", "abcdef"} {
+		if _, ok := Validate(rfcSecret, code, at); ok {
+			t.Errorf("code %q accepted", code)
+		}
+	}
+	if _, ok := Validate(rfcSecret, " 287082 ", at); !ok {
+		t.Error("code with surrounding spaces rejected")
+	}
+	if _, ok := Validate("not base32!", "287082", at); ok {
+		t.Error("code of an invalid secret accepted")
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := secretEncoding.DecodeString(secret)
+	if err != nil {
+		t.Fatalf("secret %q is not base32: %v", secret, err)
+	}
+	if len(key) != secretBytes {
+		t.Errorf("got %d secret bytes, want %d", len(key), secretBytes)
+	}
+}
@@ -0,0 +1,297 @@
+package migration
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+//go:embed sql/*.sql
+var files embed.FS
+
+// lockID serializes migrations of several instances starting at once, it is an arbitrary constant.
+const lockID = 7_402_113
+
+var fileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+type Status struct {
+	Version   int
+	Name      string
+	AppliedAt *int64
+}
+
+type Migrator struct {
+	db         *sql.DB
+	logger     *slog.Logger
+	migrations []Migration
+}
+
+func NewMigrator(db *sql.DB, logger *slog.Logger) (*Migrator, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{
+		db:         db,
+		logger:     logger,
+		migrations: migrations,
+	}, nil
+}
+
+// Up applies every migration that has not been applied yet, in order, each in its own transaction.
+func (m *Migrator) Up(ctx context.Context) (int, error) {
+	conn, err := m.lock(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer m.unlock(conn)
+
+	applied, err := appliedVersions(ctx, conn)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, migration := range m.migrations {
+		if _, ok := applied[migration.Version]; ok {
+			continue
+		}
+
+		err = m.run(ctx, conn, migration, migration.Up, `
+			INSERT INTO public.schema_migrations
+			(version, "name", applied_at)
+			VALUES($1, $2, $3)
+		`, migration.Version, migration.Name, time.Now().Unix())
+		if err != nil {
+			return count, err
+		}
+
+		m.logger.Info("migration applied", "version", migration.Version, "name", migration.Name)
+		count++
+	}
+
+	return count, nil
+}
+
+// Down reverts the last steps applied migrations, newest first.
+func (m *Migrator) Down(ctx context.Context, steps int) (int, error) {
+	conn, err := m.lock(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer m.unlock(conn)
+
+	applied, err := appliedVersions(ctx, conn)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for i := len(m.migrations) - 1; i >= 0 && count < steps; i-- {
+		migration := m.migrations[i]
+		if _, ok := applied[migration.Version]; !ok {
+			continue
+		}
+
+		err = m.run(ctx, conn, migration, migration.Down, `
+			DELETE FROM public.schema_migrations
+			WHERE version = $1
+		`, migration.Version)
+		if err != nil {
+			return count, err
+		}
+
+		m.logger.Info("migration reverted", "version", migration.Version, "name", migration.Name)
+		count++
+	}
+
+	return count, nil
+}
+
+// Status lists every known migration with the time it was applied, nil if it is pending.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	err = createTable(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	applied, err := appliedVersions(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		status := Status{
+			Version: migration.Version,
+			Name:    migration.Name,
+		}
+		if appliedAt, ok := applied[migration.Version]; ok {
+			status.AppliedAt = &appliedAt
+		}
+		statuses = append(statuses, status)
+	}
+
+	return statuses, nil
+}
+
+// run executes the migration script and the bookkeeping statement in one transaction.
+func (m *Migrator) run(ctx context.Context, conn *sql.Conn, migration Migration, script, sqlStatement string, args ...any) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, script)
+	if err != nil {
+		return fmt.Errorf("migration %04d_%s: %w", migration.Version, migration.Name, err)
+	}
+
+	_, err = tx.ExecContext(ctx, sqlStatement, args...)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// lock takes the migration lock on a dedicated connection, waiting for other instances to finish.
+func (m *Migrator) lock(ctx context.Context) (*sql.Conn, error) {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, lockID)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	err = createTable(ctx, conn)
+	if err != nil {
+		m.unlock(conn)
+		return nil, err
+	}
+
+	return conn, nil
+}
+
+func (m *Migrator) unlock(conn *sql.Conn) {
+	_, err := conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, lockID)
+	if err != nil {
+		m.logger.Error("failed to release migration lock", "err", err.Error())
+	}
+	conn.Close()
+}
+
+func createTable(ctx context.Context, conn *sql.Conn) error {
+	sqlStatement := `
+		CREATE TABLE IF NOT EXISTS public.schema_migrations (
+			version integer PRIMARY KEY,
+			"name" varchar(256) NOT NULL,
+			applied_at bigint NOT NULL
+		)
+	`
+	_, err := conn.ExecContext(ctx, sqlStatement)
+	return err
+}
+
+// appliedVersions maps the applied migration versions to the time they were applied.
+func appliedVersions(ctx context.Context, conn *sql.Conn) (map[int]int64, error) {
+	sqlStatement := `
+		SELECT version, applied_at
+		FROM public.schema_migrations
+	`
+	rows, err := conn.QueryContext(ctx, sqlStatement)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]int64)
+	for rows.Next() {
+		var version int
+		var appliedAt int64
+		err = rows.Scan(&version, &appliedAt)
+		if err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+
+	return applied, rows.Err()
+}
+
+// loadMigrations reads the embedded NNNN_name.up.sql and NNNN_name.down.sql files, ordered by version.
+func loadMigrations() ([]Migration, error) {
+	entries, err := fs.ReadDir(files, "sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		match := fileName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("unexpected migration file %s", entry.Name())
+		}
+
+		version, _ := strconv.Atoi(match[1])
+		content, err := fs.ReadFile(files, path.Join("sql", entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		}
+		if migration.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", version, migration.Name, match[2])
+		}
+
+		if match[3] == "up" {
+			migration.Up = string(content)
+		} else {
+			migration.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("migration %04d_%s needs both an up and a down file", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS video_history;
+DROP TABLE IF EXISTS "user";
+DROP TABLE IF EXISTS address;
+DROP TABLE IF EXISTS settlement_type;
+DROP TABLE IF EXISTS job_role;
+DROP TABLE IF EXISTS role;
@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS refresh_token (
+	id serial PRIMARY KEY,
+	user_id bigint REFERENCES "user"(id) ON DELETE CASCADE NOT NULL,
+	family_id varchar(36) NOT NULL,
+	token_hash varchar(64) NOT NULL UNIQUE,
+	access_token_id varchar(36) NOT NULL,
+	device_info varchar(512),
+	created_at bigint NOT NULL,
+	expires_at bigint NOT NULL,
+	used_at bigint,
+	revoked_at bigint
+);
+
+CREATE INDEX IF NOT EXISTS refresh_token_family_id_idx ON refresh_token(family_id);
+CREATE INDEX IF NOT EXISTS refresh_token_user_id_idx ON refresh_token(user_id);
+CREATE INDEX IF NOT EXISTS refresh_token_access_token_id_idx ON refresh_token(access_token_id);
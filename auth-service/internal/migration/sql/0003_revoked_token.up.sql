@@ -0,0 +1,11 @@
+-- entries outlive deleted users, their tokens stay revoked until they expire
+CREATE TABLE IF NOT EXISTS revoked_token (
+	jti varchar(36) PRIMARY KEY,
+	user_id bigint NOT NULL,
+	expires_at bigint NOT NULL,
+	revoked_at bigint NOT NULL
+);
+
+ALTER TABLE revoked_token DROP CONSTRAINT IF EXISTS revoked_token_user_id_fkey;
+
+CREATE INDEX IF NOT EXISTS revoked_token_expires_at_idx ON revoked_token(expires_at);
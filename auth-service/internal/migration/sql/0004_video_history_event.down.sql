@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS video_history_user_id_created_at_idx;
+
+ALTER TABLE video_history DROP COLUMN IF EXISTS event;
@@ -0,0 +1,3 @@
+ALTER TABLE video_history ADD COLUMN IF NOT EXISTS event varchar(32) NOT NULL DEFAULT 'stream';
+
+CREATE INDEX IF NOT EXISTS video_history_user_id_created_at_idx ON video_history(user_id, created_at);
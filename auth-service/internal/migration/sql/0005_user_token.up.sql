@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS user_token (
+	id serial PRIMARY KEY,
+	user_id bigint REFERENCES "user"(id) ON DELETE CASCADE NOT NULL,
+	purpose varchar(32) NOT NULL,
+	token_hash varchar(64) NOT NULL UNIQUE,
+	payload varchar(256),
+	created_at bigint NOT NULL,
+	expires_at bigint NOT NULL,
+	used_at bigint
+);
+
+CREATE INDEX IF NOT EXISTS user_token_user_id_purpose_idx ON user_token(user_id, purpose);
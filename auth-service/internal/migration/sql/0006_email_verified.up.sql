@@ -0,0 +1,3 @@
+-- users registered before email verification existed count as verified
+ALTER TABLE "user" ADD COLUMN IF NOT EXISTS email_verified boolean NOT NULL DEFAULT true;
+ALTER TABLE "user" ALTER COLUMN email_verified SET DEFAULT false;
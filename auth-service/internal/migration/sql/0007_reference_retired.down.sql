@@ -0,0 +1,2 @@
+ALTER TABLE settlement_type DROP COLUMN IF EXISTS retired;
+ALTER TABLE job_role DROP COLUMN IF EXISTS retired;
@@ -0,0 +1,2 @@
+ALTER TABLE job_role ADD COLUMN IF NOT EXISTS retired boolean NOT NULL DEFAULT false;
+ALTER TABLE settlement_type ADD COLUMN IF NOT EXISTS retired boolean NOT NULL DEFAULT false;
@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS user_totp (
+	user_id bigint PRIMARY KEY REFERENCES "user"(id) ON DELETE CASCADE,
+	secret varchar(64) NOT NULL,
+	created_at bigint NOT NULL,
+	confirmed_at bigint,
+	last_used_step bigint NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS recovery_code (
+	id serial PRIMARY KEY,
+	user_id bigint REFERENCES "user"(id) ON DELETE CASCADE NOT NULL,
+	code_hash varchar(64) NOT NULL,
+	created_at bigint NOT NULL,
+	used_at bigint
+);
+
+CREATE INDEX IF NOT EXISTS recovery_code_user_id_idx ON recovery_code(user_id);
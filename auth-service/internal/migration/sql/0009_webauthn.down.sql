@@ -0,0 +1,4 @@
+DELETE FROM user_token WHERE purpose IN ('webauthn_registration', 'webauthn_login');
+ALTER TABLE user_token ALTER COLUMN payload TYPE varchar(256);
+
+DROP TABLE IF EXISTS webauthn_credential;
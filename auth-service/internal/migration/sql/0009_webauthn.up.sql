@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS webauthn_credential (
+	id serial PRIMARY KEY,
+	user_id bigint REFERENCES "user"(id) ON DELETE CASCADE NOT NULL,
+	credential_id varchar(1400) NOT NULL UNIQUE,
+	name varchar(256) NOT NULL,
+	data text NOT NULL,
+	created_at bigint NOT NULL,
+	last_used_at bigint
+);
+
+CREATE INDEX IF NOT EXISTS webauthn_credential_user_id_idx ON webauthn_credential(user_id);
+
+-- the payload of a passkey ceremony is its WebAuthn session, which does not fit into 256 characters
+ALTER TABLE user_token ALTER COLUMN payload TYPE text;
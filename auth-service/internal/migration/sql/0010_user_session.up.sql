@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS user_session (
+	id varchar(36) PRIMARY KEY,
+	user_id bigint REFERENCES "user"(id) ON DELETE CASCADE NOT NULL,
+	ip_address varchar(45),
+	user_agent varchar(512),
+	created_at bigint NOT NULL,
+	last_used_at bigint NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS user_session_user_id_idx ON user_session(user_id);
+
+-- every refresh token family is a session, the ones issued before sessions were tracked have no IP
+INSERT INTO user_session (id, user_id, user_agent, created_at, last_used_at)
+SELECT family_id, user_id, (array_agg(device_info ORDER BY created_at DESC))[1], min(created_at), max(created_at)
+FROM refresh_token
+GROUP BY family_id, user_id
+ON CONFLICT (id) DO NOTHING;
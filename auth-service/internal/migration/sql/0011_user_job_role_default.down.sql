@@ -0,0 +1 @@
+-- the admin default of job_role_id is not brought back, registration always sets the job role
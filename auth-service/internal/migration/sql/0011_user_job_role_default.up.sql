@@ -0,0 +1,2 @@
+-- job role 1 grants the admin role, users must never end up with it by default
+ALTER TABLE "user" ALTER COLUMN job_role_id DROP DEFAULT;
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS user_email_lower_key;
@@ -0,0 +1,3 @@
+-- emails are unique regardless of case, lookups compare lower(email) and use this index.
+-- Fails if addresses differing only in case are already registered, they have to be merged first
+CREATE UNIQUE INDEX IF NOT EXISTS user_email_lower_key ON "user" (lower(email));
@@ -0,0 +1,257 @@
+package passkey
+
+import (
+	"auth/config"
+	"auth/internal/store"
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+var (
+	ErrInvalidResponse = errors.New("invalid passkey response")
+	ErrClonedPasskey   = errors.New("passkey signature counter went backwards, it may have been cloned")
+)
+
+// PasskeyService runs the WebAuthn registration and login ceremonies. It keeps no state: the session of a
+// ceremony is returned as JSON by the Begin methods and has to be passed back to the Finish methods.
+type PasskeyService struct {
+	webAuthn   *webauthn.WebAuthn
+	sessionTTL time.Duration
+}
+
+func NewPasskeyService(config *config.WebAuthnConfig) (*PasskeyService, error) {
+	timeout := webauthn.TimeoutConfig{Enforce: true, Timeout: config.SessionTTL, TimeoutUVD: config.SessionTTL}
+
+	webAuthn, err := webauthn.New(&webauthn.Config{
+		RPID:          config.RPID,
+		RPDisplayName: config.RPDisplayName,
+		RPOrigins:     config.RPOrigins,
+		// passkeys replace the password and the second factor, so the authenticator has to verify the user
+		AuthenticatorSelection: protocol.AuthenticatorSelection{
+			ResidentKey:      protocol.ResidentKeyRequirementPreferred,
+			UserVerification: protocol.VerificationRequired,
+		},
+		Timeouts: webauthn.TimeoutsConfig{Login: timeout, Registration: timeout},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid webauthn config: %w", err)
+	}
+
+	return &PasskeyService{
+		webAuthn:   webAuthn,
+		sessionTTL: config.SessionTTL,
+	}, nil
+}
+
+// SessionTTL is how long the session of a ceremony is valid.
+func (ps *PasskeyService) SessionTTL() time.Duration {
+	return ps.sessionTTL
+}
+
+// BeginRegistration returns the options for navigator.credentials.create() and the session of the ceremony.
+// The passkeys the user already has are excluded, so an authenticator is not registered twice.
+func (ps *PasskeyService) BeginRegistration(user *store.User, credentials []store.WebAuthnCredential) (*protocol.CredentialCreation, string, error) {
+	webAuthnUser, err := newPasskeyUser(user, credentials)
+	if err != nil {
+		return nil, "", err
+	}
+
+	exclusions := make([]protocol.CredentialDescriptor, 0, len(webAuthnUser.credentials))
+	for _, credential := range webAuthnUser.credentials {
+		exclusions = append(exclusions, credential.Descriptor())
+	}
+
+	options, session, err := ps.webAuthn.BeginRegistration(webAuthnUser, webauthn.WithExclusions(exclusions))
+	if err != nil {
+		return nil, "", err
+	}
+
+	sessionData, err := json.Marshal(session)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return options, string(sessionData), nil
+}
+
+// FinishRegistration verifies the response of navigator.credentials.create() and returns the new passkey.
+// Its Name and CreatedAt are left to the caller.
+func (ps *PasskeyService) FinishRegistration(user *store.User, session string, response []byte) (*store.WebAuthnCredential, error) {
+	webAuthnUser, err := newPasskeyUser(user, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	sessionData, err := parseSession(session)
+	if err != nil {
+		return nil, err
+	}
+
+	parsed, err := protocol.ParseCredentialCreationResponseBody(bytes.NewReader(response))
+	if err != nil {
+		return nil, invalidResponse(err)
+	}
+
+	credential, err := ps.webAuthn.CreateCredential(webAuthnUser, *sessionData, parsed)
+	if err != nil {
+		return nil, invalidResponse(err)
+	}
+
+	data, err := json.Marshal(credential)
+	if err != nil {
+		return nil, err
+	}
+
+	return &store.WebAuthnCredential{
+		UserId:       user.Id,
+		CredentialId: base64.RawURLEncoding.EncodeToString(credential.ID),
+		Data:         string(data),
+	}, nil
+}
+
+// BeginLogin returns the options for navigator.credentials.get(), allowing the given passkeys of the user,
+// and the session of the ceremony.
+func (ps *PasskeyService) BeginLogin(user *store.User, credentials []store.WebAuthnCredential) (*protocol.CredentialAssertion, string, error) {
+	webAuthnUser, err := newPasskeyUser(user, credentials)
+	if err != nil {
+		return nil, "", err
+	}
+
+	options, session, err := ps.webAuthn.BeginLogin(webAuthnUser)
+	if err != nil {
+		return nil, "", err
+	}
+
+	sessionData, err := json.Marshal(session)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return options, string(sessionData), nil
+}
+
+// FinishLogin verifies the response of navigator.credentials.get() and returns the passkey that signed it,
+// with Data holding the updated signature counter. Passkeys whose counter went backwards are rejected.
+func (ps *PasskeyService) FinishLogin(user *store.User, credentials []store.WebAuthnCredential, session string, response []byte) (*store.WebAuthnCredential, error) {
+	webAuthnUser, err := newPasskeyUser(user, credentials)
+	if err != nil {
+		return nil, err
+	}
+
+	sessionData, err := parseSession(session)
+	if err != nil {
+		return nil, err
+	}
+
+	parsed, err := protocol.ParseCredentialRequestResponseBody(bytes.NewReader(response))
+	if err != nil {
+		return nil, invalidResponse(err)
+	}
+
+	credential, err := ps.webAuthn.ValidateLogin(webAuthnUser, *sessionData, parsed)
+	if err != nil {
+		return nil, invalidResponse(err)
+	}
+	if credential.Authenticator.CloneWarning {
+		return nil, ErrClonedPasskey
+	}
+
+	data, err := json.Marshal(credential)
+	if err != nil {
+		return nil, err
+	}
+
+	credentialID := base64.RawURLEncoding.EncodeToString(credential.ID)
+	for _, stored := range credentials {
+		if stored.CredentialId == credentialID {
+			stored.Data = string(data)
+			return &stored, nil
+		}
+	}
+
+	return nil, invalidResponse(errors.New("unknown credential"))
+}
+
+func parseSession(session string) (*webauthn.SessionData, error) {
+	var sessionData webauthn.SessionData
+
+	err := json.Unmarshal([]byte(session), &sessionData)
+	if err != nil {
+		return nil, fmt.Errorf("invalid webauthn session: %w", err)
+	}
+
+	return &sessionData, nil
+}
+
+// invalidResponse wraps the reason the library rejected a response into ErrInvalidResponse.
+func invalidResponse(err error) error {
+	var protocolErr *protocol.Error
+	if errors.As(err, &protocolErr) && protocolErr.Details != "" {
+		return fmt.Errorf("%w: %s", ErrInvalidResponse, protocolErr.Details)
+	}
+
+	return fmt.Errorf("%w: %s", ErrInvalidResponse, err.Error())
+}
+
+// passkeyUser adapts a user and its stored passkeys to webauthn.User.
+type passkeyUser struct {
+	user        *store.User
+	credentials []webauthn.Credential
+}
+
+func newPasskeyUser(user *store.User, credentials []store.WebAuthnCredential) (*passkeyUser, error) {
+	webAuthnUser := &passkeyUser{
+		user:        user,
+		credentials: make([]webauthn.Credential, 0, len(credentials)),
+	}
+
+	for _, stored := range credentials {
+		var credential webauthn.Credential
+		err := json.Unmarshal([]byte(stored.Data), &credential)
+		if err != nil {
+			return nil, fmt.Errorf("invalid data of passkey %d: %w", stored.Id, err)
+		}
+		webAuthnUser.credentials = append(webAuthnUser.credentials, credential)
+	}
+
+	return webAuthnUser, nil
+}
+
+// WebAuthnID is the user id as 8 big endian bytes. It is stored on the authenticator, so it must not
+// contain personal data like the email.
+func (pu *passkeyUser) WebAuthnID() []byte {
+	id := make([]byte, 8)
+	binary.BigEndian.PutUint64(id, uint64(pu.user.Id))
+	return id
+}
+
+func (pu *passkeyUser) WebAuthnName() string {
+	return pu.user.Email
+}
+
+func (pu *passkeyUser) WebAuthnDisplayName() string {
+	name := strings.TrimSpace(pu.user.Name + " " + pu.user.Surname)
+	if name == "" {
+		return pu.user.Email
+	}
+
+	return name
+}
+
+func (pu *passkeyUser) WebAuthnCredentials() []webauthn.Credential {
+	return pu.credentials
+}
+
+// WebAuthnIcon is deprecated by the spec, authenticators ignore it.
+func (pu *passkeyUser) WebAuthnIcon() string {
+	return ""
+}
@@ -0,0 +1,45 @@
+package store
+
+import (
+	"errors"
+
+	"github.com/lib/pq"
+)
+
+var (
+	ErrRefreshTokenUsed = errors.New("refresh token has already been used")
+	ErrUserTokenUsed    = errors.New("token has already been used")
+	ErrTotpStepUsed     = errors.New("code has already been used")
+	ErrDuplicate        = errors.New("already exists")
+)
+
+// uniqueViolationCode is the Postgres error code of unique constraint violations.
+const uniqueViolationCode = "23505"
+
+// DuplicateError is a violation of the named unique constraint. It matches ErrDuplicate.
+type DuplicateError struct {
+	Constraint string
+}
+
+func (e *DuplicateError) Error() string {
+	return ErrDuplicate.Error() + ": " + e.Constraint
+}
+
+func (e *DuplicateError) Unwrap() error {
+	return ErrDuplicate
+}
+
+// translateError turns unique constraint violations into a DuplicateError.
+func translateError(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == uniqueViolationCode {
+		return duplicate(pqErr.Constraint)
+	}
+
+	return err
+}
+
+// duplicate reports a violation of the named unique constraint.
+func duplicate(constraint string) error {
+	return &DuplicateError{Constraint: constraint}
+}
@@ -0,0 +1,1450 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"maps"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// MemoryStore is an in-memory implementation of UserStore for tests and local demos. It starts with the
+// roles, job roles and settlement types seeded by the migrations, and loses everything on restart.
+type MemoryStore struct {
+	data   *memoryData
+	mu     *sync.Mutex
+	inTx   bool
+	logger *slog.Logger
+}
+
+// memoryData holds the tables. Rows are stored by value, so a shallow copy of the maps is a snapshot.
+type memoryData struct {
+	sequences       map[string]int64
+	roles           map[int]Role
+	jobRoles        map[int]JobRole
+	settlementTypes map[int]SettlementType
+	addresses       map[int64]Address
+	users           map[int64]User
+	refreshTokens   map[int64]RefreshToken
+	sessions        map[string]Session
+	revokedTokens   map[string]RevokedToken
+	userTokens      map[int64]UserToken
+	userTotps       map[int64]UserTotp
+	recoveryCodes   map[int64]RecoveryCode
+	credentials     map[int64]WebAuthnCredential
+	videoHistory    map[int64]VideoHistory
+}
+
+func NewMemoryStore(logger *slog.Logger) *MemoryStore {
+	ms := &MemoryStore{
+		data: &memoryData{
+			sequences:       make(map[string]int64),
+			roles:           make(map[int]Role),
+			jobRoles:        make(map[int]JobRole),
+			settlementTypes: make(map[int]SettlementType),
+			addresses:       make(map[int64]Address),
+			users:           make(map[int64]User),
+			refreshTokens:   make(map[int64]RefreshToken),
+			sessions:        make(map[string]Session),
+			revokedTokens:   make(map[string]RevokedToken),
+			userTokens:      make(map[int64]UserToken),
+			userTotps:       make(map[int64]UserTotp),
+			recoveryCodes:   make(map[int64]RecoveryCode),
+			credentials:     make(map[int64]WebAuthnCredential),
+			videoHistory:    make(map[int64]VideoHistory),
+		},
+		mu:     &sync.Mutex{},
+		logger: logger,
+	}
+	ms.seed()
+
+	return ms
+}
+
+func (ms *MemoryStore) seed() {
+	data := ms.data
+	for _, name := range []string{RoleClient, RoleAdmin} {
+		id := int(data.next("role"))
+		data.roles[id] = Role{Id: id, Name: name}
+	}
+
+	for _, jobRole := range []struct {
+		roleName string
+		name     string
+	}{
+		{RoleAdmin, "dev-ops"},
+		{RoleAdmin, "GO-developer"},
+		{RoleClient, "unknown"},
+		{RoleClient, "business analyst"},
+		{RoleClient, "qa"},
+		{RoleClient, "aqa"},
+	} {
+		id := int(data.next("job_role"))
+		data.jobRoles[id] = JobRole{Id: id, Role_id: data.roleId(jobRole.roleName), Name: jobRole.name}
+	}
+
+	for _, name := range []string{"Поселок", "Поселок городского типа", "Деревня", "Агрогородок", "Город"} {
+		id := int(data.next("settlement_type"))
+		data.settlementTypes[id] = SettlementType{Id: id, Name: name}
+	}
+}
+
+// WithTx runs fn holding the store lock, so no other call interleaves with it. If fn fails,
+// the data is restored to the snapshot taken before fn started. fn has to use tx only,
+// calls to the store itself would wait for the lock forever.
+func (ms *MemoryStore) WithTx(ctx context.Context, fn func(tx UserStore) error) error {
+	if ms.inTx {
+		return fn(ms)
+	}
+
+	unlock, err := ms.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	snapshot := ms.data.clone()
+	txStore := *ms
+	txStore.inTx = true
+
+	err = fn(&txStore)
+	if err != nil {
+		*ms.data = *snapshot
+		return err
+	}
+
+	return nil
+}
+
+// lock takes the store lock, unless the call is part of a transaction that already holds it.
+func (ms *MemoryStore) lock(ctx context.Context) (func(), error) {
+	err := ctx.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	if ms.inTx {
+		return func() {}, nil
+	}
+
+	ms.mu.Lock()
+	return ms.mu.Unlock, nil
+}
+
+func (d *memoryData) clone() *memoryData {
+	return &memoryData{
+		sequences:       maps.Clone(d.sequences),
+		roles:           maps.Clone(d.roles),
+		jobRoles:        maps.Clone(d.jobRoles),
+		settlementTypes: maps.Clone(d.settlementTypes),
+		addresses:       maps.Clone(d.addresses),
+		users:           maps.Clone(d.users),
+		refreshTokens:   maps.Clone(d.refreshTokens),
+		sessions:        maps.Clone(d.sessions),
+		revokedTokens:   maps.Clone(d.revokedTokens),
+		userTokens:      maps.Clone(d.userTokens),
+		userTotps:       maps.Clone(d.userTotps),
+		recoveryCodes:   maps.Clone(d.recoveryCodes),
+		credentials:     maps.Clone(d.credentials),
+		videoHistory:    maps.Clone(d.videoHistory),
+	}
+}
+
+// next returns the next id of the table, like a serial column.
+func (d *memoryData) next(table string) int64 {
+	d.sequences[table]++
+	return d.sequences[table]
+}
+
+func (d *memoryData) roleId(name string) int {
+	for _, role := range d.roles {
+		if role.Name == name {
+			return role.Id
+		}
+	}
+
+	return 0
+}
+
+// jobRole returns the job role with the name of the role it grants, the way FindJobRole does.
+func (d *memoryData) jobRole(id int) (JobRole, bool) {
+	jobRole, ok := d.jobRoles[id]
+	if !ok {
+		return JobRole{}, false
+	}
+
+	jobRole.RoleName = d.roles[jobRole.Role_id].Name
+	if jobRole.RoleName == "" {
+		jobRole.RoleName = RoleClient
+	}
+
+	return jobRole, true
+}
+
+func (d *memoryData) userProfile(user User) UserProfile {
+	user.Password = ""
+	profile := UserProfile{User: user}
+
+	if jobRole, ok := d.jobRoles[user.JobRoleId]; ok {
+		jobRole.RoleName = d.roles[jobRole.Role_id].Name
+		profile.JobRole = &jobRole
+		profile.RoleName = jobRole.RoleName
+	}
+
+	if address, ok := d.addresses[user.AddressId]; ok {
+		settlementType := d.settlementTypes[address.SettlementTypeId]
+		profile.Address = &address
+		profile.SettlementType = &settlementType
+	}
+
+	return profile
+}
+
+// page applies LIMIT and OFFSET to rows that are already sorted.
+func page[T any](rows []T, limit, offset int) []T {
+	if offset >= len(rows) {
+		return rows[:0]
+	}
+	rows = rows[offset:]
+	if limit < len(rows) {
+		rows = rows[:limit]
+	}
+
+	return rows
+}
+
+func sortedValues[K int | int64, V any](m map[K]V) []V {
+	keys := make([]K, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i] < keys[j]
+	})
+
+	values := make([]V, 0, len(keys))
+	for _, key := range keys {
+		values = append(values, m[key])
+	}
+
+	return values
+}
+
+func (ms *MemoryStore) CreateAddress(ctx context.Context, address *Address) (int64, error) {
+	unlock, err := ms.lock(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	row := *address
+	row.Id = ms.data.next("address")
+	ms.data.addresses[row.Id] = row
+
+	return row.Id, nil
+}
+
+// CreateUser inserts the user. A zero AddressId leaves the user without an address.
+func (ms *MemoryStore) CreateUser(ctx context.Context, user *User) (int64, error) {
+	unlock, err := ms.lock(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	if ms.findUserByEmail(user.Email) != nil {
+		return 0, duplicate("user_email_key")
+	}
+
+	row := *user
+	row.Id = ms.data.next("user")
+	ms.data.users[row.Id] = row
+
+	return row.Id, nil
+}
+
+func (ms *MemoryStore) FindUserByEmail(ctx context.Context, email string) (*User, error) {
+	unlock, err := ms.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	user := ms.findUserByEmail(email)
+	if user == nil {
+		return nil, sql.ErrNoRows
+	}
+
+	return user, nil
+}
+
+func (ms *MemoryStore) findUserByEmail(email string) *User {
+	for _, user := range ms.data.users {
+		if strings.EqualFold(user.Email, email) {
+			return &user
+		}
+	}
+
+	return nil
+}
+
+func (ms *MemoryStore) FindUserById(ctx context.Context, id int64) (*User, error) {
+	unlock, err := ms.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	user, ok := ms.data.users[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+
+	return &user, nil
+}
+
+// FindUserProfile loads the user together with its address, job role and settlement type.
+func (ms *MemoryStore) FindUserProfile(ctx context.Context, userID int64) (*UserProfile, error) {
+	unlock, err := ms.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	user, ok := ms.data.users[userID]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+
+	profile := ms.data.userProfile(user)
+	return &profile, nil
+}
+
+// FindUserProfiles returns one page of users matching the filter, ordered by id, together with
+// the total number of matching users. Search matches the email and names case-insensitively.
+func (ms *MemoryStore) FindUserProfiles(ctx context.Context, filter UserFilter) ([]UserProfile, int, error) {
+	unlock, err := ms.lock(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer unlock()
+
+	search := strings.ToLower(filter.Search)
+	profiles := make([]UserProfile, 0)
+	for _, user := range sortedValues(ms.data.users) {
+		if filter.JobRoleId != 0 && user.JobRoleId != filter.JobRoleId {
+			continue
+		}
+		if filter.IsActive != nil && user.IsActive != *filter.IsActive {
+			continue
+		}
+		if search != "" && !containsAny(search, user.Email, user.Name, user.SecondName, user.Surname) {
+			continue
+		}
+		profiles = append(profiles, ms.data.userProfile(user))
+	}
+
+	return page(profiles, filter.Limit, filter.Offset), len(profiles), nil
+}
+
+func containsAny(search string, values ...string) bool {
+	for _, value := range values {
+		if strings.Contains(strings.ToLower(value), search) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// UpdateUserProfile stores the personal data of the user. Email, password and flags are changed by dedicated methods.
+func (ms *MemoryStore) UpdateUserProfile(ctx context.Context, user *User) error {
+	unlock, err := ms.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	row, ok := ms.data.users[user.Id]
+	if !ok {
+		return nil
+	}
+	row.Name = user.Name
+	row.SecondName = user.SecondName
+	row.Surname = user.Surname
+	row.Birthday = user.Birthday
+	ms.data.users[row.Id] = row
+
+	return nil
+}
+
+func (ms *MemoryStore) UpdateAddress(ctx context.Context, address *Address) error {
+	unlock, err := ms.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if _, ok := ms.data.addresses[address.Id]; ok {
+		ms.data.addresses[address.Id] = *address
+	}
+
+	return nil
+}
+
+func (ms *MemoryStore) SetUserAddress(ctx context.Context, userID int64, addressID int64) error {
+	return ms.updateUser(ctx, userID, func(user *User) {
+		user.AddressId = addressID
+	}, false)
+}
+
+// SetUserActive deactivates or reactivates the user. sql.ErrNoRows is returned for an unknown user.
+func (ms *MemoryStore) SetUserActive(ctx context.Context, userID int64, isActive bool) error {
+	return ms.updateUser(ctx, userID, func(user *User) {
+		user.IsActive = isActive
+	}, true)
+}
+
+// SetUserJobRole changes the job role, and with it the role, of the user. sql.ErrNoRows is returned for an unknown user.
+func (ms *MemoryStore) SetUserJobRole(ctx context.Context, userID int64, jobRoleID int) error {
+	return ms.updateUser(ctx, userID, func(user *User) {
+		user.JobRoleId = jobRoleID
+	}, true)
+}
+
+// UpdateUserPassword stores the new password hash. sql.ErrNoRows is returned for an unknown user.
+func (ms *MemoryStore) UpdateUserPassword(ctx context.Context, userID int64, password string) error {
+	return ms.updateUser(ctx, userID, func(user *User) {
+		user.Password = password
+	}, true)
+}
+
+// updateUser applies update to the stored user. An unknown user is ignored, like an UPDATE matching
+// no rows, unless mustExist is set.
+func (ms *MemoryStore) updateUser(ctx context.Context, userID int64, update func(user *User), mustExist bool) error {
+	unlock, err := ms.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	user, ok := ms.data.users[userID]
+	if !ok {
+		if mustExist {
+			return sql.ErrNoRows
+		}
+		return nil
+	}
+
+	update(&user)
+	ms.data.users[userID] = user
+
+	return nil
+}
+
+// DeleteUser removes the user together with its address, video history, tokens and TOTP secret.
+// sql.ErrNoRows is returned for an unknown user.
+func (ms *MemoryStore) DeleteUser(ctx context.Context, userID int64) error {
+	unlock, err := ms.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	user, ok := ms.data.users[userID]
+	if !ok {
+		return sql.ErrNoRows
+	}
+
+	maps.DeleteFunc(ms.data.videoHistory, func(_ int64, entry VideoHistory) bool {
+		return entry.UserId == userID
+	})
+	maps.DeleteFunc(ms.data.refreshTokens, func(_ int64, token RefreshToken) bool {
+		return token.UserId == userID
+	})
+	maps.DeleteFunc(ms.data.sessions, func(_ string, session Session) bool {
+		return session.UserId == userID
+	})
+	maps.DeleteFunc(ms.data.userTokens, func(_ int64, token UserToken) bool {
+		return token.UserId == userID
+	})
+	maps.DeleteFunc(ms.data.recoveryCodes, func(_ int64, code RecoveryCode) bool {
+		return code.UserId == userID
+	})
+	maps.DeleteFunc(ms.data.credentials, func(_ int64, credential WebAuthnCredential) bool {
+		return credential.UserId == userID
+	})
+	delete(ms.data.userTotps, userID)
+	delete(ms.data.users, userID)
+	delete(ms.data.addresses, user.AddressId)
+
+	return nil
+}
+
+func (ms *MemoryStore) FindUserRole(ctx context.Context, userID int64) (*UserRole, error) {
+	unlock, err := ms.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	user, ok := ms.data.users[userID]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+
+	role := &UserRole{RoleName: RoleClient}
+	if jobRole, ok := ms.data.jobRole(user.JobRoleId); ok {
+		role.JobRoleId = jobRole.Id
+		role.JobRoleName = jobRole.Name
+		role.RoleId = jobRole.Role_id
+		role.RoleName = jobRole.RoleName
+	}
+
+	return role, nil
+}
+
+func (ms *MemoryStore) CreateRefreshToken(ctx context.Context, token *RefreshToken) (int64, error) {
+	unlock, err := ms.lock(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	return ms.insertRefreshToken(token)
+}
+
+func (ms *MemoryStore) insertRefreshToken(token *RefreshToken) (int64, error) {
+	for _, row := range ms.data.refreshTokens {
+		if row.TokenHash == token.TokenHash {
+			return 0, duplicate("refresh_token_token_hash_key")
+		}
+	}
+
+	row := *token
+	row.Id = ms.data.next("refresh_token")
+	row.UsedAt = nil
+	row.RevokedAt = nil
+	ms.data.refreshTokens[row.Id] = row
+
+	return row.Id, nil
+}
+
+func (ms *MemoryStore) FindRefreshTokenByHash(ctx context.Context, tokenHash string) (*RefreshToken, error) {
+	return ms.findRefreshToken(ctx, func(token RefreshToken) bool {
+		return token.TokenHash == tokenHash
+	})
+}
+
+func (ms *MemoryStore) FindRefreshTokenByAccessTokenId(ctx context.Context, accessTokenID string) (*RefreshToken, error) {
+	return ms.findRefreshToken(ctx, func(token RefreshToken) bool {
+		return token.AccessTokenId == accessTokenID
+	})
+}
+
+func (ms *MemoryStore) findRefreshToken(ctx context.Context, match func(token RefreshToken) bool) (*RefreshToken, error) {
+	unlock, err := ms.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	for _, token := range sortedValues(ms.data.refreshTokens) {
+		if match(token) {
+			return &token, nil
+		}
+	}
+
+	return nil, sql.ErrNoRows
+}
+
+// RotateRefreshToken marks the old refresh token as used and stores its replacement.
+// ErrRefreshTokenUsed is returned if the old token was used or revoked concurrently.
+func (ms *MemoryStore) RotateRefreshToken(ctx context.Context, oldTokenID int64, usedAt int64, newToken *RefreshToken) (int64, error) {
+	unlock, err := ms.lock(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	oldToken, ok := ms.data.refreshTokens[oldTokenID]
+	if !ok || oldToken.UsedAt != nil || oldToken.RevokedAt != nil {
+		return 0, ErrRefreshTokenUsed
+	}
+
+	tokenID, err := ms.insertRefreshToken(newToken)
+	if err != nil {
+		return 0, err
+	}
+
+	oldToken.UsedAt = &usedAt
+	ms.data.refreshTokens[oldTokenID] = oldToken
+
+	return tokenID, nil
+}
+
+func (ms *MemoryStore) RevokeRefreshTokenFamily(ctx context.Context, familyID string, revokedAt int64) error {
+	unlock, err := ms.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	for id, token := range ms.data.refreshTokens {
+		if token.FamilyId == familyID && token.RevokedAt == nil {
+			token.RevokedAt = &revokedAt
+			ms.data.refreshTokens[id] = token
+		}
+	}
+
+	return nil
+}
+
+// RevokeUserRefreshTokens revokes every refresh token of the user, except the ones in keepFamilyID if it is set,
+// and returns the ids of the access tokens issued since createdSince, which may still be valid
+// and have to be denylisted by the caller.
+func (ms *MemoryStore) RevokeUserRefreshTokens(ctx context.Context, userID int64, keepFamilyID string, revokedAt int64, createdSince int64) ([]string, error) {
+	unlock, err := ms.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	var accessTokenIDs []string
+	for _, token := range sortedValues(ms.data.refreshTokens) {
+		if token.UserId != userID || token.FamilyId == keepFamilyID {
+			continue
+		}
+
+		if token.RevokedAt == nil {
+			token.RevokedAt = &revokedAt
+			ms.data.refreshTokens[token.Id] = token
+		}
+		if token.CreatedAt >= createdSince {
+			accessTokenIDs = append(accessTokenIDs, token.AccessTokenId)
+		}
+	}
+
+	return accessTokenIDs, nil
+}
+
+func (ms *MemoryStore) CreateSession(ctx context.Context, session *Session) error {
+	unlock, err := ms.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if _, ok := ms.data.sessions[session.Id]; ok {
+		return duplicate("user_session_pkey")
+	}
+
+	row := *session
+	row.ExpiresAt = 0
+	ms.data.sessions[row.Id] = row
+
+	return nil
+}
+
+// TouchSession records that the session was used, from the given IP and user agent, to refresh its tokens.
+// Unknown sessions are ignored.
+func (ms *MemoryStore) TouchSession(ctx context.Context, id string, lastUsedAt int64, ipAddress, userAgent string) error {
+	unlock, err := ms.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	session, ok := ms.data.sessions[id]
+	if !ok {
+		return nil
+	}
+
+	session.LastUsedAt = lastUsedAt
+	session.IpAddress = ipAddress
+	session.UserAgent = userAgent
+	ms.data.sessions[id] = session
+
+	return nil
+}
+
+// FindActiveSessions returns the sessions of the user whose refresh token is still usable at now,
+// most recently used first.
+func (ms *MemoryStore) FindActiveSessions(ctx context.Context, userID int64, now int64) ([]Session, error) {
+	unlock, err := ms.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	sessions := make([]Session, 0)
+	for _, token := range ms.data.refreshTokens {
+		if token.UserId != userID || !liveRefreshToken(token, now) {
+			continue
+		}
+
+		session, ok := ms.data.sessions[token.FamilyId]
+		if !ok {
+			continue
+		}
+		session.ExpiresAt = token.ExpiresAt
+		sessions = append(sessions, session)
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		if sessions[i].LastUsedAt != sessions[j].LastUsedAt {
+			return sessions[i].LastUsedAt > sessions[j].LastUsedAt
+		}
+		return sessions[i].CreatedAt > sessions[j].CreatedAt
+	})
+
+	return sessions, nil
+}
+
+// RevokeSession revokes the refresh tokens of the active session of the user and returns the ids of its access
+// tokens issued since createdSince, which may still be valid and have to be denylisted by the caller.
+// sql.ErrNoRows is returned if the user has no active session with the id.
+func (ms *MemoryStore) RevokeSession(ctx context.Context, userID int64, id string, revokedAt int64, createdSince int64) ([]string, error) {
+	unlock, err := ms.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	active := false
+	for _, token := range ms.data.refreshTokens {
+		if token.UserId == userID && token.FamilyId == id && liveRefreshToken(token, revokedAt) {
+			active = true
+		}
+	}
+	if !active {
+		return nil, sql.ErrNoRows
+	}
+
+	var accessTokenIDs []string
+	for _, token := range sortedValues(ms.data.refreshTokens) {
+		if token.FamilyId != id {
+			continue
+		}
+
+		if token.RevokedAt == nil {
+			token.RevokedAt = &revokedAt
+			ms.data.refreshTokens[token.Id] = token
+		}
+		if token.CreatedAt >= createdSince {
+			accessTokenIDs = append(accessTokenIDs, token.AccessTokenId)
+		}
+	}
+
+	return accessTokenIDs, nil
+}
+
+// liveRefreshToken reports whether the token can still be exchanged at now, i.e. its session is active.
+func liveRefreshToken(token RefreshToken, now int64) bool {
+	return token.UsedAt == nil && token.RevokedAt == nil && token.ExpiresAt > now
+}
+
+func (ms *MemoryStore) CreateRevokedTokens(ctx context.Context, tokens []RevokedToken) error {
+	unlock, err := ms.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	for _, token := range tokens {
+		if _, ok := ms.data.revokedTokens[token.Jti]; !ok {
+			ms.data.revokedTokens[token.Jti] = token
+		}
+	}
+
+	return nil
+}
+
+// FindRevokedTokens returns the revoked tokens that have not expired yet at the given time.
+func (ms *MemoryStore) FindRevokedTokens(ctx context.Context, now int64) ([]RevokedToken, error) {
+	unlock, err := ms.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	var tokens []RevokedToken
+	for _, token := range ms.data.revokedTokens {
+		if token.ExpiresAt > now {
+			tokens = append(tokens, token)
+		}
+	}
+
+	return tokens, nil
+}
+
+func (ms *MemoryStore) DeleteExpiredRevokedTokens(ctx context.Context, now int64) error {
+	unlock, err := ms.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	maps.DeleteFunc(ms.data.revokedTokens, func(_ string, token RevokedToken) bool {
+		return token.ExpiresAt <= now
+	})
+
+	return nil
+}
+
+func (ms *MemoryStore) CreateUserToken(ctx context.Context, token *UserToken) (int64, error) {
+	unlock, err := ms.lock(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	for _, row := range ms.data.userTokens {
+		if row.TokenHash == token.TokenHash {
+			return 0, duplicate("user_token_token_hash_key")
+		}
+	}
+
+	row := *token
+	row.Id = ms.data.next("user_token")
+	row.UsedAt = nil
+	ms.data.userTokens[row.Id] = row
+
+	return row.Id, nil
+}
+
+func (ms *MemoryStore) FindUserTokenByHash(ctx context.Context, purpose, tokenHash string) (*UserToken, error) {
+	unlock, err := ms.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	for _, token := range ms.data.userTokens {
+		if token.Purpose == purpose && token.TokenHash == tokenHash {
+			return &token, nil
+		}
+	}
+
+	return nil, sql.ErrNoRows
+}
+
+// FindLastUserTokenTime returns when the latest token with the given purpose was issued to the user, 0 if never.
+func (ms *MemoryStore) FindLastUserTokenTime(ctx context.Context, userID int64, purpose string) (int64, error) {
+	unlock, err := ms.lock(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	var createdAt int64
+	for _, token := range ms.data.userTokens {
+		if token.UserId == userID && token.Purpose == purpose && token.CreatedAt > createdAt {
+			createdAt = token.CreatedAt
+		}
+	}
+
+	return createdAt, nil
+}
+
+// ResetUserPassword consumes the reset token, invalidates the other pending reset tokens of the user
+// and stores the new password hash.
+func (ms *MemoryStore) ResetUserPassword(ctx context.Context, token *UserToken, usedAt int64, password string) error {
+	unlock, err := ms.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	err = ms.useUserToken(token.Id, usedAt)
+	if err != nil {
+		return err
+	}
+
+	for id, row := range ms.data.userTokens {
+		if row.UserId == token.UserId && row.Purpose == token.Purpose && row.UsedAt == nil {
+			row.UsedAt = &usedAt
+			ms.data.userTokens[id] = row
+		}
+	}
+
+	if user, ok := ms.data.users[token.UserId]; ok {
+		user.Password = password
+		ms.data.users[user.Id] = user
+	}
+
+	return nil
+}
+
+// ChangeUserEmail consumes the email change token and sets the new email stored in its payload.
+// The new email counts as verified, since the token was delivered to it.
+func (ms *MemoryStore) ChangeUserEmail(ctx context.Context, token *UserToken, usedAt int64) error {
+	unlock, err := ms.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if other := ms.findUserByEmail(token.Payload); other != nil && other.Id != token.UserId {
+		return duplicate("user_email_key")
+	}
+
+	err = ms.useUserToken(token.Id, usedAt)
+	if err != nil {
+		return err
+	}
+
+	if user, ok := ms.data.users[token.UserId]; ok {
+		user.Email = token.Payload
+		user.EmailVerified = true
+		ms.data.users[user.Id] = user
+	}
+
+	return nil
+}
+
+// VerifyUserEmail consumes the verification token and marks the email of its user as verified.
+func (ms *MemoryStore) VerifyUserEmail(ctx context.Context, token *UserToken, usedAt int64) error {
+	unlock, err := ms.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	err = ms.useUserToken(token.Id, usedAt)
+	if err != nil {
+		return err
+	}
+
+	if user, ok := ms.data.users[token.UserId]; ok {
+		user.EmailVerified = true
+		ms.data.users[user.Id] = user
+	}
+
+	return nil
+}
+
+// UseUserToken consumes a token that grants nothing by itself, e.g. an MFA challenge.
+// ErrUserTokenUsed is returned if it was used before.
+func (ms *MemoryStore) UseUserToken(ctx context.Context, tokenID int64, usedAt int64) error {
+	unlock, err := ms.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	return ms.useUserToken(tokenID, usedAt)
+}
+
+func (ms *MemoryStore) useUserToken(tokenID int64, usedAt int64) error {
+	token, ok := ms.data.userTokens[tokenID]
+	if !ok || token.UsedAt != nil {
+		return ErrUserTokenUsed
+	}
+
+	token.UsedAt = &usedAt
+	ms.data.userTokens[tokenID] = token
+
+	return nil
+}
+
+func (ms *MemoryStore) FindUserTotp(ctx context.Context, userID int64) (*UserTotp, error) {
+	unlock, err := ms.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	totp, ok := ms.data.userTotps[userID]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+
+	return &totp, nil
+}
+
+// SaveUserTotp starts the TOTP enrollment of the user, replacing an unconfirmed one.
+// ErrDuplicate is returned if the user already has a confirmed TOTP secret.
+func (ms *MemoryStore) SaveUserTotp(ctx context.Context, totp *UserTotp) error {
+	unlock, err := ms.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if existing, ok := ms.data.userTotps[totp.UserId]; ok && existing.ConfirmedAt != nil {
+		return duplicate("user_totp_pkey")
+	}
+
+	ms.data.userTotps[totp.UserId] = UserTotp{
+		UserId:    totp.UserId,
+		Secret:    totp.Secret,
+		CreatedAt: totp.CreatedAt,
+	}
+
+	return nil
+}
+
+// EnableUserTotp confirms the enrollment, marking step as used, and stores the recovery codes.
+// sql.ErrNoRows is returned if there is no unconfirmed enrollment.
+func (ms *MemoryStore) EnableUserTotp(ctx context.Context, userID int64, confirmedAt int64, step int64, codeHashes []string) error {
+	unlock, err := ms.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	totp, ok := ms.data.userTotps[userID]
+	if !ok || totp.ConfirmedAt != nil {
+		return sql.ErrNoRows
+	}
+
+	totp.ConfirmedAt = &confirmedAt
+	totp.LastUsedStep = step
+	ms.data.userTotps[userID] = totp
+	ms.replaceRecoveryCodes(userID, codeHashes, confirmedAt)
+
+	return nil
+}
+
+// UseTotpStep records that the code of step was used. ErrTotpStepUsed is returned if the step, or a later one,
+// was used before, so every code is accepted only once.
+func (ms *MemoryStore) UseTotpStep(ctx context.Context, userID int64, step int64) error {
+	unlock, err := ms.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	totp, ok := ms.data.userTotps[userID]
+	if !ok || totp.ConfirmedAt == nil || totp.LastUsedStep >= step {
+		return ErrTotpStepUsed
+	}
+
+	totp.LastUsedStep = step
+	ms.data.userTotps[userID] = totp
+
+	return nil
+}
+
+// DeleteUserTotp turns off two-factor authentication for the user, removing the recovery codes as well.
+// sql.ErrNoRows is returned if the user has no TOTP secret.
+func (ms *MemoryStore) DeleteUserTotp(ctx context.Context, userID int64) error {
+	unlock, err := ms.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if _, ok := ms.data.userTotps[userID]; !ok {
+		return sql.ErrNoRows
+	}
+
+	delete(ms.data.userTotps, userID)
+	ms.replaceRecoveryCodes(userID, nil, 0)
+
+	return nil
+}
+
+// ReplaceRecoveryCodes invalidates the recovery codes of the user and stores new ones.
+func (ms *MemoryStore) ReplaceRecoveryCodes(ctx context.Context, userID int64, codeHashes []string, createdAt int64) error {
+	unlock, err := ms.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	ms.replaceRecoveryCodes(userID, codeHashes, createdAt)
+
+	return nil
+}
+
+func (ms *MemoryStore) replaceRecoveryCodes(userID int64, codeHashes []string, createdAt int64) {
+	maps.DeleteFunc(ms.data.recoveryCodes, func(_ int64, code RecoveryCode) bool {
+		return code.UserId == userID
+	})
+
+	for _, codeHash := range codeHashes {
+		id := ms.data.next("recovery_code")
+		ms.data.recoveryCodes[id] = RecoveryCode{
+			Id:        id,
+			UserId:    userID,
+			CodeHash:  codeHash,
+			CreatedAt: createdAt,
+		}
+	}
+}
+
+// UseRecoveryCode consumes the unused recovery code with the given hash. sql.ErrNoRows is returned if there is none.
+func (ms *MemoryStore) UseRecoveryCode(ctx context.Context, userID int64, codeHash string, usedAt int64) error {
+	unlock, err := ms.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	for id, code := range ms.data.recoveryCodes {
+		if code.UserId == userID && code.CodeHash == codeHash && code.UsedAt == nil {
+			code.UsedAt = &usedAt
+			ms.data.recoveryCodes[id] = code
+			return nil
+		}
+	}
+
+	return sql.ErrNoRows
+}
+
+// CountRecoveryCodes returns the number of recovery codes the user has not used yet.
+func (ms *MemoryStore) CountRecoveryCodes(ctx context.Context, userID int64) (int, error) {
+	unlock, err := ms.lock(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	count := 0
+	for _, code := range ms.data.recoveryCodes {
+		if code.UserId == userID && code.UsedAt == nil {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// CreateWebAuthnCredential stores a registered passkey. ErrDuplicate is returned if the credential id is already registered.
+func (ms *MemoryStore) CreateWebAuthnCredential(ctx context.Context, credential *WebAuthnCredential) (int64, error) {
+	unlock, err := ms.lock(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	for _, row := range ms.data.credentials {
+		if row.CredentialId == credential.CredentialId {
+			return 0, duplicate("webauthn_credential_credential_id_key")
+		}
+	}
+
+	row := *credential
+	row.Id = ms.data.next("webauthn_credential")
+	row.LastUsedAt = nil
+	ms.data.credentials[row.Id] = row
+
+	return row.Id, nil
+}
+
+// FindWebAuthnCredentials returns the passkeys of the user, oldest first.
+func (ms *MemoryStore) FindWebAuthnCredentials(ctx context.Context, userID int64) ([]WebAuthnCredential, error) {
+	unlock, err := ms.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	credentials := make([]WebAuthnCredential, 0)
+	for _, credential := range sortedValues(ms.data.credentials) {
+		if credential.UserId == userID {
+			credentials = append(credentials, credential)
+		}
+	}
+
+	return credentials, nil
+}
+
+// UpdateWebAuthnCredential stores the data of the passkey as updated by a login, e.g. its signature counter.
+// sql.ErrNoRows is returned for an unknown passkey.
+func (ms *MemoryStore) UpdateWebAuthnCredential(ctx context.Context, id int64, data string, lastUsedAt int64) error {
+	unlock, err := ms.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	credential, ok := ms.data.credentials[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+
+	credential.Data = data
+	credential.LastUsedAt = &lastUsedAt
+	ms.data.credentials[id] = credential
+
+	return nil
+}
+
+// DeleteWebAuthnCredential removes the passkey of the user. sql.ErrNoRows is returned if the user has no passkey with the id.
+func (ms *MemoryStore) DeleteWebAuthnCredential(ctx context.Context, userID int64, id int64) error {
+	unlock, err := ms.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	credential, ok := ms.data.credentials[id]
+	if !ok || credential.UserId != userID {
+		return sql.ErrNoRows
+	}
+
+	delete(ms.data.credentials, id)
+
+	return nil
+}
+
+func (ms *MemoryStore) CreateVideoHistory(ctx context.Context, history *VideoHistory) (int64, error) {
+	unlock, err := ms.lock(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	row := VideoHistory{
+		Id:        ms.data.next("video_history"),
+		UserId:    history.UserId,
+		VideoName: history.VideoName,
+		Event:     history.Event,
+		CreatedAt: history.CreatedAt,
+	}
+	ms.data.videoHistory[row.Id] = row
+
+	return row.Id, nil
+}
+
+// FindVideoHistory returns one page of the user's history, newest first, together with the total
+// number of entries matching the filter. Zero From/To leave that side of the time range open.
+func (ms *MemoryStore) FindVideoHistory(ctx context.Context, filter VideoHistoryFilter) ([]VideoHistory, int, error) {
+	unlock, err := ms.lock(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer unlock()
+
+	history := make([]VideoHistory, 0)
+	for _, entry := range ms.data.videoHistory {
+		if entry.UserId != filter.UserId ||
+			(filter.From != 0 && entry.CreatedAt < filter.From) ||
+			(filter.To != 0 && entry.CreatedAt >= filter.To) {
+			continue
+		}
+		history = append(history, entry)
+	}
+	sort.Slice(history, func(i, j int) bool {
+		if history[i].CreatedAt != history[j].CreatedAt {
+			return history[i].CreatedAt > history[j].CreatedAt
+		}
+		return history[i].Id > history[j].Id
+	})
+
+	return page(history, filter.Limit, filter.Offset), len(history), nil
+}
+
+// FindJobRoles lists the job roles with the name of the role they grant. Retired job roles
+// are left out unless includeRetired is set.
+func (ms *MemoryStore) FindJobRoles(ctx context.Context, includeRetired bool) ([]JobRole, error) {
+	unlock, err := ms.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	jobRoles := make([]JobRole, 0)
+	for _, row := range sortedValues(ms.data.jobRoles) {
+		if row.Retired && !includeRetired {
+			continue
+		}
+		jobRole, _ := ms.data.jobRole(row.Id)
+		jobRoles = append(jobRoles, jobRole)
+	}
+
+	return jobRoles, nil
+}
+
+func (ms *MemoryStore) FindJobRole(ctx context.Context, id int) (*JobRole, error) {
+	unlock, err := ms.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	jobRole, ok := ms.data.jobRole(id)
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+
+	return &jobRole, nil
+}
+
+// CreateJobRole adds a job role granting the role named roleName.
+func (ms *MemoryStore) CreateJobRole(ctx context.Context, name, roleName string) (int, error) {
+	unlock, err := ms.lock(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	if ms.jobRoleNameTaken(0, name) {
+		return 0, duplicate("job_role_name_key")
+	}
+
+	id := int(ms.data.next("job_role"))
+	ms.data.jobRoles[id] = JobRole{Id: id, Role_id: ms.data.roleId(roleName), Name: name}
+
+	return id, nil
+}
+
+// RenameJobRole changes the name of the job role. sql.ErrNoRows is returned for an unknown job role.
+func (ms *MemoryStore) RenameJobRole(ctx context.Context, id int, name string) error {
+	unlock, err := ms.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	jobRole, ok := ms.data.jobRoles[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	if ms.jobRoleNameTaken(id, name) {
+		return duplicate("job_role_name_key")
+	}
+
+	jobRole.Name = name
+	ms.data.jobRoles[id] = jobRole
+
+	return nil
+}
+
+// RetireJobRole hides the job role from new registrations. Users keep it until an admin changes it.
+// sql.ErrNoRows is returned for an unknown job role.
+func (ms *MemoryStore) RetireJobRole(ctx context.Context, id int) error {
+	unlock, err := ms.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	jobRole, ok := ms.data.jobRoles[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+
+	jobRole.Retired = true
+	ms.data.jobRoles[id] = jobRole
+
+	return nil
+}
+
+func (ms *MemoryStore) jobRoleNameTaken(exceptID int, name string) bool {
+	for _, jobRole := range ms.data.jobRoles {
+		if jobRole.Id != exceptID && jobRole.Name == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// FindSettlementTypes lists the settlement types. Retired ones are left out unless includeRetired is set.
+func (ms *MemoryStore) FindSettlementTypes(ctx context.Context, includeRetired bool) ([]SettlementType, error) {
+	unlock, err := ms.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	settlementTypes := make([]SettlementType, 0)
+	for _, settlementType := range sortedValues(ms.data.settlementTypes) {
+		if settlementType.Retired && !includeRetired {
+			continue
+		}
+		settlementTypes = append(settlementTypes, settlementType)
+	}
+
+	return settlementTypes, nil
+}
+
+func (ms *MemoryStore) FindSettlementType(ctx context.Context, id int) (*SettlementType, error) {
+	unlock, err := ms.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	settlementType, ok := ms.data.settlementTypes[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+
+	return &settlementType, nil
+}
+
+func (ms *MemoryStore) CreateSettlementType(ctx context.Context, name string) (int, error) {
+	unlock, err := ms.lock(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	if ms.settlementTypeNameTaken(0, name) {
+		return 0, duplicate("settlement_type_name_key")
+	}
+
+	id := int(ms.data.next("settlement_type"))
+	ms.data.settlementTypes[id] = SettlementType{Id: id, Name: name}
+
+	return id, nil
+}
+
+// RenameSettlementType changes the name of the settlement type. sql.ErrNoRows is returned for an unknown settlement type.
+func (ms *MemoryStore) RenameSettlementType(ctx context.Context, id int, name string) error {
+	unlock, err := ms.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	settlementType, ok := ms.data.settlementTypes[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	if ms.settlementTypeNameTaken(id, name) {
+		return duplicate("settlement_type_name_key")
+	}
+
+	settlementType.Name = name
+	ms.data.settlementTypes[id] = settlementType
+
+	return nil
+}
+
+// RetireSettlementType hides the settlement type from new addresses. Existing addresses keep it.
+// sql.ErrNoRows is returned for an unknown settlement type.
+func (ms *MemoryStore) RetireSettlementType(ctx context.Context, id int) error {
+	unlock, err := ms.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	settlementType, ok := ms.data.settlementTypes[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+
+	settlementType.Retired = true
+	ms.data.settlementTypes[id] = settlementType
+
+	return nil
+}
+
+func (ms *MemoryStore) settlementTypeNameTaken(exceptID int, name string) bool {
+	for _, settlementType := range ms.data.settlementTypes {
+		if settlementType.Id != exceptID && settlementType.Name == name {
+			return true
+		}
+	}
+
+	return false
+}
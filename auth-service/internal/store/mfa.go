@@ -0,0 +1,224 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+)
+
+func (ss *StoreService) FindUserTotp(ctx context.Context, userID int64) (*UserTotp, error) {
+	var totp UserTotp
+	sqlStatement := `
+		SELECT user_id, secret, created_at, confirmed_at, last_used_step
+		FROM public.user_totp
+		WHERE user_id = $1
+	`
+	err := ss.conn().QueryRowContext(ctx, sqlStatement, userID).
+		Scan(&totp.UserId, &totp.Secret, &totp.CreatedAt, &totp.ConfirmedAt, &totp.LastUsedStep)
+	if err != nil {
+		return nil, err
+	}
+
+	return &totp, nil
+}
+
+// SaveUserTotp starts the TOTP enrollment of the user, replacing an unconfirmed one.
+// ErrDuplicate is returned if the user already has a confirmed TOTP secret.
+func (ss *StoreService) SaveUserTotp(ctx context.Context, totp *UserTotp) error {
+	sqlStatement := `
+		INSERT INTO public.user_totp
+		(user_id, secret, created_at)
+		VALUES($1, $2, $3)
+		ON CONFLICT (user_id) DO UPDATE
+		SET secret = EXCLUDED.secret, created_at = EXCLUDED.created_at, confirmed_at = NULL, last_used_step = 0
+		WHERE user_totp.confirmed_at IS NULL
+	`
+	result, err := ss.conn().ExecContext(ctx, sqlStatement, totp.UserId, totp.Secret, totp.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return duplicate("user_totp_pkey")
+	}
+
+	return nil
+}
+
+// EnableUserTotp confirms the enrollment, marking step as used, and stores the recovery codes in one transaction.
+// sql.ErrNoRows is returned if there is no unconfirmed enrollment.
+func (ss *StoreService) EnableUserTotp(ctx context.Context, userID int64, confirmedAt int64, step int64, codeHashes []string) error {
+	tx, err := ss.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	sqlStatement := `
+		UPDATE public.user_totp
+		SET confirmed_at = $2, last_used_step = $3
+		WHERE user_id = $1 AND confirmed_at IS NULL
+	`
+	result, err := tx.ExecContext(ctx, sqlStatement, userID, confirmedAt, step)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+
+	err = ss.replaceRecoveryCodes(ctx, tx, userID, codeHashes, confirmedAt)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UseTotpStep records that the code of step was used. ErrTotpStepUsed is returned if the step, or a later one,
+// was used before, so every code is accepted only once.
+func (ss *StoreService) UseTotpStep(ctx context.Context, userID int64, step int64) error {
+	sqlStatement := `
+		UPDATE public.user_totp
+		SET last_used_step = $2
+		WHERE user_id = $1 AND confirmed_at IS NOT NULL AND last_used_step < $2
+	`
+	result, err := ss.conn().ExecContext(ctx, sqlStatement, userID, step)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrTotpStepUsed
+	}
+
+	return nil
+}
+
+// DeleteUserTotp turns off two-factor authentication for the user, removing the recovery codes as well.
+// sql.ErrNoRows is returned if the user has no TOTP secret.
+func (ss *StoreService) DeleteUserTotp(ctx context.Context, userID int64) error {
+	tx, err := ss.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	sqlStatement := `
+		DELETE FROM public.recovery_code
+		WHERE user_id = $1
+	`
+	_, err = tx.ExecContext(ctx, sqlStatement, userID)
+	if err != nil {
+		return err
+	}
+
+	sqlStatement = `
+		DELETE FROM public.user_totp
+		WHERE user_id = $1
+	`
+	result, err := tx.ExecContext(ctx, sqlStatement, userID)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return tx.Commit()
+}
+
+// ReplaceRecoveryCodes invalidates the recovery codes of the user and stores new ones.
+func (ss *StoreService) ReplaceRecoveryCodes(ctx context.Context, userID int64, codeHashes []string, createdAt int64) error {
+	tx, err := ss.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = ss.replaceRecoveryCodes(ctx, tx, userID, codeHashes, createdAt)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (ss *StoreService) replaceRecoveryCodes(ctx context.Context, tx querier, userID int64, codeHashes []string, createdAt int64) error {
+	sqlStatement := `
+		DELETE FROM public.recovery_code
+		WHERE user_id = $1
+	`
+	_, err := tx.ExecContext(ctx, sqlStatement, userID)
+	if err != nil {
+		return err
+	}
+
+	sqlStatement = `
+		INSERT INTO public.recovery_code
+		(user_id, code_hash, created_at)
+		VALUES($1, $2, $3)
+	`
+	for _, codeHash := range codeHashes {
+		_, err = tx.ExecContext(ctx, sqlStatement, userID, codeHash, createdAt)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// UseRecoveryCode consumes the unused recovery code with the given hash. sql.ErrNoRows is returned if there is none.
+func (ss *StoreService) UseRecoveryCode(ctx context.Context, userID int64, codeHash string, usedAt int64) error {
+	sqlStatement := `
+		UPDATE public.recovery_code
+		SET used_at = $3
+		WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL
+	`
+	result, err := ss.conn().ExecContext(ctx, sqlStatement, userID, codeHash, usedAt)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// CountRecoveryCodes returns the number of recovery codes the user has not used yet.
+func (ss *StoreService) CountRecoveryCodes(ctx context.Context, userID int64) (int, error) {
+	var count int
+	sqlStatement := `
+		SELECT count(*)
+		FROM public.recovery_code
+		WHERE user_id = $1 AND used_at IS NULL
+	`
+	err := ss.conn().QueryRowContext(ctx, sqlStatement, userID).
+		Scan(&count)
+
+	return count, err
+}
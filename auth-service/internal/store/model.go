@@ -1,16 +1,17 @@
 package store
 
 type User struct {
-	Id         int64
-	JobRoleId  int
-	AddressId  int64
-	Name       string
-	SecondName string
-	Surname    string
-	Email      string
-	Password   string
-	Birthday   int64
-	IsActive   bool
+	Id            int64
+	JobRoleId     int
+	AddressId     int64
+	Name          string
+	SecondName    string
+	Surname       string
+	Email         string
+	Password      string
+	Birthday      int64
+	IsActive      bool
+	EmailVerified bool
 }
 
 type Address struct {
@@ -25,26 +26,157 @@ type Address struct {
 	FlatNumber       string
 }
 
+// UserProfile is the user together with its address, job role and settlement type.
+type UserProfile struct {
+	User           User
+	JobRole        *JobRole
+	RoleName       string
+	Address        *Address
+	SettlementType *SettlementType
+}
+
+// UserFilter selects users for the admin user list. Zero JobRoleId, nil IsActive and empty Search match every user.
+type UserFilter struct {
+	JobRoleId int
+	IsActive  *bool
+	Search    string
+	Limit     int
+	Offset    int
+}
+
+type RefreshToken struct {
+	Id            int64
+	UserId        int64
+	FamilyId      string
+	TokenHash     string
+	AccessTokenId string
+	DeviceInfo    string
+	CreatedAt     int64
+	ExpiresAt     int64
+	UsedAt        *int64
+	RevokedAt     *int64
+}
+
+// Session is a login of the user on one device, the refresh token family with the same id.
+// It is active while the family has a refresh token that is neither used, revoked nor expired;
+// ExpiresAt is the expiry of that token.
+type Session struct {
+	Id         string
+	UserId     int64
+	IpAddress  string
+	UserAgent  string
+	CreatedAt  int64
+	LastUsedAt int64
+	ExpiresAt  int64
+}
+
+const (
+	TokenPurposePasswordReset     = "password_reset"
+	TokenPurposeEmailVerification = "email_verification"
+	TokenPurposeEmailChange       = "email_change"
+	TokenPurposeMfaChallenge      = "mfa_challenge"
+	// the payload of WebAuthn ceremony tokens is the session of the ceremony
+	TokenPurposeWebAuthnRegistration = "webauthn_registration"
+	TokenPurposeWebAuthnLogin        = "webauthn_login"
+)
+
+// UserToken is a single-use token sent to the user, e.g. in a password reset link.
+type UserToken struct {
+	Id        int64
+	UserId    int64
+	Purpose   string
+	TokenHash string
+	Payload   string
+	CreatedAt int64
+	ExpiresAt int64
+	UsedAt    *int64
+}
+
+// UserTotp is the TOTP secret of the user. It is required at login only once the enrollment is confirmed.
+type UserTotp struct {
+	UserId       int64
+	Secret       string
+	CreatedAt    int64
+	ConfirmedAt  *int64
+	LastUsedStep int64
+}
+
+type RecoveryCode struct {
+	Id        int64
+	UserId    int64
+	CodeHash  string
+	CreatedAt int64
+	UsedAt    *int64
+}
+
+// WebAuthnCredential is a passkey of the user. CredentialId is the base64url encoded id chosen by
+// the authenticator, Data the JSON of the public key and counters verified at login.
+type WebAuthnCredential struct {
+	Id           int64
+	UserId       int64
+	CredentialId string
+	Name         string
+	Data         string
+	CreatedAt    int64
+	LastUsedAt   *int64
+}
+
+type RevokedToken struct {
+	Jti       string
+	UserId    int64
+	ExpiresAt int64
+	RevokedAt int64
+}
+
+const (
+	VideoEventStream = "stream"
+	VideoEventView   = "view"
+)
+
 type VideoHistory struct {
 	Id        int64
-	UerId     int64
+	UserId    int64
 	User      User
 	VideoName string
+	Event     string
 	CreatedAt int64
 }
 
+type VideoHistoryFilter struct {
+	UserId int64
+	From   int64
+	To     int64
+	Limit  int
+	Offset int
+}
+
+const (
+	RoleClient = "client"
+	RoleAdmin  = "admin"
+)
+
+type UserRole struct {
+	JobRoleId   int
+	JobRoleName string
+	RoleId      int
+	RoleName    string
+}
+
 type Role struct {
 	Id   int
 	Name string
 }
 
 type JobRole struct {
-	Id      int
-	Role_id int
-	Name    string
+	Id       int
+	Role_id  int
+	RoleName string
+	Name     string
+	Retired  bool
 }
 
 type SettlementType struct {
-	Id   int
-	Name string
+	Id      int
+	Name    string
+	Retired bool
 }
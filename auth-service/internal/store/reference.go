@@ -0,0 +1,190 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+)
+
+// FindJobRoles lists the job roles with the name of the role they grant. Retired job roles
+// are left out unless includeRetired is set.
+func (ss *StoreService) FindJobRoles(ctx context.Context, includeRetired bool) ([]JobRole, error) {
+	sqlStatement := `
+		SELECT job_role.id, COALESCE(job_role.role_id, 0), COALESCE(role.name, ''), job_role.name, job_role.retired
+		FROM public.job_role
+		LEFT JOIN public.role ON role.id = job_role.role_id
+		WHERE $1 OR NOT job_role.retired
+		ORDER BY job_role.id
+	`
+	rows, err := ss.conn().QueryContext(ctx, sqlStatement, includeRetired)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobRoles := make([]JobRole, 0)
+	for rows.Next() {
+		var jobRole JobRole
+		err = rows.Scan(&jobRole.Id, &jobRole.Role_id, &jobRole.RoleName, &jobRole.Name, &jobRole.Retired)
+		if err != nil {
+			return nil, err
+		}
+		if jobRole.RoleName == "" {
+			jobRole.RoleName = RoleClient
+		}
+		jobRoles = append(jobRoles, jobRole)
+	}
+
+	return jobRoles, rows.Err()
+}
+
+func (ss *StoreService) FindJobRole(ctx context.Context, id int) (*JobRole, error) {
+	var jobRole JobRole
+	sqlStatement := `
+		SELECT job_role.id, COALESCE(job_role.role_id, 0), COALESCE(role.name, ''), job_role.name, job_role.retired
+		FROM public.job_role
+		LEFT JOIN public.role ON role.id = job_role.role_id
+		WHERE job_role.id = $1
+	`
+	err := ss.conn().QueryRowContext(ctx, sqlStatement, id).
+		Scan(&jobRole.Id, &jobRole.Role_id, &jobRole.RoleName, &jobRole.Name, &jobRole.Retired)
+	if err != nil {
+		return nil, err
+	}
+	if jobRole.RoleName == "" {
+		jobRole.RoleName = RoleClient
+	}
+
+	return &jobRole, nil
+}
+
+// CreateJobRole adds a job role granting the role named roleName.
+func (ss *StoreService) CreateJobRole(ctx context.Context, name, roleName string) (int, error) {
+	var jobRoleID int
+	sqlStatement := `
+		INSERT INTO public.job_role
+		(role_id, "name")
+		VALUES((SELECT id FROM public.role WHERE "name" = $1), $2)
+		RETURNING id
+	`
+	err := ss.conn().QueryRowContext(ctx, sqlStatement, roleName, name).
+		Scan(&jobRoleID)
+
+	return jobRoleID, translateError(err)
+}
+
+// RenameJobRole changes the name of the job role. sql.ErrNoRows is returned for an unknown job role.
+func (ss *StoreService) RenameJobRole(ctx context.Context, id int, name string) error {
+	sqlStatement := `
+		UPDATE public.job_role
+		SET "name" = $2
+		WHERE id = $1
+	`
+	return ss.execAffectingRow(ctx, sqlStatement, id, name)
+}
+
+// RetireJobRole hides the job role from new registrations. Users keep it until an admin changes it.
+// sql.ErrNoRows is returned for an unknown job role.
+func (ss *StoreService) RetireJobRole(ctx context.Context, id int) error {
+	sqlStatement := `
+		UPDATE public.job_role
+		SET retired = true
+		WHERE id = $1
+	`
+	return ss.execAffectingRow(ctx, sqlStatement, id)
+}
+
+// FindSettlementTypes lists the settlement types. Retired ones are left out unless includeRetired is set.
+func (ss *StoreService) FindSettlementTypes(ctx context.Context, includeRetired bool) ([]SettlementType, error) {
+	sqlStatement := `
+		SELECT id, "name", retired
+		FROM public.settlement_type
+		WHERE $1 OR NOT retired
+		ORDER BY id
+	`
+	rows, err := ss.conn().QueryContext(ctx, sqlStatement, includeRetired)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	settlementTypes := make([]SettlementType, 0)
+	for rows.Next() {
+		var settlementType SettlementType
+		err = rows.Scan(&settlementType.Id, &settlementType.Name, &settlementType.Retired)
+		if err != nil {
+			return nil, err
+		}
+		settlementTypes = append(settlementTypes, settlementType)
+	}
+
+	return settlementTypes, rows.Err()
+}
+
+func (ss *StoreService) FindSettlementType(ctx context.Context, id int) (*SettlementType, error) {
+	var settlementType SettlementType
+	sqlStatement := `
+		SELECT id, "name", retired
+		FROM public.settlement_type
+		WHERE id = $1
+	`
+	err := ss.conn().QueryRowContext(ctx, sqlStatement, id).
+		Scan(&settlementType.Id, &settlementType.Name, &settlementType.Retired)
+	if err != nil {
+		return nil, err
+	}
+
+	return &settlementType, nil
+}
+
+func (ss *StoreService) CreateSettlementType(ctx context.Context, name string) (int, error) {
+	var settlementTypeID int
+	sqlStatement := `
+		INSERT INTO public.settlement_type
+		("name")
+		VALUES($1)
+		RETURNING id
+	`
+	err := ss.conn().QueryRowContext(ctx, sqlStatement, name).
+		Scan(&settlementTypeID)
+
+	return settlementTypeID, translateError(err)
+}
+
+// RenameSettlementType changes the name of the settlement type. sql.ErrNoRows is returned for an unknown settlement type.
+func (ss *StoreService) RenameSettlementType(ctx context.Context, id int, name string) error {
+	sqlStatement := `
+		UPDATE public.settlement_type
+		SET "name" = $2
+		WHERE id = $1
+	`
+	return ss.execAffectingRow(ctx, sqlStatement, id, name)
+}
+
+// RetireSettlementType hides the settlement type from new addresses. Existing addresses keep it.
+// sql.ErrNoRows is returned for an unknown settlement type.
+func (ss *StoreService) RetireSettlementType(ctx context.Context, id int) error {
+	sqlStatement := `
+		UPDATE public.settlement_type
+		SET retired = true
+		WHERE id = $1
+	`
+	return ss.execAffectingRow(ctx, sqlStatement, id)
+}
+
+// execAffectingRow runs an update and returns sql.ErrNoRows if it did not touch any row.
+func (ss *StoreService) execAffectingRow(ctx context.Context, sqlStatement string, args ...any) error {
+	result, err := ss.conn().ExecContext(ctx, sqlStatement, args...)
+	if err != nil {
+		return translateError(err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
@@ -4,24 +4,25 @@ import (
 	"context"
 	"database/sql"
 	"log/slog"
+	"strings"
 )
 
+// StoreService is the Postgres implementation of UserStore.
 type StoreService struct {
 	db     *sql.DB
+	tx     *sql.Tx
 	logger *slog.Logger
-	ctx    *context.Context
 }
 
-func NewDbService(db *sql.DB, logger *slog.Logger, ctx *context.Context) *StoreService {
+func NewDbService(db *sql.DB, logger *slog.Logger) *StoreService {
 	return &StoreService{
 		db:     db,
 		logger: logger,
-		ctx:    ctx,
 	}
 }
 
-func (ss *StoreService) CreateAddress(address *Address) (int64, error) {
-	tx, err := ss.db.Begin()
+func (ss *StoreService) CreateAddress(ctx context.Context, address *Address) (int64, error) {
+	tx, err := ss.begin(ctx)
 	if err != nil {
 		return 0, err
 	}
@@ -34,7 +35,7 @@ func (ss *StoreService) CreateAddress(address *Address) (int64, error) {
 		VALUES($1, $2, $3, $4, $5, $6, $7, $8)
 		RETURNING id
 	`
-	err = tx.QueryRowContext(*ss.ctx, sqlStatement,
+	err = tx.QueryRowContext(ctx, sqlStatement,
 		address.SettlementTypeId, address.Country, address.Region, address.District,
 		address.Settlement, address.Street, address.HouseNumber, address.FlatNumber).
 		Scan(&addressID)
@@ -50,8 +51,9 @@ func (ss *StoreService) CreateAddress(address *Address) (int64, error) {
 	return addressID, nil
 }
 
-func (ss *StoreService) CreateUser(user *User) (int64, error) {
-	tx, err := ss.db.Begin()
+// CreateUser inserts the user. A zero AddressId leaves the user without an address.
+func (ss *StoreService) CreateUser(ctx context.Context, user *User) (int64, error) {
+	tx, err := ss.begin(ctx)
 	if err != nil {
 		return 0, err
 	}
@@ -60,17 +62,17 @@ func (ss *StoreService) CreateUser(user *User) (int64, error) {
 	var userID int64
 	sqlStatement := `
 		INSERT INTO public."user"
-		(job_role_id, address_id, "name", second_name, surname, email, "password", birthday, is_active)
-		VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		(job_role_id, address_id, "name", second_name, surname, email, "password", birthday, is_active, email_verified)
+		VALUES($1, NULLIF($2::bigint, 0), $3, $4, $5, $6, $7, $8, $9, $10)
 		RETURNING id
 	`
-	err = tx.QueryRowContext(*ss.ctx, sqlStatement,
+	err = tx.QueryRowContext(ctx, sqlStatement,
 		user.JobRoleId, user.AddressId, user.Name, user.SecondName, user.Surname,
-		user.Email, user.Password, user.Birthday, user.IsActive).
+		user.Email, user.Password, user.Birthday, user.IsActive, user.EmailVerified).
 		Scan(&userID)
 
 	if err != nil {
-		return userID, err
+		return userID, translateError(err)
 	}
 
 	err = tx.Commit()
@@ -80,8 +82,8 @@ func (ss *StoreService) CreateUser(user *User) (int64, error) {
 	return userID, nil
 }
 
-func (ss *StoreService) FindUserByEmail(email string) (*User, error) {
-	tx, err := ss.db.Begin()
+func (ss *StoreService) FindUserByEmail(ctx context.Context, email string) (*User, error) {
+	tx, err := ss.begin(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -89,15 +91,16 @@ func (ss *StoreService) FindUserByEmail(email string) (*User, error) {
 
 	var user User
 	sqlStatement := `
-		SELECT id, job_role_id, address_id, "name", second_name, surname,
-		email, "password", birthday, is_active
+		SELECT id, COALESCE(job_role_id, 0), COALESCE(address_id, 0),
+		COALESCE("name", ''), COALESCE(second_name, ''), COALESCE(surname, ''),
+		email, "password", birthday, is_active, email_verified
 		FROM public."user"
-		WHERE "user".email = $1
+		WHERE lower("user".email) = lower($1)
 	`
-	err = tx.QueryRowContext(*ss.ctx, sqlStatement, email).
+	err = tx.QueryRowContext(ctx, sqlStatement, email).
 		Scan(
 			&user.Id, &user.JobRoleId, &user.AddressId, &user.Name, &user.SecondName,
-			&user.Surname, &user.Email, &user.Password, &user.Birthday, &user.IsActive,
+			&user.Surname, &user.Email, &user.Password, &user.Birthday, &user.IsActive, &user.EmailVerified,
 		)
 	if err != nil {
 		return &user, err
@@ -109,3 +112,840 @@ func (ss *StoreService) FindUserByEmail(email string) (*User, error) {
 	}
 	return &user, nil
 }
+
+func (ss *StoreService) FindUserById(ctx context.Context, id int64) (*User, error) {
+	tx, err := ss.begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var user User
+	sqlStatement := `
+		SELECT id, COALESCE(job_role_id, 0), COALESCE(address_id, 0),
+		COALESCE("name", ''), COALESCE(second_name, ''), COALESCE(surname, ''),
+		email, "password", birthday, is_active, email_verified
+		FROM public."user"
+		WHERE "user".id = $1
+	`
+	err = tx.QueryRowContext(ctx, sqlStatement, id).
+		Scan(
+			&user.Id, &user.JobRoleId, &user.AddressId, &user.Name, &user.SecondName,
+			&user.Surname, &user.Email, &user.Password, &user.Birthday, &user.IsActive, &user.EmailVerified,
+		)
+	if err != nil {
+		return &user, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// userProfileQuery selects the user together with its job role, role, address and settlement type.
+// It is scanned by scanUserProfile.
+const userProfileQuery = `
+	SELECT "user".id, COALESCE("user"."name", ''), COALESCE("user".second_name, ''), COALESCE("user".surname, ''),
+	"user".email, "user".birthday, "user".is_active, "user".email_verified,
+	job_role.id, job_role.role_id, job_role.name, COALESCE(job_role.retired, false), role.name,
+	address.id, address.country, address.region, address.district, address.settlement,
+	address.street, address.house_number, address.flat_number,
+	settlement_type.id, settlement_type.name, COALESCE(settlement_type.retired, false)
+	FROM public."user"
+	LEFT JOIN public.job_role ON job_role.id = "user".job_role_id
+	LEFT JOIN public.role ON role.id = job_role.role_id
+	LEFT JOIN public.address ON address.id = "user".address_id
+	LEFT JOIN public.settlement_type ON settlement_type.id = address.settlement_type_id
+`
+
+// FindUserProfile loads the user together with its address, job role and settlement type.
+func (ss *StoreService) FindUserProfile(ctx context.Context, userID int64) (*UserProfile, error) {
+	sqlStatement := userProfileQuery + `
+		WHERE "user".id = $1
+	`
+	return scanUserProfile(ss.conn().QueryRowContext(ctx, sqlStatement, userID))
+}
+
+// FindUserProfiles returns one page of users matching the filter, ordered by id, together with
+// the total number of matching users.
+func (ss *StoreService) FindUserProfiles(ctx context.Context, filter UserFilter) ([]UserProfile, int, error) {
+	var search string
+	if filter.Search != "" {
+		search = "%" + escapeLike(filter.Search) + "%"
+	}
+	where := `
+		WHERE ($1::integer = 0 OR "user".job_role_id = $1)
+		AND ($2::boolean IS NULL OR "user".is_active = $2)
+		AND ($3::text = '' OR "user".email ILIKE $3 OR "user"."name" ILIKE $3
+		OR "user".second_name ILIKE $3 OR "user".surname ILIKE $3)
+	`
+
+	var total int
+	sqlStatement := `
+		SELECT count(*)
+		FROM public."user"
+	` + where
+	err := ss.conn().QueryRowContext(ctx, sqlStatement, filter.JobRoleId, filter.IsActive, search).
+		Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	sqlStatement = userProfileQuery + where + `
+		ORDER BY "user".id
+		LIMIT $4 OFFSET $5
+	`
+	rows, err := ss.conn().QueryContext(ctx, sqlStatement,
+		filter.JobRoleId, filter.IsActive, search, filter.Limit, filter.Offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	profiles := make([]UserProfile, 0)
+	for rows.Next() {
+		profile, err := scanUserProfile(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		profiles = append(profiles, *profile)
+	}
+
+	return profiles, total, rows.Err()
+}
+
+func scanUserProfile(row interface{ Scan(...any) error }) (*UserProfile, error) {
+	var profile UserProfile
+	var jobRoleRetired, settlementTypeRetired bool
+	var jobRoleID, jobRoleRoleID, addressID, settlementTypeID sql.NullInt64
+	var jobRoleName, roleName, settlementTypeName sql.NullString
+	var country, region, district, settlement, street, houseNumber, flatNumber sql.NullString
+	user := &profile.User
+	err := row.Scan(
+		&user.Id, &user.Name, &user.SecondName, &user.Surname,
+		&user.Email, &user.Birthday, &user.IsActive, &user.EmailVerified,
+		&jobRoleID, &jobRoleRoleID, &jobRoleName, &jobRoleRetired, &roleName,
+		&addressID, &country, &region, &district, &settlement,
+		&street, &houseNumber, &flatNumber,
+		&settlementTypeID, &settlementTypeName, &settlementTypeRetired,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	user.JobRoleId = int(jobRoleID.Int64)
+	user.AddressId = addressID.Int64
+	profile.RoleName = roleName.String
+
+	if jobRoleID.Valid {
+		profile.JobRole = &JobRole{
+			Id:       int(jobRoleID.Int64),
+			Role_id:  int(jobRoleRoleID.Int64),
+			RoleName: profile.RoleName,
+			Name:     jobRoleName.String,
+			Retired:  jobRoleRetired,
+		}
+	}
+
+	if addressID.Valid {
+		profile.Address = &Address{
+			Id:               addressID.Int64,
+			SettlementTypeId: int(settlementTypeID.Int64),
+			Country:          country.String,
+			Region:           region.String,
+			District:         district.String,
+			Settlement:       settlement.String,
+			Street:           street.String,
+			HouseNumber:      houseNumber.String,
+			FlatNumber:       flatNumber.String,
+		}
+		profile.SettlementType = &SettlementType{
+			Id:      int(settlementTypeID.Int64),
+			Name:    settlementTypeName.String,
+			Retired: settlementTypeRetired,
+		}
+	}
+
+	return &profile, nil
+}
+
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(value)
+}
+
+// UpdateUserProfile stores the personal data of the user. Email, password and flags are changed by dedicated methods.
+func (ss *StoreService) UpdateUserProfile(ctx context.Context, user *User) error {
+	sqlStatement := `
+		UPDATE public."user"
+		SET "name" = $2, second_name = $3, surname = $4, birthday = $5
+		WHERE id = $1
+	`
+	_, err := ss.conn().ExecContext(ctx, sqlStatement,
+		user.Id, user.Name, user.SecondName, user.Surname, user.Birthday)
+
+	return err
+}
+
+func (ss *StoreService) UpdateAddress(ctx context.Context, address *Address) error {
+	sqlStatement := `
+		UPDATE public.address
+		SET settlement_type_id = $2, country = $3, region = $4, district = $5,
+		settlement = $6, street = $7, house_number = $8, flat_number = $9
+		WHERE id = $1
+	`
+	_, err := ss.conn().ExecContext(ctx, sqlStatement,
+		address.Id, address.SettlementTypeId, address.Country, address.Region, address.District,
+		address.Settlement, address.Street, address.HouseNumber, address.FlatNumber)
+
+	return err
+}
+
+func (ss *StoreService) SetUserAddress(ctx context.Context, userID int64, addressID int64) error {
+	sqlStatement := `
+		UPDATE public."user"
+		SET address_id = $2
+		WHERE id = $1
+	`
+	_, err := ss.conn().ExecContext(ctx, sqlStatement, userID, addressID)
+
+	return err
+}
+
+// SetUserActive deactivates or reactivates the user. sql.ErrNoRows is returned for an unknown user.
+func (ss *StoreService) SetUserActive(ctx context.Context, userID int64, isActive bool) error {
+	sqlStatement := `
+		UPDATE public."user"
+		SET is_active = $2
+		WHERE id = $1
+	`
+	result, err := ss.conn().ExecContext(ctx, sqlStatement, userID, isActive)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// SetUserJobRole changes the job role, and with it the role, of the user. sql.ErrNoRows is returned for an unknown user.
+func (ss *StoreService) SetUserJobRole(ctx context.Context, userID int64, jobRoleID int) error {
+	sqlStatement := `
+		UPDATE public."user"
+		SET job_role_id = $2
+		WHERE id = $1
+	`
+	result, err := ss.conn().ExecContext(ctx, sqlStatement, userID, jobRoleID)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// DeleteUser removes the user together with its address and video history. Tokens are removed
+// by the database. sql.ErrNoRows is returned for an unknown user.
+func (ss *StoreService) DeleteUser(ctx context.Context, userID int64) error {
+	tx, err := ss.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	sqlStatement := `
+		DELETE FROM public.video_history
+		WHERE user_id = $1
+	`
+	_, err = tx.ExecContext(ctx, sqlStatement, userID)
+	if err != nil {
+		return err
+	}
+
+	var addressID sql.NullInt64
+	sqlStatement = `
+		DELETE FROM public."user"
+		WHERE id = $1
+		RETURNING address_id
+	`
+	err = tx.QueryRowContext(ctx, sqlStatement, userID).Scan(&addressID)
+	if err != nil {
+		return err
+	}
+
+	if addressID.Valid {
+		sqlStatement = `
+			DELETE FROM public.address
+			WHERE id = $1
+		`
+		_, err = tx.ExecContext(ctx, sqlStatement, addressID.Int64)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (ss *StoreService) FindUserRole(ctx context.Context, userID int64) (*UserRole, error) {
+	var jobRoleID, roleID sql.NullInt64
+	var jobRoleName, roleName sql.NullString
+	sqlStatement := `
+		SELECT job_role.id, job_role.name, role.id, role.name
+		FROM public."user"
+		LEFT JOIN public.job_role ON job_role.id = "user".job_role_id
+		LEFT JOIN public.role ON role.id = job_role.role_id
+		WHERE "user".id = $1
+	`
+	err := ss.conn().QueryRowContext(ctx, sqlStatement, userID).
+		Scan(&jobRoleID, &jobRoleName, &roleID, &roleName)
+	if err != nil {
+		return nil, err
+	}
+
+	role := &UserRole{
+		JobRoleId:   int(jobRoleID.Int64),
+		JobRoleName: jobRoleName.String,
+		RoleId:      int(roleID.Int64),
+		RoleName:    roleName.String,
+	}
+	if !roleName.Valid {
+		role.RoleName = RoleClient
+	}
+
+	return role, nil
+}
+
+func (ss *StoreService) CreateRefreshToken(ctx context.Context, token *RefreshToken) (int64, error) {
+	tx, err := ss.begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	tokenID, err := ss.insertRefreshToken(ctx, tx, token)
+	if err != nil {
+		return 0, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+	return tokenID, nil
+}
+
+func (ss *StoreService) FindRefreshTokenByHash(ctx context.Context, tokenHash string) (*RefreshToken, error) {
+	tx, err := ss.begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var token RefreshToken
+	var deviceInfo sql.NullString
+	sqlStatement := `
+		SELECT id, user_id, family_id, token_hash, access_token_id, device_info,
+		created_at, expires_at, used_at, revoked_at
+		FROM public.refresh_token
+		WHERE refresh_token.token_hash = $1
+	`
+	err = tx.QueryRowContext(ctx, sqlStatement, tokenHash).
+		Scan(
+			&token.Id, &token.UserId, &token.FamilyId, &token.TokenHash, &token.AccessTokenId, &deviceInfo,
+			&token.CreatedAt, &token.ExpiresAt, &token.UsedAt, &token.RevokedAt,
+		)
+	if err != nil {
+		return nil, err
+	}
+	token.DeviceInfo = deviceInfo.String
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// RotateRefreshToken marks the old refresh token as used and stores its replacement in one transaction.
+// ErrRefreshTokenUsed is returned if the old token was used or revoked concurrently.
+func (ss *StoreService) RotateRefreshToken(ctx context.Context, oldTokenID int64, usedAt int64, newToken *RefreshToken) (int64, error) {
+	tx, err := ss.begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	sqlStatement := `
+		UPDATE public.refresh_token
+		SET used_at = $2
+		WHERE id = $1 AND used_at IS NULL AND revoked_at IS NULL
+	`
+	result, err := tx.ExecContext(ctx, sqlStatement, oldTokenID, usedAt)
+	if err != nil {
+		return 0, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	if affected == 0 {
+		return 0, ErrRefreshTokenUsed
+	}
+
+	tokenID, err := ss.insertRefreshToken(ctx, tx, newToken)
+	if err != nil {
+		return 0, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+	return tokenID, nil
+}
+
+func (ss *StoreService) RevokeRefreshTokenFamily(ctx context.Context, familyID string, revokedAt int64) error {
+	tx, err := ss.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	sqlStatement := `
+		UPDATE public.refresh_token
+		SET revoked_at = $2
+		WHERE family_id = $1 AND revoked_at IS NULL
+	`
+	_, err = tx.ExecContext(ctx, sqlStatement, familyID, revokedAt)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (ss *StoreService) insertRefreshToken(ctx context.Context, tx querier, token *RefreshToken) (int64, error) {
+	var tokenID int64
+	sqlStatement := `
+		INSERT INTO public.refresh_token
+		(user_id, family_id, token_hash, access_token_id, device_info, created_at, expires_at)
+		VALUES($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id
+	`
+	err := tx.QueryRowContext(ctx, sqlStatement,
+		token.UserId, token.FamilyId, token.TokenHash, token.AccessTokenId,
+		token.DeviceInfo, token.CreatedAt, token.ExpiresAt).
+		Scan(&tokenID)
+
+	return tokenID, err
+}
+
+func (ss *StoreService) FindRefreshTokenByAccessTokenId(ctx context.Context, accessTokenID string) (*RefreshToken, error) {
+	tx, err := ss.begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var token RefreshToken
+	var deviceInfo sql.NullString
+	sqlStatement := `
+		SELECT id, user_id, family_id, token_hash, access_token_id, device_info,
+		created_at, expires_at, used_at, revoked_at
+		FROM public.refresh_token
+		WHERE refresh_token.access_token_id = $1
+	`
+	err = tx.QueryRowContext(ctx, sqlStatement, accessTokenID).
+		Scan(
+			&token.Id, &token.UserId, &token.FamilyId, &token.TokenHash, &token.AccessTokenId, &deviceInfo,
+			&token.CreatedAt, &token.ExpiresAt, &token.UsedAt, &token.RevokedAt,
+		)
+	if err != nil {
+		return nil, err
+	}
+	token.DeviceInfo = deviceInfo.String
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// RevokeUserRefreshTokens revokes every refresh token of the user, except the ones in keepFamilyID if it is set,
+// and returns the ids of the access tokens issued since createdSince, which may still be valid
+// and have to be denylisted by the caller.
+func (ss *StoreService) RevokeUserRefreshTokens(ctx context.Context, userID int64, keepFamilyID string, revokedAt int64, createdSince int64) ([]string, error) {
+	tx, err := ss.begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	sqlStatement := `
+		UPDATE public.refresh_token
+		SET revoked_at = $2
+		WHERE user_id = $1 AND family_id <> $3 AND revoked_at IS NULL
+	`
+	_, err = tx.ExecContext(ctx, sqlStatement, userID, revokedAt, keepFamilyID)
+	if err != nil {
+		return nil, err
+	}
+
+	sqlStatement = `
+		SELECT access_token_id
+		FROM public.refresh_token
+		WHERE user_id = $1 AND family_id <> $3 AND created_at >= $2
+	`
+	rows, err := tx.QueryContext(ctx, sqlStatement, userID, createdSince, keepFamilyID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var accessTokenIDs []string
+	for rows.Next() {
+		var accessTokenID string
+		err = rows.Scan(&accessTokenID)
+		if err != nil {
+			return nil, err
+		}
+		accessTokenIDs = append(accessTokenIDs, accessTokenID)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return accessTokenIDs, nil
+}
+
+func (ss *StoreService) CreateRevokedTokens(ctx context.Context, tokens []RevokedToken) error {
+	tx, err := ss.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	sqlStatement := `
+		INSERT INTO public.revoked_token
+		(jti, user_id, expires_at, revoked_at)
+		VALUES($1, $2, $3, $4)
+		ON CONFLICT (jti) DO NOTHING
+	`
+	for _, token := range tokens {
+		_, err = tx.ExecContext(ctx, sqlStatement, token.Jti, token.UserId, token.ExpiresAt, token.RevokedAt)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// FindRevokedTokens returns the revoked tokens that have not expired yet at the given time.
+func (ss *StoreService) FindRevokedTokens(ctx context.Context, now int64) ([]RevokedToken, error) {
+	sqlStatement := `
+		SELECT jti, user_id, expires_at, revoked_at
+		FROM public.revoked_token
+		WHERE expires_at > $1
+	`
+	rows, err := ss.conn().QueryContext(ctx, sqlStatement, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []RevokedToken
+	for rows.Next() {
+		var token RevokedToken
+		err = rows.Scan(&token.Jti, &token.UserId, &token.ExpiresAt, &token.RevokedAt)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, token)
+	}
+
+	return tokens, rows.Err()
+}
+
+func (ss *StoreService) DeleteExpiredRevokedTokens(ctx context.Context, now int64) error {
+	sqlStatement := `
+		DELETE FROM public.revoked_token
+		WHERE expires_at <= $1
+	`
+	_, err := ss.conn().ExecContext(ctx, sqlStatement, now)
+	return err
+}
+
+func (ss *StoreService) CreateVideoHistory(ctx context.Context, history *VideoHistory) (int64, error) {
+	var historyID int64
+	sqlStatement := `
+		INSERT INTO public.video_history
+		(user_id, video_name, event, created_at)
+		VALUES($1, $2, $3, $4)
+		RETURNING id
+	`
+	err := ss.conn().QueryRowContext(ctx, sqlStatement,
+		history.UserId, history.VideoName, history.Event, history.CreatedAt).
+		Scan(&historyID)
+
+	return historyID, err
+}
+
+// FindVideoHistory returns one page of the user's history, newest first, together with the total
+// number of entries matching the filter. Zero From/To leave that side of the time range open.
+func (ss *StoreService) FindVideoHistory(ctx context.Context, filter VideoHistoryFilter) ([]VideoHistory, int, error) {
+	var total int
+	sqlStatement := `
+		SELECT count(*)
+		FROM public.video_history
+		WHERE user_id = $1
+		AND ($2::bigint = 0 OR created_at >= $2)
+		AND ($3::bigint = 0 OR created_at < $3)
+	`
+	err := ss.conn().QueryRowContext(ctx, sqlStatement, filter.UserId, filter.From, filter.To).
+		Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	sqlStatement = `
+		SELECT id, user_id, video_name, event, created_at
+		FROM public.video_history
+		WHERE user_id = $1
+		AND ($2::bigint = 0 OR created_at >= $2)
+		AND ($3::bigint = 0 OR created_at < $3)
+		ORDER BY created_at DESC, id DESC
+		LIMIT $4 OFFSET $5
+	`
+	rows, err := ss.conn().QueryContext(ctx, sqlStatement,
+		filter.UserId, filter.From, filter.To, filter.Limit, filter.Offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	history := make([]VideoHistory, 0)
+	for rows.Next() {
+		var entry VideoHistory
+		err = rows.Scan(&entry.Id, &entry.UserId, &entry.VideoName, &entry.Event, &entry.CreatedAt)
+		if err != nil {
+			return nil, 0, err
+		}
+		history = append(history, entry)
+	}
+
+	return history, total, rows.Err()
+}
+
+func (ss *StoreService) CreateUserToken(ctx context.Context, token *UserToken) (int64, error) {
+	var tokenID int64
+	sqlStatement := `
+		INSERT INTO public.user_token
+		(user_id, purpose, token_hash, payload, created_at, expires_at)
+		VALUES($1, $2, $3, $4, $5, $6)
+		RETURNING id
+	`
+	err := ss.conn().QueryRowContext(ctx, sqlStatement,
+		token.UserId, token.Purpose, token.TokenHash, token.Payload, token.CreatedAt, token.ExpiresAt).
+		Scan(&tokenID)
+
+	return tokenID, err
+}
+
+func (ss *StoreService) FindUserTokenByHash(ctx context.Context, purpose, tokenHash string) (*UserToken, error) {
+	var token UserToken
+	var payload sql.NullString
+	sqlStatement := `
+		SELECT id, user_id, purpose, token_hash, payload, created_at, expires_at, used_at
+		FROM public.user_token
+		WHERE user_token.purpose = $1 AND user_token.token_hash = $2
+	`
+	err := ss.conn().QueryRowContext(ctx, sqlStatement, purpose, tokenHash).
+		Scan(
+			&token.Id, &token.UserId, &token.Purpose, &token.TokenHash, &payload,
+			&token.CreatedAt, &token.ExpiresAt, &token.UsedAt,
+		)
+	if err != nil {
+		return nil, err
+	}
+	token.Payload = payload.String
+
+	return &token, nil
+}
+
+// ResetUserPassword consumes the reset token, invalidates the other pending reset tokens of the user
+// and stores the new password hash in one transaction.
+func (ss *StoreService) ResetUserPassword(ctx context.Context, token *UserToken, usedAt int64, password string) error {
+	tx, err := ss.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = ss.useUserToken(ctx, tx, token.Id, usedAt)
+	if err != nil {
+		return err
+	}
+
+	sqlStatement := `
+		UPDATE public.user_token
+		SET used_at = $3
+		WHERE user_id = $1 AND purpose = $2 AND used_at IS NULL
+	`
+	_, err = tx.ExecContext(ctx, sqlStatement, token.UserId, token.Purpose, usedAt)
+	if err != nil {
+		return err
+	}
+
+	sqlStatement = `
+		UPDATE public."user"
+		SET "password" = $2
+		WHERE id = $1
+	`
+	_, err = tx.ExecContext(ctx, sqlStatement, token.UserId, password)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UpdateUserPassword stores the new password hash. sql.ErrNoRows is returned for an unknown user.
+func (ss *StoreService) UpdateUserPassword(ctx context.Context, userID int64, password string) error {
+	sqlStatement := `
+		UPDATE public."user"
+		SET "password" = $2
+		WHERE id = $1
+	`
+	result, err := ss.conn().ExecContext(ctx, sqlStatement, userID, password)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// ChangeUserEmail consumes the email change token and sets the new email stored in its payload.
+// The new email counts as verified, since the token was delivered to it.
+func (ss *StoreService) ChangeUserEmail(ctx context.Context, token *UserToken, usedAt int64) error {
+	tx, err := ss.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = ss.useUserToken(ctx, tx, token.Id, usedAt)
+	if err != nil {
+		return err
+	}
+
+	sqlStatement := `
+		UPDATE public."user"
+		SET email = $2, email_verified = true
+		WHERE id = $1
+	`
+	_, err = tx.ExecContext(ctx, sqlStatement, token.UserId, token.Payload)
+	if err != nil {
+		return translateError(err)
+	}
+
+	return tx.Commit()
+}
+
+// VerifyUserEmail consumes the verification token and marks the email of its user as verified.
+func (ss *StoreService) VerifyUserEmail(ctx context.Context, token *UserToken, usedAt int64) error {
+	tx, err := ss.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = ss.useUserToken(ctx, tx, token.Id, usedAt)
+	if err != nil {
+		return err
+	}
+
+	sqlStatement := `
+		UPDATE public."user"
+		SET email_verified = true
+		WHERE id = $1
+	`
+	_, err = tx.ExecContext(ctx, sqlStatement, token.UserId)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// FindLastUserTokenTime returns when the latest token with the given purpose was issued to the user, 0 if never.
+func (ss *StoreService) FindLastUserTokenTime(ctx context.Context, userID int64, purpose string) (int64, error) {
+	var createdAt sql.NullInt64
+	sqlStatement := `
+		SELECT max(created_at)
+		FROM public.user_token
+		WHERE user_id = $1 AND purpose = $2
+	`
+	err := ss.conn().QueryRowContext(ctx, sqlStatement, userID, purpose).
+		Scan(&createdAt)
+
+	return createdAt.Int64, err
+}
+
+// UseUserToken consumes a token that grants nothing by itself, e.g. an MFA challenge.
+// ErrUserTokenUsed is returned if it was used before.
+func (ss *StoreService) UseUserToken(ctx context.Context, tokenID int64, usedAt int64) error {
+	return ss.useUserToken(ctx, ss.conn(), tokenID, usedAt)
+}
+
+func (ss *StoreService) useUserToken(ctx context.Context, tx querier, tokenID int64, usedAt int64) error {
+	sqlStatement := `
+		UPDATE public.user_token
+		SET used_at = $2
+		WHERE id = $1 AND used_at IS NULL
+	`
+	result, err := tx.ExecContext(ctx, sqlStatement, tokenID, usedAt)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrUserTokenUsed
+	}
+
+	return nil
+}
@@ -0,0 +1,138 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+)
+
+func (ss *StoreService) CreateSession(ctx context.Context, session *Session) error {
+	sqlStatement := `
+		INSERT INTO public.user_session
+		(id, user_id, ip_address, user_agent, created_at, last_used_at)
+		VALUES($1, $2, $3, $4, $5, $6)
+	`
+	_, err := ss.conn().ExecContext(ctx, sqlStatement,
+		session.Id, session.UserId, session.IpAddress, session.UserAgent, session.CreatedAt, session.LastUsedAt)
+
+	return translateError(err)
+}
+
+// TouchSession records that the session was used, from the given IP and user agent, to refresh its tokens.
+// Unknown sessions are ignored.
+func (ss *StoreService) TouchSession(ctx context.Context, id string, lastUsedAt int64, ipAddress, userAgent string) error {
+	sqlStatement := `
+		UPDATE public.user_session
+		SET last_used_at = $2, ip_address = $3, user_agent = $4
+		WHERE id = $1
+	`
+	_, err := ss.conn().ExecContext(ctx, sqlStatement, id, lastUsedAt, ipAddress, userAgent)
+
+	return err
+}
+
+// FindActiveSessions returns the sessions of the user whose refresh token is still usable at now,
+// most recently used first.
+func (ss *StoreService) FindActiveSessions(ctx context.Context, userID int64, now int64) ([]Session, error) {
+	sqlStatement := `
+		SELECT user_session.id, user_session.user_id, user_session.ip_address, user_session.user_agent,
+		user_session.created_at, user_session.last_used_at, refresh_token.expires_at
+		FROM public.user_session
+		JOIN public.refresh_token ON refresh_token.family_id = user_session.id
+		WHERE user_session.user_id = $1
+		AND refresh_token.used_at IS NULL AND refresh_token.revoked_at IS NULL AND refresh_token.expires_at > $2
+		ORDER BY user_session.last_used_at DESC, user_session.created_at DESC
+	`
+	rows, err := ss.conn().QueryContext(ctx, sqlStatement, userID, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := make([]Session, 0)
+	for rows.Next() {
+		var session Session
+		var ipAddress, userAgent sql.NullString
+		err = rows.Scan(
+			&session.Id, &session.UserId, &ipAddress, &userAgent,
+			&session.CreatedAt, &session.LastUsedAt, &session.ExpiresAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		session.IpAddress = ipAddress.String
+		session.UserAgent = userAgent.String
+		sessions = append(sessions, session)
+	}
+
+	return sessions, rows.Err()
+}
+
+// RevokeSession revokes the refresh tokens of the active session of the user and returns the ids of its access
+// tokens issued since createdSince, which may still be valid and have to be denylisted by the caller.
+// sql.ErrNoRows is returned if the user has no active session with the id.
+func (ss *StoreService) RevokeSession(ctx context.Context, userID int64, id string, revokedAt int64, createdSince int64) ([]string, error) {
+	tx, err := ss.begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	sqlStatement := `
+		UPDATE public.refresh_token
+		SET revoked_at = $3
+		WHERE user_id = $1 AND family_id = $2
+		AND used_at IS NULL AND revoked_at IS NULL AND expires_at > $3
+	`
+	result, err := tx.ExecContext(ctx, sqlStatement, userID, id, revokedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if affected == 0 {
+		return nil, sql.ErrNoRows
+	}
+
+	sqlStatement = `
+		UPDATE public.refresh_token
+		SET revoked_at = $2
+		WHERE family_id = $1 AND revoked_at IS NULL
+	`
+	_, err = tx.ExecContext(ctx, sqlStatement, id, revokedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	sqlStatement = `
+		SELECT access_token_id
+		FROM public.refresh_token
+		WHERE family_id = $1 AND created_at >= $2
+	`
+	rows, err := tx.QueryContext(ctx, sqlStatement, id, createdSince)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var accessTokenIDs []string
+	for rows.Next() {
+		var accessTokenID string
+		err = rows.Scan(&accessTokenID)
+		if err != nil {
+			return nil, err
+		}
+		accessTokenIDs = append(accessTokenIDs, accessTokenID)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return accessTokenIDs, nil
+}
@@ -0,0 +1,95 @@
+package store
+
+import (
+	"context"
+)
+
+const (
+	DriverPostgres = "postgres"
+	DriverMemory   = "memory"
+)
+
+// UserStore keeps the users with their addresses, sessions, tokens, second factors, passkeys and video history,
+// and the reference data they point to. StoreService implements it on Postgres, MemoryStore
+// in memory for tests and local demos.
+//
+// Methods report unknown rows with sql.ErrNoRows and unique constraint violations with ErrDuplicate,
+// whatever the implementation.
+type UserStore interface {
+	// WithTx runs fn with a UserStore whose methods are all applied atomically. The changes are kept
+	// if fn returns nil and discarded otherwise. WithTx called inside fn joins the same transaction.
+	WithTx(ctx context.Context, fn func(tx UserStore) error) error
+
+	CreateAddress(ctx context.Context, address *Address) (int64, error)
+	CreateUser(ctx context.Context, user *User) (int64, error)
+	FindUserByEmail(ctx context.Context, email string) (*User, error)
+	FindUserById(ctx context.Context, id int64) (*User, error)
+	FindUserProfile(ctx context.Context, userID int64) (*UserProfile, error)
+	FindUserProfiles(ctx context.Context, filter UserFilter) ([]UserProfile, int, error)
+	UpdateUserProfile(ctx context.Context, user *User) error
+	UpdateAddress(ctx context.Context, address *Address) error
+	SetUserAddress(ctx context.Context, userID int64, addressID int64) error
+	SetUserActive(ctx context.Context, userID int64, isActive bool) error
+	SetUserJobRole(ctx context.Context, userID int64, jobRoleID int) error
+	UpdateUserPassword(ctx context.Context, userID int64, password string) error
+	DeleteUser(ctx context.Context, userID int64) error
+	FindUserRole(ctx context.Context, userID int64) (*UserRole, error)
+
+	CreateRefreshToken(ctx context.Context, token *RefreshToken) (int64, error)
+	FindRefreshTokenByHash(ctx context.Context, tokenHash string) (*RefreshToken, error)
+	FindRefreshTokenByAccessTokenId(ctx context.Context, accessTokenID string) (*RefreshToken, error)
+	RotateRefreshToken(ctx context.Context, oldTokenID int64, usedAt int64, newToken *RefreshToken) (int64, error)
+	RevokeRefreshTokenFamily(ctx context.Context, familyID string, revokedAt int64) error
+	RevokeUserRefreshTokens(ctx context.Context, userID int64, keepFamilyID string, revokedAt int64, createdSince int64) ([]string, error)
+
+	CreateSession(ctx context.Context, session *Session) error
+	TouchSession(ctx context.Context, id string, lastUsedAt int64, ipAddress, userAgent string) error
+	FindActiveSessions(ctx context.Context, userID int64, now int64) ([]Session, error)
+	RevokeSession(ctx context.Context, userID int64, id string, revokedAt int64, createdSince int64) ([]string, error)
+
+	CreateRevokedTokens(ctx context.Context, tokens []RevokedToken) error
+	FindRevokedTokens(ctx context.Context, now int64) ([]RevokedToken, error)
+	DeleteExpiredRevokedTokens(ctx context.Context, now int64) error
+
+	CreateUserToken(ctx context.Context, token *UserToken) (int64, error)
+	FindUserTokenByHash(ctx context.Context, purpose, tokenHash string) (*UserToken, error)
+	FindLastUserTokenTime(ctx context.Context, userID int64, purpose string) (int64, error)
+	ResetUserPassword(ctx context.Context, token *UserToken, usedAt int64, password string) error
+	UseUserToken(ctx context.Context, tokenID int64, usedAt int64) error
+	ChangeUserEmail(ctx context.Context, token *UserToken, usedAt int64) error
+	VerifyUserEmail(ctx context.Context, token *UserToken, usedAt int64) error
+
+	FindUserTotp(ctx context.Context, userID int64) (*UserTotp, error)
+	SaveUserTotp(ctx context.Context, totp *UserTotp) error
+	EnableUserTotp(ctx context.Context, userID int64, confirmedAt int64, step int64, codeHashes []string) error
+	UseTotpStep(ctx context.Context, userID int64, step int64) error
+	DeleteUserTotp(ctx context.Context, userID int64) error
+	ReplaceRecoveryCodes(ctx context.Context, userID int64, codeHashes []string, createdAt int64) error
+	UseRecoveryCode(ctx context.Context, userID int64, codeHash string, usedAt int64) error
+	CountRecoveryCodes(ctx context.Context, userID int64) (int, error)
+
+	CreateWebAuthnCredential(ctx context.Context, credential *WebAuthnCredential) (int64, error)
+	FindWebAuthnCredentials(ctx context.Context, userID int64) ([]WebAuthnCredential, error)
+	UpdateWebAuthnCredential(ctx context.Context, id int64, data string, lastUsedAt int64) error
+	DeleteWebAuthnCredential(ctx context.Context, userID int64, id int64) error
+
+	CreateVideoHistory(ctx context.Context, history *VideoHistory) (int64, error)
+	FindVideoHistory(ctx context.Context, filter VideoHistoryFilter) ([]VideoHistory, int, error)
+
+	FindJobRoles(ctx context.Context, includeRetired bool) ([]JobRole, error)
+	FindJobRole(ctx context.Context, id int) (*JobRole, error)
+	CreateJobRole(ctx context.Context, name, roleName string) (int, error)
+	RenameJobRole(ctx context.Context, id int, name string) error
+	RetireJobRole(ctx context.Context, id int) error
+
+	FindSettlementTypes(ctx context.Context, includeRetired bool) ([]SettlementType, error)
+	FindSettlementType(ctx context.Context, id int) (*SettlementType, error)
+	CreateSettlementType(ctx context.Context, name string) (int, error)
+	RenameSettlementType(ctx context.Context, id int, name string) error
+	RetireSettlementType(ctx context.Context, id int) error
+}
+
+var (
+	_ UserStore = (*StoreService)(nil)
+	_ UserStore = (*MemoryStore)(nil)
+)
@@ -0,0 +1,82 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+)
+
+// querier is implemented by both *sql.DB and *sql.Tx.
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// WithTx runs fn with a StoreService whose methods all share one transaction. The transaction is
+// committed if fn returns nil and rolled back otherwise. WithTx called inside fn joins the same transaction.
+func (ss *StoreService) WithTx(ctx context.Context, fn func(tx UserStore) error) error {
+	if ss.tx != nil {
+		return fn(ss)
+	}
+
+	tx, err := ss.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	txService := *ss
+	txService.tx = tx
+
+	err = fn(&txService)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// conn returns the running transaction inside WithTx and the database otherwise.
+func (ss *StoreService) conn() querier {
+	if ss.tx != nil {
+		return ss.tx
+	}
+
+	return ss.db
+}
+
+// begin starts the transaction of a single method. Inside WithTx it joins the running transaction
+// and leaves committing or rolling it back to WithTx.
+func (ss *StoreService) begin(ctx context.Context) (*storeTx, error) {
+	if ss.tx != nil {
+		return &storeTx{Tx: ss.tx, joined: true}, nil
+	}
+
+	tx, err := ss.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &storeTx{Tx: tx}, nil
+}
+
+type storeTx struct {
+	*sql.Tx
+	joined bool
+}
+
+func (tx *storeTx) Commit() error {
+	if tx.joined {
+		return nil
+	}
+
+	return tx.Tx.Commit()
+}
+
+func (tx *storeTx) Rollback() error {
+	if tx.joined {
+		return nil
+	}
+
+	return tx.Tx.Rollback()
+}
@@ -0,0 +1,71 @@
+package store
+
+import (
+	"context"
+)
+
+// CreateWebAuthnCredential stores a registered passkey. ErrDuplicate is returned if the credential id is already registered.
+func (ss *StoreService) CreateWebAuthnCredential(ctx context.Context, credential *WebAuthnCredential) (int64, error) {
+	var credentialID int64
+	sqlStatement := `
+		INSERT INTO public.webauthn_credential
+		(user_id, credential_id, name, data, created_at)
+		VALUES($1, $2, $3, $4, $5)
+		RETURNING id
+	`
+	err := ss.conn().QueryRowContext(ctx, sqlStatement,
+		credential.UserId, credential.CredentialId, credential.Name, credential.Data, credential.CreatedAt).
+		Scan(&credentialID)
+
+	return credentialID, translateError(err)
+}
+
+// FindWebAuthnCredentials returns the passkeys of the user, oldest first.
+func (ss *StoreService) FindWebAuthnCredentials(ctx context.Context, userID int64) ([]WebAuthnCredential, error) {
+	sqlStatement := `
+		SELECT id, user_id, credential_id, name, data, created_at, last_used_at
+		FROM public.webauthn_credential
+		WHERE user_id = $1
+		ORDER BY id
+	`
+	rows, err := ss.conn().QueryContext(ctx, sqlStatement, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	credentials := make([]WebAuthnCredential, 0)
+	for rows.Next() {
+		var credential WebAuthnCredential
+		err = rows.Scan(
+			&credential.Id, &credential.UserId, &credential.CredentialId, &credential.Name,
+			&credential.Data, &credential.CreatedAt, &credential.LastUsedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		credentials = append(credentials, credential)
+	}
+
+	return credentials, rows.Err()
+}
+
+// UpdateWebAuthnCredential stores the data of the passkey as updated by a login, e.g. its signature counter.
+// sql.ErrNoRows is returned for an unknown passkey.
+func (ss *StoreService) UpdateWebAuthnCredential(ctx context.Context, id int64, data string, lastUsedAt int64) error {
+	sqlStatement := `
+		UPDATE public.webauthn_credential
+		SET data = $2, last_used_at = $3
+		WHERE id = $1
+	`
+	return ss.execAffectingRow(ctx, sqlStatement, id, data, lastUsedAt)
+}
+
+// DeleteWebAuthnCredential removes the passkey of the user. sql.ErrNoRows is returned if the user has no passkey with the id.
+func (ss *StoreService) DeleteWebAuthnCredential(ctx context.Context, userID int64, id int64) error {
+	sqlStatement := `
+		DELETE FROM public.webauthn_credential
+		WHERE id = $1 AND user_id = $2
+	`
+	return ss.execAffectingRow(ctx, sqlStatement, id, userID)
+}
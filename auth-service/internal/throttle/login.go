@@ -0,0 +1,238 @@
+package throttle
+
+import (
+	"auth/config"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+)
+
+type attempts struct {
+	failures    int
+	lastFailure time.Time
+	inFlight    int
+	lastStart   time.Time
+}
+
+// Attempt is a login attempt reserved by Wait. It has to be settled with Success or Failure, or
+// released with Done when it ended without a verdict about the credentials.
+type Attempt struct {
+	throttle *LoginThrottle
+	email    string
+	ip       string
+	settled  bool
+}
+
+// LoginThrottle tracks failed logins per email and per client IP. After the free attempts every
+// further failure doubles the time the client has to wait; enough failures for one email lock the
+// account for LOGIN_LOCKOUT_DURATION. Counters are forgotten after LOGIN_ATTEMPT_WINDOW without failures.
+// Attempts that are still being checked count as failures until they are settled, so concurrent
+// requests cannot get past the limits by all passing Wait before the first of them fails.
+type LoginThrottle struct {
+	config    *config.AuthConfig
+	logger    *slog.Logger
+	mu        sync.Mutex
+	byEmail   map[string]*attempts
+	byIP      map[string]*attempts
+	lastPrune time.Time
+	// now is the clock of the throttle, replaced in tests
+	now func() time.Time
+}
+
+func NewLoginThrottle(config *config.AuthConfig, logger *slog.Logger) *LoginThrottle {
+	return &LoginThrottle{
+		config:    config,
+		logger:    logger,
+		byEmail:   make(map[string]*attempts),
+		byIP:      make(map[string]*attempts),
+		lastPrune: time.Now(),
+		now:       time.Now,
+	}
+}
+
+// Wait returns how long the client has to wait before it may try to log in again. When it may try
+// now, the attempt is reserved and returned with a zero duration.
+func (lt *LoginThrottle) Wait(email, ip string) (*Attempt, time.Duration) {
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+
+	now := lt.now()
+	email = normalizeEmail(email)
+	wait := lt.emailWait(lt.byEmail[email], now)
+	if ipWait := lt.wait(lt.byIP[ip], lt.config.LoginIPFreeAttempts, now); ipWait > wait {
+		wait = ipWait
+	}
+	if wait > 0 {
+		return nil, wait
+	}
+
+	lt.start(lt.byEmail, email, now)
+	lt.start(lt.byIP, ip, now)
+	return &Attempt{throttle: lt, email: email, ip: ip}, 0
+}
+
+// Failure records a failed check of credentials that was not reserved with Wait, e.g. a wrong code
+// after the password of the user was already accepted.
+func (lt *LoginThrottle) Failure(email, ip string) {
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+
+	lt.failure(normalizeEmail(email), ip)
+}
+
+// Failure settles the attempt as failed.
+func (a *Attempt) Failure() {
+	a.settle(func(lt *LoginThrottle) {
+		lt.failure(a.email, a.ip)
+	})
+}
+
+// Success settles the attempt and forgets the failed attempts for the email. The IP counter is kept,
+// so one valid account does not reset the limit for guessing the passwords of others.
+func (a *Attempt) Success() {
+	a.settle(func(lt *LoginThrottle) {
+		emailAttempts, ok := lt.byEmail[a.email]
+		if !ok {
+			return
+		}
+
+		emailAttempts.failures = 0
+		emailAttempts.lastFailure = time.Time{}
+		if emailAttempts.inFlight == 0 {
+			delete(lt.byEmail, a.email)
+		}
+	})
+}
+
+// Done releases the attempt if it was not settled. It is meant to be deferred right after Wait.
+func (a *Attempt) Done() {
+	a.settle(func(*LoginThrottle) {})
+}
+
+func (a *Attempt) settle(record func(lt *LoginThrottle)) {
+	lt := a.throttle
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+
+	if a.settled {
+		return
+	}
+	a.settled = true
+
+	lt.finish(lt.byEmail, a.email)
+	lt.finish(lt.byIP, a.ip)
+	record(lt)
+}
+
+func (lt *LoginThrottle) failure(email, ip string) {
+	now := lt.now()
+	lt.prune(now)
+
+	emailAttempts := lt.record(lt.byEmail, email, now)
+	lt.record(lt.byIP, ip, now)
+
+	if emailAttempts.failures == lt.config.LoginLockoutAttempts {
+		lt.logger.Warn("too many failed logins, account locked", "email", email, "ip", ip, "until", now.Add(lt.config.LoginLockoutDuration))
+	}
+}
+
+func (lt *LoginThrottle) emailWait(a *attempts, now time.Time) time.Duration {
+	if a != nil && a.failures >= lt.config.LoginLockoutAttempts {
+		return positive(a.lastFailure.Add(lt.config.LoginLockoutDuration).Sub(now))
+	}
+
+	return lt.wait(a, lt.config.LoginFreeAttempts, now)
+}
+
+func (lt *LoginThrottle) wait(a *attempts, freeAttempts int, now time.Time) time.Duration {
+	if a == nil {
+		return 0
+	}
+
+	failures, last := a.failures, a.lastFailure
+	if now.Sub(a.lastFailure) > lt.config.LoginAttemptWindow {
+		failures = 0
+	}
+	if a.inFlight > 0 {
+		failures += a.inFlight
+		if a.lastStart.After(last) {
+			last = a.lastStart
+		}
+	}
+	if failures <= freeAttempts {
+		return 0
+	}
+
+	backoff := lt.config.LoginBackoffMax
+	if shift := failures - freeAttempts - 1; shift < 32 {
+		backoff = min(lt.config.LoginBackoffBase<<shift, lt.config.LoginBackoffMax)
+	}
+
+	return positive(last.Add(backoff).Sub(now))
+}
+
+func (lt *LoginThrottle) record(entries map[string]*attempts, key string, now time.Time) *attempts {
+	a, ok := entries[key]
+	if !ok {
+		a = &attempts{}
+		entries[key] = a
+	}
+	if now.Sub(a.lastFailure) > lt.config.LoginAttemptWindow {
+		a.failures = 0
+	}
+
+	a.failures++
+	a.lastFailure = now
+	return a
+}
+
+func (lt *LoginThrottle) start(entries map[string]*attempts, key string, now time.Time) {
+	a, ok := entries[key]
+	if !ok {
+		a = &attempts{}
+		entries[key] = a
+	}
+
+	a.inFlight++
+	a.lastStart = now
+}
+
+func (lt *LoginThrottle) finish(entries map[string]*attempts, key string) {
+	a, ok := entries[key]
+	if !ok {
+		return
+	}
+
+	a.inFlight--
+	if a.inFlight == 0 && a.failures == 0 {
+		delete(entries, key)
+	}
+}
+
+// prune drops the counters without attempts in flight that were not updated during the attempt window.
+func (lt *LoginThrottle) prune(now time.Time) {
+	if now.Sub(lt.lastPrune) < lt.config.LoginAttemptWindow {
+		return
+	}
+	lt.lastPrune = now
+
+	for _, entries := range []map[string]*attempts{lt.byEmail, lt.byIP} {
+		for key, a := range entries {
+			if a.inFlight == 0 && now.Sub(a.lastFailure) > lt.config.LoginAttemptWindow {
+				delete(entries, key)
+			}
+		}
+	}
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+func positive(d time.Duration) time.Duration {
+	if d < 0 {
+		return 0
+	}
+	return d
+}
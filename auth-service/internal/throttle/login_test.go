@@ -0,0 +1,225 @@
+package throttle
+
+import (
+	"auth/config"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (fc *fakeClock) Now() time.Time {
+	return fc.now
+}
+
+func (fc *fakeClock) advance(d time.Duration) {
+	fc.now = fc.now.Add(d)
+}
+
+func newTestLoginThrottle() (*LoginThrottle, *fakeClock) {
+	authConfig := &config.AuthConfig{
+		LoginFreeAttempts:    3,
+		LoginIPFreeAttempts:  20,
+		LoginBackoffBase:     time.Second,
+		LoginBackoffMax:      10 * time.Second,
+		LoginLockoutAttempts: 10,
+		LoginLockoutDuration: 15 * time.Minute,
+		LoginAttemptWindow:   time.Hour,
+	}
+
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	lt := NewLoginThrottle(authConfig, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	lt.now = clock.Now
+	lt.lastPrune = clock.now
+
+	return lt, clock
+}
+
+const (
+	testEmail = "ivan@example.com"
+	testIP    = "203.0.113.7"
+)
+
+func failures(lt *LoginThrottle, n int) {
+	for i := 0; i < n; i++ {
+		lt.Failure(testEmail, testIP)
+	}
+}
+
+func TestLoginThrottleWait(t *testing.T) {
+	tests := []struct {
+		name     string
+		run      func(lt *LoginThrottle, clock *fakeClock)
+		email    string
+		wantWait time.Duration
+	}{
+		{
+			name: "free attempts",
+			run:  func(lt *LoginThrottle, clock *fakeClock) { failures(lt, 3) },
+		},
+		{
+			name:     "first backoff",
+			run:      func(lt *LoginThrottle, clock *fakeClock) { failures(lt, 4) },
+			wantWait: time.Second,
+		},
+		{
+			name:     "backoff doubles",
+			run:      func(lt *LoginThrottle, clock *fakeClock) { failures(lt, 6) },
+			wantWait: 4 * time.Second,
+		},
+		{
+			name:     "backoff is capped",
+			run:      func(lt *LoginThrottle, clock *fakeClock) { failures(lt, 9) },
+			wantWait: 10 * time.Second,
+		},
+		{
+			name: "backoff counts from the last failure",
+			run: func(lt *LoginThrottle, clock *fakeClock) {
+				failures(lt, 5)
+				clock.advance(1500 * time.Millisecond)
+			},
+			wantWait: 500 * time.Millisecond,
+		},
+		{
+			name: "backoff elapsed",
+			run: func(lt *LoginThrottle, clock *fakeClock) {
+				failures(lt, 5)
+				clock.advance(2 * time.Second)
+			},
+		},
+		{
+			name:     "lockout",
+			run:      func(lt *LoginThrottle, clock *fakeClock) { failures(lt, 10) },
+			wantWait: 15 * time.Minute,
+		},
+		{
+			name: "lockout expires",
+			run: func(lt *LoginThrottle, clock *fakeClock) {
+				failures(lt, 10)
+				clock.advance(15 * time.Minute)
+			},
+		},
+		{
+			name: "failures are forgotten after the window",
+			run: func(lt *LoginThrottle, clock *fakeClock) {
+				failures(lt, 9)
+				clock.advance(time.Hour + time.Second)
+			},
+		},
+		{
+			name: "success forgets the failures of the email",
+			run: func(lt *LoginThrottle, clock *fakeClock) {
+				failures(lt, 4)
+				clock.advance(time.Second)
+				attempt, _ := lt.Wait(testEmail, testIP)
+				attempt.Success()
+				failures(lt, 1)
+			},
+		},
+		{
+			name: "the IP limit applies to other emails",
+			run: func(lt *LoginThrottle, clock *fakeClock) {
+				for i := 0; i < 21; i++ {
+					lt.Failure(fmt.Sprintf("user%d@example.com", i), testIP)
+				}
+			},
+			email:    "other@example.com",
+			wantWait: time.Second,
+		},
+		{
+			name: "emails are normalized",
+			run: func(lt *LoginThrottle, clock *fakeClock) {
+				for i := 0; i < 4; i++ {
+					lt.Failure(" Ivan@Example.com ", testIP)
+				}
+			},
+			wantWait: time.Second,
+		},
+		{
+			name: "attempts in flight count as failures",
+			run: func(lt *LoginThrottle, clock *fakeClock) {
+				failures(lt, 3)
+				lt.Wait(testEmail, testIP)
+			},
+			wantWait: time.Second,
+		},
+		{
+			name: "released attempts are settled once",
+			run: func(lt *LoginThrottle, clock *fakeClock) {
+				failures(lt, 3)
+				attempt, _ := lt.Wait(testEmail, testIP)
+				attempt.Done()
+				attempt.Failure()
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lt, clock := newTestLoginThrottle()
+			tt.run(lt, clock)
+
+			email := tt.email
+			if email == "" {
+				email = testEmail
+			}
+			attempt, wait := lt.Wait(email, testIP)
+			if wait != tt.wantWait {
+				t.Fatalf("got wait %s, want %s", wait, tt.wantWait)
+			}
+			if (attempt == nil) != (wait > 0) {
+				t.Fatalf("got attempt %v with wait %s", attempt, wait)
+			}
+		})
+	}
+}
+
+func TestLoginThrottleConcurrentAttempts(t *testing.T) {
+	lt, _ := newTestLoginThrottle()
+
+	const clients = 50
+	var (
+		started  sync.WaitGroup
+		finished sync.WaitGroup
+		mu       sync.Mutex
+		passed   int
+	)
+	release := make(chan struct{})
+	started.Add(clients)
+	finished.Add(clients)
+	for i := 0; i < clients; i++ {
+		go func() {
+			defer finished.Done()
+
+			attempt, wait := lt.Wait(testEmail, testIP)
+			started.Done()
+			if wait > 0 {
+				return
+			}
+			defer attempt.Done()
+
+			mu.Lock()
+			passed++
+			mu.Unlock()
+
+			// every password is wrong, but none is checked before all clients got past Wait
+			<-release
+			attempt.Failure()
+		}()
+	}
+	started.Wait()
+	close(release)
+	finished.Wait()
+
+	if want := lt.config.LoginFreeAttempts + 1; passed != want {
+		t.Fatalf("%d concurrent attempts passed, want %d", passed, want)
+	}
+	if _, wait := lt.Wait(testEmail, testIP); wait == 0 {
+		t.Fatal("no wait after the concurrent failures")
+	}
+}
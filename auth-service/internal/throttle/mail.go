@@ -0,0 +1,56 @@
+package throttle
+
+import (
+	"sync"
+	"time"
+)
+
+// MailThrottle limits how often a kind of mail can be requested for one email address. The counters
+// are kept per submitted address whether an account exists for it or not, so being throttled does
+// not reveal which addresses are registered.
+type MailThrottle struct {
+	interval  time.Duration
+	mu        sync.Mutex
+	lastSent  map[string]time.Time
+	lastPrune time.Time
+}
+
+func NewMailThrottle(interval time.Duration) *MailThrottle {
+	return &MailThrottle{
+		interval:  interval,
+		lastSent:  make(map[string]time.Time),
+		lastPrune: time.Now(),
+	}
+}
+
+// Wait returns how long the client has to wait before it may request the mail for the email again.
+// When it may request it now, the request is recorded and 0 is returned.
+func (mt *MailThrottle) Wait(kind, email string) time.Duration {
+	mt.mu.Lock()
+	defer mt.mu.Unlock()
+
+	now := time.Now()
+	mt.prune(now)
+
+	key := kind + ":" + normalizeEmail(email)
+	if wait := positive(mt.lastSent[key].Add(mt.interval).Sub(now)); wait > 0 {
+		return wait
+	}
+
+	mt.lastSent[key] = now
+	return 0
+}
+
+// prune drops the requests older than the interval.
+func (mt *MailThrottle) prune(now time.Time) {
+	if now.Sub(mt.lastPrune) < mt.interval {
+		return
+	}
+	mt.lastPrune = now
+
+	for key, sent := range mt.lastSent {
+		if now.Sub(sent) >= mt.interval {
+			delete(mt.lastSent, key)
+		}
+	}
+}
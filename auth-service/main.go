@@ -4,28 +4,31 @@ import (
 	"auth/config"
 	"auth/internal/api/http"
 	"auth/internal/auth"
+	"auth/internal/mail"
+	"auth/internal/migration"
+	"auth/internal/passkey"
 	"auth/internal/store"
+	"auth/internal/throttle"
 	"context"
 	"database/sql"
 	"fmt"
 	"log"
 	"log/slog"
 	"os"
-	"time"
 
 	_ "github.com/lib/pq"
 
 	"github.com/gofiber/fiber/v2"
 )
 
-const contextTimeoutMillis = 5000
-
 func main() {
 	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{AddSource: true}))
 
 	var authConfig config.AuthConfig
 	var httpConfig config.HttpConfig
 	var dbConfig config.DbConfig
+	var mailConfig config.MailConfig
+	var webAuthnConfig config.WebAuthnConfig
 
 	err := authConfig.MustConfig()
 	if err != nil {
@@ -39,31 +42,133 @@ func main() {
 	if err != nil {
 		log.Fatal(err)
 	}
+	err = mailConfig.MustConfig()
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = webAuthnConfig.MustConfig()
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	psqlInfo := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
-		dbConfig.Host, dbConfig.Port, dbConfig.Username, dbConfig.Password, dbConfig.Name)
-	db, err := sql.Open("postgres", psqlInfo)
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		db, err := openDb(&dbConfig)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer db.Close()
+
+		err = runMigrate(db, logger, os.Args[2:])
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	storeService, closeStore, err := openStore(&dbConfig, logger)
 	if err != nil {
 		log.Fatal(err)
 	}
-	defer db.Close()
+	defer closeStore()
 
-	err = db.Ping()
+	keySet, err := auth.LoadKeySet(&authConfig)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	authService := auth.NewAuthService(&authConfig, keySet, storeService, logger)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	err = authService.LoadRevokedTokens(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+	go authService.SyncRevokedTokens(ctx)
+
+	mailer, err := mail.NewMailer(&mailConfig, logger)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	app := fiber.New()
+	loginThrottle := throttle.NewLoginThrottle(&authConfig, logger)
+	mailThrottle := throttle.NewMailThrottle(authConfig.VerificationResendInterval)
+
+	passkeyService, err := passkey.NewPasskeyService(&webAuthnConfig)
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	ctx, done := context.WithTimeout(context.Background(), time.Second*contextTimeoutMillis)
-	defer done()
+	httpService := http.NewHttpService(authService, storeService, loginThrottle, mailThrottle, passkeyService, mailer, &mailConfig, logger)
+	authRepository := http.NewAuthRepository(httpService, &httpConfig, logger)
 
-	authService := auth.NewAuthService(&authConfig, logger, &ctx)
-	storeService := store.NewDbService(db, logger, &ctx)
-	httpService := http.NewHttpService(authService, storeService, logger, &ctx)
-	authRepository := http.NewAuthRepository(httpService, logger, &ctx)
+	app := fiber.New(fiber.Config{
+		// the proxy header is only read from the proxies in front of the service, anyone else
+		// could put an arbitrary address into it and get around the per-IP login throttle
+		ProxyHeader:             httpConfig.ProxyHeader,
+		EnableTrustedProxyCheck: true,
+		TrustedProxies:          httpConfig.TrustedProxies,
+		EnableIPValidation:      true,
+		ErrorHandler:            authRepository.ErrorHandler,
+		// client IPs and user agents outlive the request in sessions and the login throttle
+		Immutable: true,
+	})
 
 	authRepository.RegisterRouts(app)
 
 	app.Listen(httpConfig.Host + ":" + httpConfig.Port)
 }
+
+// openStore returns the store selected by DB_DRIVER together with the function closing it.
+// The Postgres store applies pending migrations first if DB_AUTO_MIGRATE is set.
+func openStore(dbConfig *config.DbConfig, logger *slog.Logger) (store.UserStore, func(), error) {
+	switch dbConfig.Driver {
+	case "", store.DriverPostgres:
+	case store.DriverMemory:
+		logger.Warn("using the in-memory store, all data is lost on restart")
+		return store.NewMemoryStore(logger), func() {}, nil
+	default:
+		return nil, nil, fmt.Errorf("unsupported db driver %q", dbConfig.Driver)
+	}
+
+	db, err := openDb(dbConfig)
+	if err != nil {
+		return nil, nil, err
+	}
+	closeDb := func() {
+		db.Close()
+	}
+
+	if dbConfig.AutoMigrate {
+		migrator, err := migration.NewMigrator(db, logger)
+		if err != nil {
+			closeDb()
+			return nil, nil, err
+		}
+		_, err = migrator.Up(context.Background())
+		if err != nil {
+			closeDb()
+			return nil, nil, err
+		}
+	}
+
+	return store.NewDbService(db, logger), closeDb, nil
+}
+
+func openDb(dbConfig *config.DbConfig) (*sql.DB, error) {
+	psqlInfo := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
+		dbConfig.Host, dbConfig.Port, dbConfig.Username, dbConfig.Password, dbConfig.Name)
+	db, err := sql.Open("postgres", psqlInfo)
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Ping()
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
@@ -1,6 +1,8 @@
 package configs
 
 import (
+	"time"
+
 	_ "github.com/joho/godotenv/autoload"
 	"github.com/kelseyhightower/envconfig"
 )
@@ -14,6 +16,15 @@ type MinioEnvs struct {
 	SSL       bool   `envconfig:"ssl"`
 }
 
+type AuthEnvs struct {
+	IntrospectionUrl string        `envconfig:"introspection_url"`
+	UsersUrl         string        `envconfig:"users_url"`
+	ClientId         string        `envconfig:"client_id"`
+	ClientSecret     string        `envconfig:"client_secret"`
+	CacheTTL         time.Duration `envconfig:"cache_ttl" default:"30s"`
+	Timeout          time.Duration `envconfig:"timeout" default:"5s"`
+}
+
 type EnvVariables struct {
 	ServerHost                    string `envconfig:"server_host"`
 	ServerPort                    string `envconfig:"server_port"`
@@ -46,3 +57,12 @@ func MustConfigMinio() *MinioEnvs {
 	}
 	return &me
 }
+
+func MustConfigAuth() *AuthEnvs {
+	var ae AuthEnvs
+	err := envconfig.Process("auth", &ae)
+	if err != nil {
+		panic(err)
+	}
+	return &ae
+}
@@ -0,0 +1,123 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"video-handler/configs"
+)
+
+var ErrInactiveToken = errors.New("token is not active")
+
+type cachedClaims struct {
+	claims    *Claims
+	expiresAt time.Time
+}
+
+// Client verifies access tokens with the auth-service introspection endpoint.
+// Active tokens are cached for a short time, so a revoked token may be accepted for up to CacheTTL.
+type Client struct {
+	envs       *configs.AuthEnvs
+	httpClient *http.Client
+	logger     *slog.Logger
+	cacheLock  sync.Mutex
+	cache      map[string]cachedClaims
+}
+
+func NewClient(envs *configs.AuthEnvs, logger *slog.Logger) *Client {
+	return &Client{
+		envs: envs,
+		httpClient: &http.Client{
+			Timeout: envs.Timeout,
+		},
+		logger: logger,
+		cache:  make(map[string]cachedClaims),
+	}
+}
+
+func (c *Client) Introspect(ctx context.Context, token string) (*Claims, error) {
+	if claims, ok := c.cached(token); ok {
+		return claims, nil
+	}
+
+	form := url.Values{}
+	form.Set("token", token)
+	form.Set("token_type_hint", "access_token")
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.envs.IntrospectionUrl, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(c.envs.ClientId, c.envs.ClientSecret)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("introspection failed with status %d", resp.StatusCode)
+	}
+
+	var introspection introspectionResponse
+	err = json.NewDecoder(resp.Body).Decode(&introspection)
+	if err != nil {
+		return nil, err
+	}
+
+	if !introspection.Active {
+		return nil, ErrInactiveToken
+	}
+
+	claims := introspection.Claims
+	c.store(token, &claims)
+
+	return &claims, nil
+}
+
+func (c *Client) cached(token string) (*Claims, bool) {
+	c.cacheLock.Lock()
+	defer c.cacheLock.Unlock()
+
+	entry, ok := c.cache[token]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(entry.expiresAt) {
+		delete(c.cache, token)
+		return nil, false
+	}
+
+	return entry.claims, true
+}
+
+func (c *Client) store(token string, claims *Claims) {
+	expiresAt := time.Now().Add(c.envs.CacheTTL)
+	if tokenExpiresAt := time.Unix(claims.Exp, 0); tokenExpiresAt.Before(expiresAt) {
+		expiresAt = tokenExpiresAt
+	}
+
+	c.cacheLock.Lock()
+	defer c.cacheLock.Unlock()
+
+	now := time.Now()
+	for cachedToken, entry := range c.cache {
+		if now.After(entry.expiresAt) {
+			delete(c.cache, cachedToken)
+		}
+	}
+
+	c.cache[token] = cachedClaims{
+		claims:    claims,
+		expiresAt: expiresAt,
+	}
+}
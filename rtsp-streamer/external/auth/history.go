@@ -0,0 +1,45 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const HistoryEventStream = "stream"
+
+// RecordHistory adds an entry to the user's video history in auth-service. The request is made
+// with the client credentials, like introspection, so it does not depend on the access token
+// of the user still being valid.
+func (c *Client) RecordHistory(ctx context.Context, userID int64, videoName, event string) error {
+	body, err := json.Marshal(historyRequest{
+		VideoName: videoName,
+		Event:     event,
+	})
+	if err != nil {
+		return err
+	}
+
+	historyUrl := fmt.Sprintf("%s/%d/history", strings.TrimSuffix(c.envs.UsersUrl, "/"), userID)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, historyUrl, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.SetBasicAuth(c.envs.ClientId, c.envs.ClientSecret)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		return fmt.Errorf("recording history failed with status %d", resp.StatusCode)
+	}
+
+	return nil
+}
@@ -0,0 +1,67 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// WebsocketProtocol is the subprotocol browsers use to pass the access token on the websocket upgrade:
+// new WebSocket(url, ["access_token", token]).
+const WebsocketProtocol = "access_token"
+
+type claimsContextKey struct{}
+
+// Middleware rejects requests without a valid access token and puts the user claims into the request context.
+// Besides the Authorization header the token is accepted from the access_token query parameter
+// and the websocket subprotocol, because browsers cannot set headers on a websocket upgrade.
+func (c *Client) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := tokenFromRequest(r)
+		if token == "" {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "missing access token", http.StatusUnauthorized)
+			return
+		}
+
+		claims, err := c.Introspect(r.Context(), token)
+		if errors.Is(err, ErrInactiveToken) {
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		if err != nil {
+			c.logger.Error("failed to introspect access token", "err", err.Error())
+			http.Error(w, "failed to verify access token", http.StatusBadGateway)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), claimsContextKey{}, claims)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func ClaimsFromContext(ctx context.Context) (*Claims, bool) {
+	claims, ok := ctx.Value(claimsContextKey{}).(*Claims)
+	return claims, ok
+}
+
+func tokenFromRequest(r *http.Request) string {
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return token
+	}
+
+	if token := r.URL.Query().Get("access_token"); token != "" {
+		return token
+	}
+
+	protocols := strings.Split(r.Header.Get("Sec-WebSocket-Protocol"), ",")
+	for i := 0; i < len(protocols)-1; i++ {
+		if strings.TrimSpace(protocols[i]) == WebsocketProtocol {
+			return strings.TrimSpace(protocols[i+1])
+		}
+	}
+
+	return ""
+}
@@ -1,3 +1,22 @@
 package auth
 
-type something struct{}
+// Claims describes the authenticated user as reported by auth-service.
+type Claims struct {
+	UserId  int64  `json:"user_id"`
+	Email   string `json:"email"`
+	Role    string `json:"role"`
+	JobRole string `json:"job_role"`
+	IsAdmin bool   `json:"is_admin"`
+	Jti     string `json:"jti"`
+	Exp     int64  `json:"exp"`
+}
+
+type introspectionResponse struct {
+	Active bool `json:"active"`
+	Claims
+}
+
+type historyRequest struct {
+	VideoName string `json:"video_name"`
+	Event     string `json:"event"`
+}
@@ -16,7 +16,7 @@ const (
 	supportedCodecs string = "H265,H264,VP9,VP8"
 )
 
-func (service *VideoService) processVideoContainer(video multipart.File, videoInfo *multipart.FileHeader) (bool, error) {
+func (service *VideoService) processVideoContainer(video multipart.File, videoInfo *multipart.FileHeader, ownerID int64, visibility string) (bool, error) {
 	var conversionNeed bool
 
 	videoCodec, err := service.getVideoCodec(video)
@@ -35,7 +35,7 @@ func (service *VideoService) processVideoContainer(video multipart.File, videoIn
 				service.Logger.Error(ErrorExecutingFfmpegCommand, "err", err.Error())
 			}
 
-			uploadInfo, err := service.UploadVideo(outputVideo, videoInfo.Filename)
+			uploadInfo, err := service.UploadVideo(outputVideo, ownerID, videoInfo.Filename, visibility)
 			if err != nil {
 				errChan <- err
 			}
@@ -59,7 +59,7 @@ func (service *VideoService) processVideoContainer(video multipart.File, videoIn
 }
 
 func (service *VideoService) StreamVideoAsRTSP(video *minio.Object, protocol, streamAddress string) ([]byte, error) {
-	service.Logger.Debug("", video)
+	service.Logger.Debug("streaming video", "protocol", protocol, "stream_address", streamAddress)
 	rtspVidoStreamCommand := cmdCommand.CmdCommand{
 		App:    "ffmpeg",
 		Args:   []string{"-re", "-stream_loop", "-1", "-i", "pipe:0", "-c", "copy", "-bsf:v", "h264_mp4toannexb", "-f", protocol, streamAddress},
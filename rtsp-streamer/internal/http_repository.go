@@ -3,6 +3,7 @@ package internal
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"log/slog"
@@ -13,6 +14,7 @@ import (
 	"sync"
 	"time"
 	"video-handler/configs"
+	"video-handler/external/auth"
 
 	"github.com/bluenviron/gortsplib/v4"
 	"github.com/bluenviron/gortsplib/v4/pkg/base"
@@ -33,21 +35,24 @@ type WebrtcRepository struct {
 	trackLocals     map[string]*webrtc.TrackLocalStaticRTP
 	streamerService *StreamerService
 	videoService    *VideoService
+	authClient      *auth.Client
 	envs            *configs.EnvVariables
 	logger          *slog.Logger
 	ctx             *context.Context
 }
 
-func NewWebrtcRepository(r chi.Router, streamerService *StreamerService, videoService *VideoService, envs *configs.EnvVariables, logger *slog.Logger, ctx *context.Context) *WebrtcRepository {
+func NewWebrtcRepository(r chi.Router, streamerService *StreamerService, videoService *VideoService, authClient *auth.Client, envs *configs.EnvVariables, logger *slog.Logger, ctx *context.Context) *WebrtcRepository {
 	return &WebrtcRepository{
 		upgrader: websocket.Upgrader{
-			CheckOrigin: func(r *http.Request) bool { return true },
+			CheckOrigin:  func(r *http.Request) bool { return true },
+			Subprotocols: []string{auth.WebsocketProtocol},
 		},
 		listLock:        sync.RWMutex{},
 		peerConnections: make([]peerConnectionState, 0),
 		trackLocals:     map[string]*webrtc.TrackLocalStaticRTP{},
 		streamerService: streamerService,
 		videoService:    videoService,
+		authClient:      authClient,
 		envs:            envs,
 
 		logger: logger,
@@ -56,10 +61,15 @@ func NewWebrtcRepository(r chi.Router, streamerService *StreamerService, videoSe
 }
 
 func (wr *WebrtcRepository) SetupRouter(r chi.Router) {
-	r.Post("/upload", wr.upload)
-	r.Delete("/delete", wr.deleteVideo)
-	r.Get("/video-list", wr.videoList)
-	r.HandleFunc("/websocket", wr.websocketHandler)
+	r.Group(func(r chi.Router) {
+		r.Use(wr.authClient.Middleware)
+
+		r.Post("/upload", wr.upload)
+		r.Delete("/delete", wr.deleteVideo)
+		r.Patch("/visibility", wr.setVisibility)
+		r.Get("/video-list", wr.videoList)
+		r.HandleFunc("/websocket", wr.websocketHandler)
+	})
 
 	workDir, _ := os.Getwd()
 	filesDir := http.Dir(filepath.Join(workDir, "/static"))
@@ -86,7 +96,24 @@ func (wr *WebrtcRepository) upload(w http.ResponseWriter, r *http.Request) {
 	}
 	defer buffer.Close()
 
-	conversionNeed, err := wr.videoService.processVideoContainer(buffer, handler)
+	claims, _ := auth.ClaimsFromContext(r.Context())
+
+	visibility := r.FormValue("visibility")
+	if visibility == "" {
+		visibility = VisibilityPrivate
+	}
+	if visibility != VisibilityPrivate && visibility != VisibilityPublic {
+		http.Error(w, ErrInvalidVisibility.Error(), http.StatusBadRequest)
+		return
+	}
+	// checked before the video is processed, the conversion uploads it in the background
+	_, err = VideoKey(claims.UserId, handler.Filename)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	conversionNeed, err := wr.videoService.processVideoContainer(buffer, handler, claims.UserId, visibility)
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(Response{
@@ -100,9 +127,10 @@ func (wr *WebrtcRepository) upload(w http.ResponseWriter, r *http.Request) {
 	buffer.Seek(0, 0)
 
 	if !conversionNeed {
-		uploadInfo, err := wr.videoService.UploadVideo(buffer, handler.Filename)
+		uploadInfo, err := wr.videoService.UploadVideo(buffer, claims.UserId, handler.Filename, visibility)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
 		}
 		wr.logger.Info("video doesn't need conversion and was updloaded successfully", "video_name", uploadInfo.Key, "video_size", uploadInfo.Size)
 		w.Header().Set("Content-Type", "application/json")
@@ -123,10 +151,13 @@ func (wr *WebrtcRepository) upload(w http.ResponseWriter, r *http.Request) {
 }
 
 func (wr *WebrtcRepository) deleteVideo(w http.ResponseWriter, r *http.Request) {
+	claims, _ := auth.ClaimsFromContext(r.Context())
+
 	videoName := r.URL.Query().Get("video")
-	err := wr.videoService.DeleteVideo(videoName)
+	err := wr.videoService.DeleteVideo(claims, videoName)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		http.Error(w, err.Error(), videoErrorStatus(err))
+		return
 	}
 
 	json.NewEncoder(w).Encode(Response{
@@ -135,15 +166,46 @@ func (wr *WebrtcRepository) deleteVideo(w http.ResponseWriter, r *http.Request)
 	})
 }
 
+func (wr *WebrtcRepository) setVisibility(w http.ResponseWriter, r *http.Request) {
+	claims, _ := auth.ClaimsFromContext(r.Context())
+
+	videoName := r.URL.Query().Get("video")
+	visibility := r.URL.Query().Get("visibility")
+	err := wr.videoService.SetVisibility(claims, videoName, visibility)
+	if err != nil {
+		http.Error(w, err.Error(), videoErrorStatus(err))
+		return
+	}
+
+	json.NewEncoder(w).Encode(Response{
+		Status: http.StatusOK,
+		Result: fmt.Sprintf("video visibility changed to %s: %s", visibility, videoName),
+	})
+}
+
 func (wr *WebrtcRepository) videoList(w http.ResponseWriter, r *http.Request) {
-	videos, err := wr.videoService.GetVideoList()
+	claims, _ := auth.ClaimsFromContext(r.Context())
+
+	videos, err := wr.videoService.GetVideoList(claims)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
 
 	json.NewEncoder(w).Encode(videos)
 }
 
+func videoErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrVideoNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrVideoAccessDenied):
+		return http.StatusForbidden
+	default:
+		return http.StatusBadRequest
+	}
+}
+
 // Add to list of tracks and fire renegotation for all PeerConnections
 func (wr *WebrtcRepository) addTrack(t *webrtc.TrackLocalStaticRTP) error {
 	wr.listLock.Lock()
@@ -400,7 +462,9 @@ func (wr *WebrtcRepository) websocketHandler(w http.ResponseWriter, r *http.Requ
 			videoName := strings.Replace(message.Data, "\"", "", -1)
 			wr.logger.Debug("video name received", "data", videoName)
 
-			rtspUrl, err := wr.streamerService.createVideoStream(videoName)
+			claims, _ := auth.ClaimsFromContext(r.Context())
+
+			rtspUrl, err := wr.streamerService.createVideoStream(claims, videoName)
 			if err != nil {
 				wr.logger.Error("", "err", err.Error())
 				return
@@ -413,12 +477,26 @@ func (wr *WebrtcRepository) websocketHandler(w http.ResponseWriter, r *http.Requ
 				wr.logger.Error("failed to publish video-stream", "err", err.Error())
 				return
 			}
+
+			go wr.recordHistory(r.Context(), claims, videoName)
 		case "remove":
 			wr.removeTrack(message.Data)
 		}
 	}
 }
 
+// recordHistory reports the started stream to the user's video history in auth-service
+func (wr *WebrtcRepository) recordHistory(ctx context.Context, claims *auth.Claims, videoName string) {
+	if claims == nil {
+		return
+	}
+
+	err := wr.authClient.RecordHistory(context.WithoutCancel(ctx), claims.UserId, videoName, auth.HistoryEventStream)
+	if err != nil {
+		wr.logger.Error("failed to record video history", "video_name", videoName, "err", err.Error())
+	}
+}
+
 // Helper to make Gorilla Websockets threadsafe
 type threadSafeWriter struct {
 	*websocket.Conn
@@ -9,6 +9,14 @@ type Response struct {
 	Error        string
 }
 
+type Video struct {
+	Key        string `json:"key"`
+	Name       string `json:"name"`
+	OwnerId    int64  `json:"owner_id"`
+	Visibility string `json:"visibility"`
+	Size       int64  `json:"size"`
+}
+
 type websocketMessage struct {
 	Event string `json:"event"`
 	Data  string `json:"data"`
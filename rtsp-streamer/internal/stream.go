@@ -8,6 +8,7 @@ import (
 	"strconv"
 	"sync"
 	"video-handler/configs"
+	"video-handler/external/auth"
 	"video-handler/internal/rtspserver"
 )
 
@@ -29,7 +30,12 @@ func NewStreamerService(service *VideoService, envs *configs.EnvVariables, logge
 	}
 }
 
-func (service *StreamerService) createVideoStream(videoName string) (string, error) {
+func (service *StreamerService) createVideoStream(claims *auth.Claims, videoName string) (string, error) {
+	_, err := service.VideoService.authorizeVideo(claims, videoName, false)
+	if err != nil {
+		return "", err
+	}
+
 	freePort, err := findFreePort()
 	if err != nil {
 		return "", err
@@ -2,11 +2,17 @@ package internal
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"io"
 	"log"
 	"log/slog"
+	"net/http"
+	"path"
+	"strconv"
 	"strings"
 	"video-handler/configs"
+	"video-handler/external/auth"
 
 	"github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
@@ -16,6 +22,23 @@ const (
 	RTSP_SERVER_SUPPORTED_CODECS string = "H264,H265,VP8,VP9,MPEG2,MP3,AAC,Opus,PCM,JPEG"
 )
 
+const (
+	VisibilityPrivate string = "private"
+	VisibilityPublic  string = "public"
+
+	userVideoPrefix    string = "users/"
+	visibilityMetadata string = "Visibility"
+	userMetadataPrefix string = "X-Amz-Meta-"
+	contentTypeHeader  string = "Content-Type"
+)
+
+var (
+	ErrVideoNotFound     = errors.New("video not found")
+	ErrVideoAccessDenied = errors.New("access to the video denied")
+	ErrInvalidVisibility = errors.New("visibility must be private or public")
+	ErrInvalidVideoName  = errors.New("invalid video name")
+)
+
 type VideoService struct {
 	Context     context.Context
 	MinioClient *minio.Client
@@ -38,6 +61,74 @@ func NewVideoService(ctx context.Context, envs *configs.EnvVariables, minioEnvs
 	}, nil
 }
 
+// VideoKey returns the object key of a video uploaded by the user. Videos are stored under
+// a per-user prefix, so uploads of different users never overwrite each other. Only the last
+// element of the name is kept, with backslashes as separators too, as some browsers send the
+// full Windows path of the file.
+func VideoKey(ownerID int64, videoName string) (string, error) {
+	name := path.Base(strings.ReplaceAll(videoName, "\\", "/"))
+	if name == "." || name == ".." || name == "/" {
+		return "", ErrInvalidVideoName
+	}
+
+	return fmt.Sprintf("%s%d/%s", userVideoPrefix, ownerID, name), nil
+}
+
+// newVideo describes the object. Objects outside of the per-user prefixes were uploaded before videos
+// had owners. They have no owner, so only admins may modify them, and they stay public, as they were
+// visible to everyone before, unless an admin made them private.
+func newVideo(key string, size int64, metadata map[string]string) Video {
+	video := Video{
+		Key:        key,
+		Name:       path.Base(key),
+		Size:       size,
+		Visibility: VisibilityPrivate,
+	}
+
+	if rest, ok := strings.CutPrefix(key, userVideoPrefix); ok {
+		owner, _, _ := strings.Cut(rest, "/")
+		video.OwnerId, _ = strconv.ParseInt(owner, 10, 64)
+	} else {
+		video.Visibility = VisibilityPublic
+	}
+
+	for name, value := range metadata {
+		if strings.EqualFold(strings.TrimPrefix(name, userMetadataPrefix), visibilityMetadata) &&
+			(value == VisibilityPublic || value == VisibilityPrivate) {
+			video.Visibility = value
+		}
+	}
+
+	return video
+}
+
+// canAccess reports whether the user may see the video. Only the owner (or an admin) may modify it.
+func canAccess(claims *auth.Claims, video Video, modify bool) bool {
+	if claims.IsAdmin || (video.OwnerId != 0 && video.OwnerId == claims.UserId) {
+		return true
+	}
+
+	return !modify && video.Visibility == VisibilityPublic
+}
+
+// authorizeVideo loads the object of the video and checks that the user is allowed to access it.
+func (service *VideoService) authorizeVideo(claims *auth.Claims, key string, modify bool) (*minio.ObjectInfo, error) {
+	info, err := service.MinioClient.StatObject(service.Context, service.MinioEnvs.Bucket, key, minio.StatObjectOptions{})
+	if err != nil {
+		if minio.ToErrorResponse(err).StatusCode == http.StatusNotFound {
+			return nil, ErrVideoNotFound
+		}
+		return nil, err
+	}
+
+	video := newVideo(info.Key, info.Size, info.UserMetadata)
+	if !canAccess(claims, video, modify) {
+		return nil, ErrVideoAccessDenied
+	}
+
+	return &info, nil
+}
+
 func (service *VideoService) streamVideoToServer(sourseVideName, rtspUrl string) error {
 	video, err := service.MinioClient.GetObject(service.Context, service.MinioEnvs.Bucket, sourseVideName, minio.GetObjectOptions{})
 	if err != nil {
@@ -87,31 +178,100 @@ func (service *VideoService) CreateBucket(ctx context.Context) error {
 	return err
 }
 
-func (service *VideoService) UploadVideo(video io.Reader, videoName string) (minio.UploadInfo, error) {
-	return service.MinioClient.PutObject(service.Context, service.MinioEnvs.Bucket, videoName, video, -1, minio.PutObjectOptions{
+func (service *VideoService) UploadVideo(video io.Reader, ownerID int64, videoName, visibility string) (minio.UploadInfo, error) {
+	key, err := VideoKey(ownerID, videoName)
+	if err != nil {
+		return minio.UploadInfo{}, err
+	}
+
+	return service.MinioClient.PutObject(service.Context, service.MinioEnvs.Bucket, key, video, -1, minio.PutObjectOptions{
 		ContentType: "video/mp4",
+		UserMetadata: map[string]string{
+			visibilityMetadata: visibility,
+		},
 	})
 }
 
-func (service *VideoService) DeleteVideo(videoName string) error {
-	return service.MinioClient.RemoveObject(context.Background(), service.MinioEnvs.Bucket, videoName, minio.RemoveObjectOptions{})
+func (service *VideoService) DeleteVideo(claims *auth.Claims, videoKey string) error {
+	_, err := service.authorizeVideo(claims, videoKey, true)
+	if err != nil {
+		return err
+	}
+
+	return service.MinioClient.RemoveObject(context.Background(), service.MinioEnvs.Bucket, videoKey, minio.RemoveObjectOptions{})
 }
 
-func (service *VideoService) GetVideoList() ([]string, error) {
-	service.Logger.Info("Getting video list from Minio bucket", "bucket", service.MinioEnvs.Bucket)
+// SetVisibility shares the video with everyone or makes it private to its owner again.
+func (service *VideoService) SetVisibility(claims *auth.Claims, videoKey, visibility string) error {
+	if visibility != VisibilityPrivate && visibility != VisibilityPublic {
+		return ErrInvalidVisibility
+	}
+
+	info, err := service.authorizeVideo(claims, videoKey, true)
+	if err != nil {
+		return err
+	}
+
+	dst, src := visibilityCopy(service.MinioEnvs.Bucket, info, visibility)
+	_, err = service.MinioClient.CopyObject(service.Context, dst, src)
+	return err
+}
+
+// visibilityCopy returns the options to copy the object onto itself with the new visibility.
+// Replacing the metadata would reset the Content-Type as well, so it is carried over; minio
+// sends standard headers in UserMetadata as they are.
+func visibilityCopy(bucket string, info *minio.ObjectInfo, visibility string) (minio.CopyDestOptions, minio.CopySrcOptions) {
+	metadata := map[string]string{
+		visibilityMetadata: visibility,
+	}
+	if info.ContentType != "" {
+		metadata[contentTypeHeader] = info.ContentType
+	}
+
+	dst := minio.CopyDestOptions{
+		Bucket:          bucket,
+		Object:          info.Key,
+		ReplaceMetadata: true,
+		UserMetadata:    metadata,
+	}
+	src := minio.CopySrcOptions{
+		Bucket: bucket,
+		Object: info.Key,
+	}
+
+	return dst, src
+}
+
+// GetVideoList returns the videos of the user together with the videos other users made public.
+// Admins get every video in the bucket.
+func (service *VideoService) GetVideoList(claims *auth.Claims) ([]Video, error) {
+	service.Logger.Info("Getting video list from Minio bucket", "bucket", service.MinioEnvs.Bucket, "user_id", claims.UserId)
 	objects := service.MinioClient.ListObjects(context.Background(), service.MinioEnvs.Bucket, minio.ListObjectsOptions{
 		WithMetadata: true,
+		Recursive:    true,
 	})
 
-	var videos []string
+	videos := make([]Video, 0)
 	for obj := range objects {
-		videos = append(videos, obj.Key)
+		if obj.Err != nil {
+			return nil, obj.Err
+		}
+
+		video := newVideo(obj.Key, obj.Size, obj.UserMetadata)
+		if canAccess(claims, video, false) {
+			videos = append(videos, video)
+		}
 	}
 
-	service.Logger.Info("Video list obtained from Minio bucket", "bucket", service.MinioEnvs.Bucket, "videos", videos)
+	service.Logger.Info("Video list obtained from Minio bucket", "bucket", service.MinioEnvs.Bucket, "videos", len(videos))
 	return videos, nil
 }
 
-func (service *VideoService) GetVideo(videoName string) (*minio.Object, error) {
-	return service.MinioClient.GetObject(service.Context, service.MinioEnvs.Bucket, videoName, minio.GetObjectOptions{})
+func (service *VideoService) GetVideo(claims *auth.Claims, videoKey string) (*minio.Object, error) {
+	_, err := service.authorizeVideo(claims, videoKey, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return service.MinioClient.GetObject(service.Context, service.MinioEnvs.Bucket, videoKey, minio.GetObjectOptions{})
 }
@@ -0,0 +1,141 @@
+package internal
+
+import (
+	"net/http"
+	"testing"
+	"video-handler/external/auth"
+
+	"github.com/minio/minio-go/v7"
+)
+
+func TestVideoKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    string
+		wantErr error
+	}{
+		{"video.mp4", "users/7/video.mp4", nil},
+		{"dir/video.mp4", "users/7/video.mp4", nil},
+		{"../../users/8/video.mp4", "users/7/video.mp4", nil},
+		{"/video.mp4", "users/7/video.mp4", nil},
+		{`C:\Users\ivan\video.mp4`, "users/7/video.mp4", nil},
+		{`..\..\video.mp4`, "users/7/video.mp4", nil},
+		{"", "", ErrInvalidVideoName},
+		{".", "", ErrInvalidVideoName},
+		{"..", "", ErrInvalidVideoName},
+		{"/", "", ErrInvalidVideoName},
+		{"videos/..", "", ErrInvalidVideoName},
+		{`\`, "", ErrInvalidVideoName},
+		{`videos\..`, "", ErrInvalidVideoName},
+	}
+	for _, tt := range tests {
+		key, err := VideoKey(7, tt.name)
+		if key != tt.want || err != tt.wantErr {
+			t.Errorf("VideoKey(7, %q) = %q, %v, want %q, %v", tt.name, key, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestNewVideo(t *testing.T) {
+	tests := []struct {
+		name           string
+		key            string
+		metadata       map[string]string
+		wantOwner      int64
+		wantVisibility string
+	}{
+		{"private by default", "users/7/video.mp4", nil, 7, VisibilityPrivate},
+		{"public", "users/7/video.mp4", map[string]string{"Visibility": VisibilityPublic}, 7, VisibilityPublic},
+		{"metadata prefix", "users/7/video.mp4", map[string]string{"X-Amz-Meta-Visibility": VisibilityPublic}, 7, VisibilityPublic},
+		{"unknown visibility", "users/7/video.mp4", map[string]string{"Visibility": "everyone"}, 7, VisibilityPrivate},
+		{"legacy root", "video.mp4", nil, 0, VisibilityPublic},
+		{"legacy root made private", "video.mp4", map[string]string{"Visibility": VisibilityPrivate}, 0, VisibilityPrivate},
+		{"invalid owner", "users/ivan/video.mp4", nil, 0, VisibilityPrivate},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			video := newVideo(tt.key, 42, tt.metadata)
+			if video.Key != tt.key || video.Name != "video.mp4" || video.Size != 42 {
+				t.Fatalf("unexpected video %+v", video)
+			}
+			if video.OwnerId != tt.wantOwner || video.Visibility != tt.wantVisibility {
+				t.Fatalf("got owner %d and visibility %s, want %d and %s", video.OwnerId, video.Visibility, tt.wantOwner, tt.wantVisibility)
+			}
+		})
+	}
+}
+
+func TestCanAccess(t *testing.T) {
+	owner := &auth.Claims{UserId: 7}
+	other := &auth.Claims{UserId: 8}
+	admin := &auth.Claims{UserId: 9, IsAdmin: true}
+
+	private := newVideo("users/7/video.mp4", 0, nil)
+	public := newVideo("users/7/video.mp4", 0, map[string]string{"Visibility": VisibilityPublic})
+	legacy := newVideo("video.mp4", 0, nil)
+	legacyPrivate := newVideo("video.mp4", 0, map[string]string{"Visibility": VisibilityPrivate})
+	// a user without an id must not become the owner of videos without one
+	anonymous := &auth.Claims{}
+
+	tests := []struct {
+		name       string
+		claims     *auth.Claims
+		video      Video
+		wantView   bool
+		wantModify bool
+	}{
+		{"owner private", owner, private, true, true},
+		{"owner public", owner, public, true, true},
+		{"owner legacy", owner, legacy, true, false},
+		{"other private", other, private, false, false},
+		{"other public", other, public, true, false},
+		{"other legacy", other, legacy, true, false},
+		{"other legacy private", other, legacyPrivate, false, false},
+		{"admin private", admin, private, true, true},
+		{"admin public", admin, public, true, true},
+		{"admin legacy", admin, legacy, true, true},
+		{"admin legacy private", admin, legacyPrivate, true, true},
+		{"anonymous legacy", anonymous, legacy, true, false},
+		{"anonymous legacy private", anonymous, legacyPrivate, false, false},
+	}
+	for _, tt := range tests {
+		if got := canAccess(tt.claims, tt.video, false); got != tt.wantView {
+			t.Errorf("%s: view = %t, want %t", tt.name, got, tt.wantView)
+		}
+		if got := canAccess(tt.claims, tt.video, true); got != tt.wantModify {
+			t.Errorf("%s: modify = %t, want %t", tt.name, got, tt.wantModify)
+		}
+	}
+}
+
+func TestVisibilityCopy(t *testing.T) {
+	tests := []struct {
+		name            string
+		contentType     string
+		wantContentType string
+	}{
+		{"keeps the content type", "video/webm", "video/webm"},
+		{"no content type", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info := &minio.ObjectInfo{Key: "users/7/video.mp4", ContentType: tt.contentType}
+			dst, src := visibilityCopy("videos", info, VisibilityPublic)
+			if dst.Bucket != "videos" || dst.Object != info.Key || src.Bucket != "videos" || src.Object != info.Key {
+				t.Fatalf("unexpected copy from %+v to %+v", src, dst)
+			}
+
+			header := make(http.Header)
+			dst.Marshal(header)
+			if got := header.Get("X-Amz-Metadata-Directive"); got != "REPLACE" {
+				t.Errorf("got metadata directive %q", got)
+			}
+			if got := header.Get("X-Amz-Meta-Visibility"); got != VisibilityPublic {
+				t.Errorf("got visibility %q", got)
+			}
+			if got := header.Get("Content-Type"); got != tt.wantContentType {
+				t.Errorf("got content type %q, want %q", got, tt.wantContentType)
+			}
+		})
+	}
+}
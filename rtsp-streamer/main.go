@@ -9,6 +9,7 @@ import (
 	"github.com/go-chi/chi"
 
 	"video-handler/configs"
+	"video-handler/external/auth"
 	"video-handler/internal"
 
 	_ "github.com/joho/godotenv/autoload"
@@ -17,6 +18,7 @@ import (
 func main() {
 	envs := configs.MustConfig()
 	minioConfig := configs.MustConfigMinio()
+	authConfig := configs.MustConfigAuth()
 
 	logger := slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{
 		AddSource: true,
@@ -40,7 +42,9 @@ func main() {
 
 	streamerService := internal.NewStreamerService(videoService, envs, logger, ctx, cancel)
 
-	webrtcRespository := internal.NewWebrtcRepository(r, streamerService, videoService, envs, logger, &ctx)
+	authClient := auth.NewClient(authConfig, logger)
+
+	webrtcRespository := internal.NewWebrtcRepository(r, streamerService, videoService, authClient, envs, logger, &ctx)
 	webrtcRespository.SetupRouter(r)
 
 	logger.Info("server started and running on port :" + envs.ServerPort)
@@ -1,4 +1,18 @@
-let ws = new WebSocket("{{.}}");
+// Токен доступа, выданный auth-service (POST /login)
+function getAccessToken() {
+  let token = localStorage.getItem("access_token");
+  if (!token) {
+    token = window.prompt("Access token");
+    localStorage.setItem("access_token", token);
+  }
+  return token;
+}
+
+function authHeaders() {
+  return { "Authorization": "Bearer " + getAccessToken() };
+}
+
+let ws = new WebSocket("{{.}}", ["access_token", getAccessToken()]);
 
 function init() {
   // Получаем и отображаем список видео
@@ -99,20 +113,20 @@ function removeVideoByTrackID(trackID) {
 }
 
 function updateVideoList() {
-  fetch("http://localhost:8080/video-list")
+  fetch("http://localhost:8080/video-list", { headers: authHeaders() })
     .then(response => response.json())
     .then(videoList => {
       let videoListContainer = document.getElementById("videoList");
       videoListContainer.innerHTML = "";
 
-      videoList.forEach(videoName => {
+      videoList.forEach(video => {
         let li = document.createElement("li");
 
         let videoTitle = document.createElement("span");
-        videoTitle.textContent = videoName;
+        videoTitle.textContent = video.visibility === "public" ? video.name + " (public)" : video.name;
         videoTitle.classList.add("video-title");
 
-        li.onclick = () => startVideoStream(videoName);
+        li.onclick = () => startVideoStream(video.key);
 
         let deleteArea = document.createElement("div");
         deleteArea.classList.add("delete-area");
@@ -122,7 +136,7 @@ function updateVideoList() {
         deleteBtn.classList.add("delete-btn");
         deleteBtn.onclick = (e) => {
           e.stopPropagation(); // Останавливаем всплытие события, чтобы не вызвать startVideoStream
-          removeVideoByName(videoName);
+          removeVideoByName(video.key);
         };
 
         deleteArea.appendChild(deleteBtn);
@@ -136,7 +150,8 @@ function updateVideoList() {
 
 function removeVideoByName(videoName) {
   fetch(`http://localhost:8080/delete?video=${encodeURIComponent(videoName)}`, {
-    method: "DELETE"
+    method: "DELETE",
+    headers: authHeaders()
   })
     .then(response => {
       if (response.ok) {
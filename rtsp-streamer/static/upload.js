@@ -15,6 +15,7 @@ function openFileSelector() {
   
     fetch("http://localhost:8080/upload", {
       method: "POST",
+      headers: authHeaders(),
       body: formData
     })
     .then(response => {